@@ -22,7 +22,12 @@ import (
 
 	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/aliyun"
 	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/aws"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/azure"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/gcp"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/huawei"
 	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/model"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/openstack"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/tencent"
 
 	"github.com/chaosblade-io/chaosblade-spec-go/spec"
 	"github.com/chaosblade-io/chaosblade-spec-go/util"
@@ -44,6 +49,11 @@ func getModels() *spec.Models {
 	modelCommandSpecs := []spec.ExpModelCommandSpec{
 		aliyun.NewAliyunCommandSpec(),
 		aws.NewAwsCommandSpec(),
+		gcp.NewGcpCommandSpec(),
+		azure.NewAzureCommandSpec(),
+		tencent.NewTencentCommandSpec(),
+		huawei.NewHuaweiCommandSpec(),
+		openstack.NewOpenstackCommandSpec(),
 	}
 	specModels := make([]*spec.Models, 0)
 	for _, modeSpec := range modelCommandSpecs {
@@ -35,6 +35,9 @@ func NewAliyunCommandSpec() spec.ExpModelCommandSpec {
 				NewPublicIpActionSpec(),
 				NewPrivateIpActionSpec(),
 				NewDiskActionSpec(),
+				NewEssActionSpec(),
+				NewOssActionSpec(),
+				NewAckNodePoolActionSpec(),
 			},
 			ExpFlags: []spec.ExpFlagSpec{},
 		},
@@ -50,5 +53,5 @@ func (*AliyunCommandSpec) ShortDesc() string {
 }
 
 func (*AliyunCommandSpec) LongDesc() string {
-	return "Aliyun experiment contains ecs, public ip, private ip, networkInterface, securityGroup, VSwitch, disk"
+	return "Aliyun experiment contains ecs, public ip, private ip, networkInterface, securityGroup, VSwitch, disk, ess, oss, ackNodePool"
 }
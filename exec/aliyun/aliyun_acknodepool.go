@@ -0,0 +1,490 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aliyun
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const AckNodePoolBin = "chaos_aliyun_acknodepool"
+
+const ackApiVersion = "2015-12-15"
+
+type AckNodePoolActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewAckNodePoolActionSpec() spec.ExpActionCommandSpec {
+	return &AckNodePoolActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aliyun, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aliyun, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aliyun",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of node pool, support stop, scale, cordon, drain",
+				},
+				&spec.ExpFlag{
+					Name: "clusterId",
+					Desc: "the clusterId of ack",
+				},
+				&spec.ExpFlag{
+					Name: "nodePoolId",
+					Desc: "the nodePoolId of the cluster",
+				},
+				&spec.ExpFlag{
+					Name: "count",
+					Desc: "the count of nodes to stop, cordon or drain",
+				},
+				&spec.ExpFlag{
+					Name: "percent",
+					Desc: "the percent of nodes to stop, cordon or drain, used if count is not provided",
+				},
+				&spec.ExpFlag{
+					Name: "desiredSize",
+					Desc: "the desired size of node pool when operationType is scale, it must be lower than the current one",
+				},
+				&spec.ExpFlag{
+					Name: "kubeconfig",
+					Desc: "the kubeconfig file used by kubectl when operationType is cordon or drain, if not provided, the default of kubectl",
+				},
+			},
+			ActionExecutor: &AckNodePoolExecutor{},
+			ActionExample: `
+# stop 50 percent of the ecs instances of node pool np-x in cluster c-x
+blade create aliyun ackNodePool --accessKeyId xxx --accessKeySecret yyy --regionId cn-qingdao --type stop --clusterId c-x --nodePoolId np-x --percent 50
+
+# scale the node pool np-x in cluster c-x down to 1 node
+blade create aliyun ackNodePool --accessKeyId xxx --accessKeySecret yyy --regionId cn-qingdao --type scale --clusterId c-x --nodePoolId np-x --desiredSize 1
+
+# drain 2 nodes of node pool np-x in cluster c-x
+blade create aliyun ackNodePool --accessKeyId xxx --accessKeySecret yyy --regionId cn-qingdao --type drain --clusterId c-x --nodePoolId np-x --count 2 --kubeconfig ~/.kube/config`,
+			ActionPrograms:   []string{AckNodePoolBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aliyun + "_" + category.AckNodePool},
+		},
+	}
+}
+
+func (*AckNodePoolActionSpec) Name() string {
+	return "ackNodePool"
+}
+
+func (*AckNodePoolActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*AckNodePoolActionSpec) ShortDesc() string {
+	return "do some aliyun ack node pool Operations, like stop, scale, cordon, drain"
+}
+
+func (b *AckNodePoolActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aliyun ack node pool Operations, like stop the ecs instances, scale down, cordon or drain the nodes. The stopped instances are started, the desired size is restored and the nodes are uncordoned on destroy"
+}
+
+type AckNodePoolExecutor struct {
+	channel spec.Channel
+}
+
+func (*AckNodePoolExecutor) Name() string {
+	return "ackNodePool"
+}
+
+// the max time to wait for the instances in transitional states, like Stopping, to be settled before recovering them
+const instanceSettledTimeout = 10 * time.Minute
+
+// the interval to poll the status of instances in transitional states
+var instancePollInterval = 5 * time.Second
+
+// ackNodePoolRecord is the state of the node pool changed by the experiment
+type ackNodePoolRecord struct {
+	OperationType string   `json:"operationType"`
+	ClusterId     string   `json:"clusterId"`
+	NodePoolId    string   `json:"nodePoolId"`
+	Instances     []string `json:"instances,omitempty"`
+	Nodes         []string `json:"nodes,omitempty"`
+	DesiredSize   *int     `json:"desiredSize,omitempty"`
+	Kubeconfig    string   `json:"kubeconfig,omitempty"`
+}
+
+type ackNode struct {
+	InstanceId string `json:"instance_id"`
+	NodeName   string `json:"node_name"`
+	State      string `json:"state"`
+}
+
+func (be *AckNodePoolExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	clusterId := model.ActionFlags["clusterId"]
+	nodePoolId := model.ActionFlags["nodePoolId"]
+	count := model.ActionFlags["count"]
+	percent := model.ActionFlags["percent"]
+	desiredSize := model.ActionFlags["desiredSize"]
+	kubeconfig := model.ActionFlags["kubeconfig"]
+
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if clusterId == "" {
+		log.Errorf(ctx, "clusterId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "clusterId")
+	}
+
+	if nodePoolId == "" {
+		log.Errorf(ctx, "nodePoolId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "nodePoolId")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId)
+	}
+
+	size := -1
+	if operationType == "scale" {
+		value, err := strconv.Atoi(desiredSize)
+		if err != nil || value < 0 {
+			log.Errorf(ctx, "desiredSize %s is illegal, it must be a non-negative integer", desiredSize)
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "desiredSize", desiredSize, "it must be a non-negative integer")
+		}
+		size = value
+	}
+
+	countValue, percentValue := 0, 0
+	if operationType != "scale" {
+		if count == "" && percent == "" {
+			log.Errorf(ctx, "count or percent is required!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "count|percent")
+		}
+		var err error
+		if count != "" {
+			if countValue, err = strconv.Atoi(count); err != nil || countValue <= 0 {
+				return spec.ResponseFailWithFlags(spec.ParameterIllegal, "count", count, "it must be a positive integer")
+			}
+		} else if percentValue, err = strconv.Atoi(percent); err != nil || percentValue <= 0 || percentValue > 100 {
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "percent", percent, "it must be in (0, 100]")
+		}
+	}
+	return be.start(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, clusterId, nodePoolId, kubeconfig, size, countValue, percentValue)
+}
+
+func (be *AckNodePoolExecutor) start(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId, clusterId, nodePoolId, kubeconfig string, size, count, percent int) *spec.Response {
+	record := ackNodePoolRecord{OperationType: operationType, ClusterId: clusterId, NodePoolId: nodePoolId, Kubeconfig: kubeconfig}
+	switch operationType {
+	case "scale":
+		current, _err := describeNodePoolDesiredSize(ctx, accessKeyId, accessKeySecret, regionId, clusterId, nodePoolId)
+		if _err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe node pool failed")
+		}
+		if size >= current {
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "desiredSize", strconv.Itoa(size),
+				fmt.Sprintf("it must be lower than the current desired size %d", current))
+		}
+		record.DesiredSize = &current
+		if _err = exec.SaveRecord(uid, record); _err != nil {
+			log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+			return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+		}
+		return modifyNodePoolDesiredSize(ctx, accessKeyId, accessKeySecret, regionId, clusterId, nodePoolId, size)
+	case "stop", "cordon", "drain":
+		nodes, _err := describeNodePoolNodes(ctx, accessKeyId, accessKeySecret, regionId, clusterId, nodePoolId)
+		if _err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe node pool nodes failed")
+		}
+		nodeNames := make(map[string]string, len(nodes))
+		var instances []string
+		for _, node := range nodes {
+			if node.State == "running" {
+				nodeNames[node.InstanceId] = node.NodeName
+				instances = append(instances, node.InstanceId)
+			}
+		}
+		if count == 0 {
+			count = exec.PercentCount(len(instances), percent)
+		}
+		record.Instances = exec.PickRandomly(instances, count)
+		if len(record.Instances) == 0 {
+			log.Errorf(ctx, "no running node found in node pool %s of cluster %s", nodePoolId, clusterId)
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "nodePoolId", nodePoolId, "no running node found")
+		}
+		for _, instance := range record.Instances {
+			record.Nodes = append(record.Nodes, nodeNames[instance])
+		}
+		if _err = exec.SaveRecord(uid, record); _err != nil {
+			log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+			return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+		}
+		if operationType == "stop" {
+			return stopInstances(ctx, accessKeyId, accessKeySecret, regionId, record.Instances)
+		}
+		return be.kubectl(ctx, operationType, kubeconfig, record.Nodes)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support stop, scale, cordon, drain)")
+	}
+}
+
+func (be *AckNodePoolExecutor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	var record ackNodePoolRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	if record.OperationType != operationType {
+		log.Errorf(ctx, "the experiment %s is created by type %s, not %s", uid, record.OperationType, operationType)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type", operationType, "it must be the type of the experiment "+record.OperationType)
+	}
+	var response *spec.Response
+	switch operationType {
+	case "scale":
+		if record.DesiredSize == nil {
+			log.Errorf(ctx, "the desired size of node pool %s is not in the record of experiment %s", record.NodePoolId, uid)
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type", operationType, "the desired size is not in the record")
+		}
+		response = modifyNodePoolDesiredSize(ctx, accessKeyId, accessKeySecret, regionId, record.ClusterId, record.NodePoolId, *record.DesiredSize)
+	case "stop":
+		instanceStatusMap, _err := describeSettledInstancesStatus(ctx, accessKeyId, accessKeySecret, regionId, record.Instances)
+		if _err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe instances status failed")
+		}
+		// only the stopped instances are started, the ones replaced by the node pool are gone
+		var recovering []string
+		for _, instance := range record.Instances {
+			if instanceStatusMap[instance] == "Stopped" {
+				recovering = append(recovering, instance)
+			}
+		}
+		response = spec.Success()
+		if len(recovering) > 0 {
+			response = startInstances(ctx, accessKeyId, accessKeySecret, regionId, recovering)
+		}
+	case "cordon", "drain":
+		response = be.kubectl(ctx, "uncordon", record.Kubeconfig, record.Nodes)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support stop, scale, cordon, drain)")
+	}
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *AckNodePoolExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// run kubectl cordon, drain or uncordon on the nodes
+func (be *AckNodePoolExecutor) kubectl(ctx context.Context, command, kubeconfig string, nodes []string) *spec.Response {
+	if !be.channel.IsCommandAvailable(ctx, "kubectl") {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type", command, "kubectl command not found")
+	}
+	args := command
+	if kubeconfig != "" {
+		// the quoted path is not expanded by the shell
+		if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(kubeconfig, "~/") {
+			kubeconfig = home + kubeconfig[1:]
+		}
+		args = fmt.Sprintf("--kubeconfig %s %s", shellQuote(kubeconfig), args)
+	}
+	if command == "drain" {
+		args = args + " --ignore-daemonsets --delete-emptydir-data --force"
+	}
+	for _, node := range nodes {
+		response := be.channel.Run(ctx, "kubectl", fmt.Sprintf("%s %s", args, shellQuote(node)))
+		if !response.Success {
+			log.Errorf(ctx, "kubectl %s node %s failed, err: %s", command, node, response.Err)
+			return response
+		}
+	}
+	return spec.Success()
+}
+
+// quote the value as a single argument of the shell command run by the channel
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// describe instances status after the instances in transitional states are settled, like Stopping to Stopped,
+// so that the instances operated just now are not missed
+func describeSettledInstancesStatus(ctx context.Context, accessKeyId, accessKeySecret, regionId string, instances []string) (_result map[string]string, _err error) {
+	start := time.Now()
+	for {
+		_result, _err = describeInstancesStatus(ctx, accessKeyId, accessKeySecret, regionId, instances)
+		if _err != nil {
+			return _result, _err
+		}
+		var settling []string
+		for _, instance := range instances {
+			switch _result[instance] {
+			case "Pending", "Starting", "Stopping":
+				settling = append(settling, instance)
+			}
+		}
+		if len(settling) == 0 {
+			return _result, nil
+		}
+		if time.Since(start) > instanceSettledTimeout {
+			_err = fmt.Errorf("aliyun instances %v are not settled after %s", settling, instanceSettledTimeout)
+			log.Errorf(ctx, "wait aliyun instances settled failed, err: %s", _err.Error())
+			return nil, _err
+		}
+		log.Infof(ctx, "wait aliyun instances %v settled", settling)
+		time.Sleep(instancePollInterval)
+	}
+}
+
+// describe the nodes of node pool
+func describeNodePoolNodes(ctx context.Context, accessKeyId, accessKeySecret, regionId, clusterId, nodePoolId string) (_result []ackNode, _err error) {
+	client, _err := CreateOpenApiClient(tea.String(accessKeyId), tea.String(accessKeySecret), "cs."+regionId+".aliyuncs.com")
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun client failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	for pageNumber := 1; ; pageNumber++ {
+		query := map[string]*string{
+			"nodepool_id": tea.String(nodePoolId),
+			"pageNumber":  tea.String(strconv.Itoa(pageNumber)),
+			"pageSize":    tea.String("100"),
+		}
+		var body struct {
+			Nodes []ackNode `json:"nodes"`
+			Page  struct {
+				TotalCount int `json:"total_count"`
+			} `json:"page"`
+		}
+		_err = callRoaApi(client, "DescribeClusterNodes", ackApiVersion, "GET", "/clusters/"+clusterId+"/nodes", query, nil, &body)
+		if _err != nil {
+			log.Errorf(ctx, "describe aliyun ack node pool nodes failed, err: %s", _err.Error())
+			return _result, _err
+		}
+		_result = append(_result, body.Nodes...)
+		if len(body.Nodes) == 0 || len(_result) >= body.Page.TotalCount {
+			break
+		}
+	}
+	return _result, _err
+}
+
+// describe the desired size of node pool
+func describeNodePoolDesiredSize(ctx context.Context, accessKeyId, accessKeySecret, regionId, clusterId, nodePoolId string) (_result int, _err error) {
+	client, _err := CreateOpenApiClient(tea.String(accessKeyId), tea.String(accessKeySecret), "cs."+regionId+".aliyuncs.com")
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun client failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	var body struct {
+		ScalingGroup struct {
+			DesiredSize *int `json:"desired_size"`
+		} `json:"scaling_group"`
+	}
+	_err = callRoaApi(client, "DescribeClusterNodePoolDetail", ackApiVersion, "GET", "/clusters/"+clusterId+"/nodepools/"+nodePoolId, nil, nil, &body)
+	if _err != nil {
+		log.Errorf(ctx, "describe aliyun ack node pool failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	if body.ScalingGroup.DesiredSize == nil {
+		_err = fmt.Errorf("the desired size of node pool %s is not set", nodePoolId)
+		log.Errorf(ctx, "describe aliyun ack node pool failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	_result = *body.ScalingGroup.DesiredSize
+	return _result, _err
+}
+
+// modify the desired size of node pool
+func modifyNodePoolDesiredSize(ctx context.Context, accessKeyId, accessKeySecret, regionId, clusterId, nodePoolId string, desiredSize int) *spec.Response {
+	client, _err := CreateOpenApiClient(tea.String(accessKeyId), tea.String(accessKeySecret), "cs."+regionId+".aliyuncs.com")
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aliyun client failed")
+	}
+
+	request := map[string]interface{}{
+		"scaling_group": map[string]interface{}{
+			"desired_size": desiredSize,
+		},
+	}
+	_err = callRoaApi(client, "ModifyClusterNodePool", ackApiVersion, "PUT", "/clusters/"+clusterId+"/nodepools/"+nodePoolId, nil, request, nil)
+	if _err != nil {
+		log.Errorf(ctx, "modify aliyun ack node pool desired size failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "modify aliyun ack node pool desired size failed")
+	}
+	return spec.Success()
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aliyun
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chaosblade-io/chaosblade-spec-go/channel"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+func TestAliyunAckNodePoolNodesDescribe(t *testing.T) {
+	_, _err := describeNodePoolNodes(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "regionId", "c-x", "np-x")
+	assert.NotNil(t, _err, "they should be equal")
+}
+
+func TestAliyunAckNodePoolDesiredSizeDescribe(t *testing.T) {
+	_, _err := describeNodePoolDesiredSize(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "regionId", "c-x", "np-x")
+	assert.NotNil(t, _err, "they should be equal")
+}
+
+func TestAliyunAckNodePoolDesiredSizeModify(t *testing.T) {
+	result := modifyNodePoolDesiredSize(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "regionId", "c-x", "np-x", 1)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAliyunAckNodePoolStopMismatchedRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	ctx := context.WithValue(context.Background(), "uid", "123")
+	assert.Nil(t, exec.SaveRecord("123", ackNodePoolRecord{OperationType: "stop", ClusterId: "c-x", NodePoolId: "np-x", Instances: []string{"i-x"}}))
+
+	result := (&AckNodePoolExecutor{}).stop(ctx, "123", "scale", "accessKeyId", "accessKeySecret", "regionId")
+	assert.Equal(t, int32(47000), result.Code, "they should be equal")
+}
+
+func TestAliyunAckNodePoolCountRequired(t *testing.T) {
+	executor := &AckNodePoolExecutor{}
+	executor.SetChannel(channel.NewLocalChannel())
+	model := &spec.ExpModel{ActionFlags: map[string]string{
+		"accessKeyId": "accessKeyId", "accessKeySecret": "accessKeySecret", "regionId": "regionId",
+		"type": "stop", "clusterId": "c-x", "nodePoolId": "np-x",
+	}}
+	result := executor.Exec("123", context.WithValue(context.Background(), "uid", "123"), model)
+	assert.Equal(t, int32(45000), result.Code, "they should be equal")
+}
+
+func TestAliyunAckNodePoolShellQuote(t *testing.T) {
+	assert.Equal(t, `'/tmp/my config'`, shellQuote("/tmp/my config"), "they should be equal")
+	assert.Equal(t, `'a'\''; rm -rf b'`, shellQuote("a'; rm -rf b"), "they should be equal")
+}
@@ -18,11 +18,13 @@ package aliyun
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"strings"
 
 	openapi "github.com/alibabacloud-go/darabonba-openapi/client"
 	ecs20140526 "github.com/alibabacloud-go/ecs-20140526/v4/client"
+	util2 "github.com/alibabacloud-go/tea-utils/service"
 	"github.com/alibabacloud-go/tea/tea"
 	"github.com/chaosblade-io/chaosblade-spec-go/channel"
 	"github.com/chaosblade-io/chaosblade-spec-go/log"
@@ -214,6 +216,79 @@ func CreateClient(accessKeyId *string, accessKeySecret *string, regionId string)
 	return _result, _err
 }
 
+// CreateOpenApiClient creates the client of the aliyun product which has no go sdk in the project, like ess
+func CreateOpenApiClient(accessKeyId *string, accessKeySecret *string, endpoint string) (_result *openapi.Client, _err error) {
+	config := &openapi.Config{
+		AccessKeyId:     accessKeyId,
+		AccessKeySecret: accessKeySecret,
+	}
+	config.Endpoint = tea.String(endpoint)
+	_result = &openapi.Client{}
+	_result, _err = openapi.NewClient(config)
+	return _result, _err
+}
+
+// call the rpc style api of aliyun, the response body is decoded into body
+func callRpcApi(client *openapi.Client, action, version string, query map[string]*string, body interface{}) (_err error) {
+	params := &openapi.Params{
+		Action:      tea.String(action),
+		Version:     tea.String(version),
+		Protocol:    tea.String("HTTPS"),
+		Pathname:    tea.String("/"),
+		Method:      tea.String("POST"),
+		AuthType:    tea.String("AK"),
+		Style:       tea.String("RPC"),
+		ReqBodyType: tea.String("formData"),
+		BodyType:    tea.String("json"),
+	}
+	request := &openapi.OpenApiRequest{
+		Query: query,
+	}
+	response, _err := client.CallApi(params, request, &util2.RuntimeOptions{})
+	if _err != nil {
+		return _err
+	}
+	if body == nil {
+		return _err
+	}
+	bytes, _err := json.Marshal(response["body"])
+	if _err != nil {
+		return _err
+	}
+	return json.Unmarshal(bytes, body)
+}
+
+// call the roa style api of aliyun, the request body is sent as json and the response body is decoded into body
+func callRoaApi(client *openapi.Client, action, version, method, pathname string, query map[string]*string, request interface{}, body interface{}) (_err error) {
+	params := &openapi.Params{
+		Action:      tea.String(action),
+		Version:     tea.String(version),
+		Protocol:    tea.String("HTTPS"),
+		Pathname:    tea.String(pathname),
+		Method:      tea.String(method),
+		AuthType:    tea.String("AK"),
+		Style:       tea.String("ROA"),
+		ReqBodyType: tea.String("json"),
+		BodyType:    tea.String("json"),
+	}
+	openApiRequest := &openapi.OpenApiRequest{
+		Query: query,
+		Body:  request,
+	}
+	response, _err := client.CallApi(params, openApiRequest, &util2.RuntimeOptions{})
+	if _err != nil {
+		return _err
+	}
+	if body == nil {
+		return _err
+	}
+	bytes, _err := json.Marshal(response["body"])
+	if _err != nil {
+		return _err
+	}
+	return json.Unmarshal(bytes, body)
+}
+
 // start instances
 func startInstances(ctx context.Context, accessKeyId, accessKeySecret, regionId string, instances []string) *spec.Response {
 	client, _err := CreateClient(tea.String(accessKeyId), tea.String(accessKeySecret), regionId)
@@ -0,0 +1,521 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aliyun
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const EssBin = "chaos_aliyun_ess"
+
+const essApiVersion = "2014-08-28"
+
+// the scaling processes suspended by default
+var essScalingProcesses = []string{"ScaleIn", "ScaleOut", "HealthCheck", "AlarmNotification", "ScheduledAction"}
+
+type EssActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewEssActionSpec() spec.ExpActionCommandSpec {
+	return &EssActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aliyun, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aliyun, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aliyun",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of scaling group, support suspend, capacity, remove",
+				},
+				&spec.ExpFlag{
+					Name: "scalingGroupId",
+					Desc: "the scalingGroupId",
+				},
+				&spec.ExpFlag{
+					Name: "processes",
+					Desc: "the scaling processes to suspend, split by comma, default is ScaleIn,ScaleOut,HealthCheck,AlarmNotification,ScheduledAction",
+				},
+				&spec.ExpFlag{
+					Name: "desiredCapacity",
+					Desc: "the desired capacity to set when operationType is capacity, it must be lower than the current one",
+				},
+				&spec.ExpFlag{
+					Name: "count",
+					Desc: "the count of in-service instances to remove when operationType is remove",
+				},
+				&spec.ExpFlag{
+					Name: "percent",
+					Desc: "the percent of in-service instances to remove when operationType is remove, used if count is not provided",
+				},
+				&spec.ExpFlag{
+					Name:    "terminate",
+					Desc:    "release the removed instances if true, default is false, the removed instances are kept",
+					Default: "false",
+				},
+			},
+			ActionExecutor: &EssExecutor{},
+			ActionExample: `
+# suspend the ScaleOut and HealthCheck processes of scaling group asg-x
+blade create aliyun ess --accessKeyId xxx --accessKeySecret yyy --regionId cn-qingdao --type suspend --scalingGroupId asg-x --processes ScaleOut,HealthCheck
+
+# set the desired capacity of scaling group asg-x to 1
+blade create aliyun ess --accessKeyId xxx --accessKeySecret yyy --regionId cn-qingdao --type capacity --scalingGroupId asg-x --desiredCapacity 1
+
+# remove and release 50 percent of the in-service instances of scaling group asg-x
+blade create aliyun ess --accessKeyId xxx --accessKeySecret yyy --regionId cn-qingdao --type remove --scalingGroupId asg-x --percent 50 --terminate true`,
+			ActionPrograms:   []string{EssBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aliyun + "_" + category.Ess},
+		},
+	}
+}
+
+func (*EssActionSpec) Name() string {
+	return "ess"
+}
+
+func (*EssActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*EssActionSpec) ShortDesc() string {
+	return "do some aliyun auto scaling group Operations, like suspend, capacity, remove"
+}
+
+func (b *EssActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aliyun auto scaling group Operations, like suspend processes, lower the desired capacity, remove in-service instances. The suspended processes and capacity are restored on destroy"
+}
+
+type EssExecutor struct {
+	channel spec.Channel
+}
+
+func (*EssExecutor) Name() string {
+	return "ess"
+}
+
+// essRecord is the state of the scaling group changed by the experiment
+type essRecord struct {
+	OperationType      string   `json:"operationType"`
+	ScalingGroupId     string   `json:"scalingGroupId"`
+	SuspendedProcesses []string `json:"suspendedProcesses,omitempty"`
+	DesiredCapacity    *int     `json:"desiredCapacity,omitempty"`
+	MinSize            *int     `json:"minSize,omitempty"`
+	RemovedInstances   []string `json:"removedInstances,omitempty"`
+}
+
+type essScalingGroup struct {
+	ScalingGroupId     string
+	MinSize            int
+	MaxSize            int
+	DesiredCapacity    *int
+	SuspendedProcesses struct {
+		SuspendedProcess []string
+	}
+}
+
+func (be *EssExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	scalingGroupId := model.ActionFlags["scalingGroupId"]
+	processes := model.ActionFlags["processes"]
+	desiredCapacity := model.ActionFlags["desiredCapacity"]
+	count := model.ActionFlags["count"]
+	percent := model.ActionFlags["percent"]
+	terminate := model.ActionFlags["terminate"] == "true"
+
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if scalingGroupId == "" {
+		log.Errorf(ctx, "scalingGroupId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "scalingGroupId")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, scalingGroupId)
+	}
+
+	processesArray := essScalingProcesses
+	if processes != "" {
+		processesArray = strings.Split(processes, ",")
+	}
+
+	capacity := -1
+	if operationType == "capacity" {
+		value, err := strconv.Atoi(desiredCapacity)
+		if err != nil || value < 0 {
+			log.Errorf(ctx, "desiredCapacity %s is illegal, it must be a non-negative integer", desiredCapacity)
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "desiredCapacity", desiredCapacity, "it must be a non-negative integer")
+		}
+		capacity = value
+	}
+
+	countValue, percentValue := 0, 0
+	if operationType == "remove" {
+		if count == "" && percent == "" {
+			log.Errorf(ctx, "count or percent is required when operationType is remove!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "count|percent")
+		}
+		var err error
+		if count != "" {
+			if countValue, err = strconv.Atoi(count); err != nil || countValue <= 0 {
+				return spec.ResponseFailWithFlags(spec.ParameterIllegal, "count", count, "it must be a positive integer")
+			}
+		} else if percentValue, err = strconv.Atoi(percent); err != nil || percentValue <= 0 || percentValue > 100 {
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "percent", percent, "it must be in (0, 100]")
+		}
+	}
+	return be.start(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, scalingGroupId, processesArray, capacity, countValue, percentValue, terminate)
+}
+
+func (be *EssExecutor) start(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId, scalingGroupId string, processes []string, capacity, count, percent int, terminate bool) *spec.Response {
+	switch operationType {
+	case "suspend", "capacity", "remove":
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support suspend, capacity, remove)")
+	}
+	scalingGroup, _err := describeScalingGroup(ctx, accessKeyId, accessKeySecret, regionId, scalingGroupId)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe scaling group failed")
+	}
+	record := essRecord{OperationType: operationType, ScalingGroupId: scalingGroupId}
+	switch operationType {
+	case "suspend":
+		suspended := make(map[string]bool)
+		for _, process := range scalingGroup.SuspendedProcesses.SuspendedProcess {
+			suspended[process] = true
+		}
+		for _, process := range processes {
+			if !suspended[process] {
+				record.SuspendedProcesses = append(record.SuspendedProcesses, process)
+			}
+		}
+		if len(record.SuspendedProcesses) == 0 {
+			log.Errorf(ctx, "the processes %v of scaling group %s are suspended already", processes, scalingGroupId)
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "processes", strings.Join(processes, ","), "they are suspended already")
+		}
+		if _err = exec.SaveRecord(uid, record); _err != nil {
+			log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+			return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+		}
+		return suspendScalingProcesses(ctx, accessKeyId, accessKeySecret, regionId, scalingGroupId, record.SuspendedProcesses)
+	case "capacity":
+		if scalingGroup.DesiredCapacity == nil {
+			log.Errorf(ctx, "the desired capacity of scaling group %s is not enabled", scalingGroupId)
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "scalingGroupId", scalingGroupId, "the desired capacity is not enabled")
+		}
+		if capacity >= *scalingGroup.DesiredCapacity {
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "desiredCapacity", strconv.Itoa(capacity),
+				fmt.Sprintf("it must be lower than the current desired capacity %d", *scalingGroup.DesiredCapacity))
+		}
+		minSize := scalingGroup.MinSize
+		record.DesiredCapacity = scalingGroup.DesiredCapacity
+		record.MinSize = &minSize
+		if capacity < minSize {
+			minSize = capacity
+		}
+		if _err = exec.SaveRecord(uid, record); _err != nil {
+			log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+			return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+		}
+		return modifyScalingGroupCapacity(ctx, accessKeyId, accessKeySecret, regionId, scalingGroupId, capacity, minSize)
+	default:
+		instances, _err := describeInServiceScalingInstances(ctx, accessKeyId, accessKeySecret, regionId, scalingGroupId)
+		if _err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe scaling instances failed")
+		}
+		if count == 0 {
+			count = exec.PercentCount(len(instances), percent)
+		}
+		record.RemovedInstances = exec.PickRandomly(instances, count)
+		if len(record.RemovedInstances) == 0 {
+			log.Errorf(ctx, "no in-service instance found in scaling group %s", scalingGroupId)
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "scalingGroupId", scalingGroupId, "no in-service instance found")
+		}
+		if _err = exec.SaveRecord(uid, record); _err != nil {
+			log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+			return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+		}
+		return removeScalingInstances(ctx, accessKeyId, accessKeySecret, regionId, scalingGroupId, record.RemovedInstances, terminate)
+	}
+}
+
+func (be *EssExecutor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId, scalingGroupId string) *spec.Response {
+	var record essRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	if record.OperationType != operationType {
+		log.Errorf(ctx, "the experiment %s is created by type %s, not %s", uid, record.OperationType, operationType)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type", operationType, "it must be the type of the experiment "+record.OperationType)
+	}
+	response := spec.Success()
+	switch operationType {
+	case "suspend":
+		response = resumeScalingProcesses(ctx, accessKeyId, accessKeySecret, regionId, record.ScalingGroupId, record.SuspendedProcesses)
+	case "capacity":
+		if record.DesiredCapacity == nil || record.MinSize == nil {
+			log.Errorf(ctx, "the capacity of scaling group %s is not in the record of experiment %s", record.ScalingGroupId, uid)
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type", operationType, "the capacity is not in the record")
+		}
+		response = modifyScalingGroupCapacity(ctx, accessKeyId, accessKeySecret, regionId, record.ScalingGroupId, *record.DesiredCapacity, *record.MinSize)
+	case "remove":
+		// the removed instances are replaced by the scaling group itself
+		log.Infof(ctx, "instances %v were removed from scaling group %s", record.RemovedInstances, record.ScalingGroupId)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support suspend, capacity, remove)")
+	}
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *EssExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// set query of the repeat list parameter, like ScalingProcess.1
+func setRepeatQuery(query map[string]*string, name string, values []string) {
+	for i, value := range values {
+		query[fmt.Sprintf("%s.%d", name, i+1)] = tea.String(value)
+	}
+}
+
+// suspend scaling processes
+func suspendScalingProcesses(ctx context.Context, accessKeyId, accessKeySecret, regionId, scalingGroupId string, processes []string) *spec.Response {
+	client, _err := CreateOpenApiClient(tea.String(accessKeyId), tea.String(accessKeySecret), "ess."+regionId+".aliyuncs.com")
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aliyun client failed")
+	}
+
+	query := map[string]*string{
+		"RegionId":       tea.String(regionId),
+		"ScalingGroupId": tea.String(scalingGroupId),
+	}
+	setRepeatQuery(query, "ScalingProcess", processes)
+	_err = callRpcApi(client, "SuspendProcesses", essApiVersion, query, nil)
+	if _err != nil {
+		log.Errorf(ctx, "suspend aliyun scaling processes failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "suspend aliyun scaling processes failed")
+	}
+	return spec.Success()
+}
+
+// resume scaling processes
+func resumeScalingProcesses(ctx context.Context, accessKeyId, accessKeySecret, regionId, scalingGroupId string, processes []string) *spec.Response {
+	client, _err := CreateOpenApiClient(tea.String(accessKeyId), tea.String(accessKeySecret), "ess."+regionId+".aliyuncs.com")
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aliyun client failed")
+	}
+
+	query := map[string]*string{
+		"RegionId":       tea.String(regionId),
+		"ScalingGroupId": tea.String(scalingGroupId),
+	}
+	setRepeatQuery(query, "ScalingProcess", processes)
+	_err = callRpcApi(client, "ResumeProcesses", essApiVersion, query, nil)
+	if _err != nil {
+		log.Errorf(ctx, "resume aliyun scaling processes failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "resume aliyun scaling processes failed")
+	}
+	return spec.Success()
+}
+
+// modify the desired capacity and min size of scaling group
+func modifyScalingGroupCapacity(ctx context.Context, accessKeyId, accessKeySecret, regionId, scalingGroupId string, desiredCapacity, minSize int) *spec.Response {
+	client, _err := CreateOpenApiClient(tea.String(accessKeyId), tea.String(accessKeySecret), "ess."+regionId+".aliyuncs.com")
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aliyun client failed")
+	}
+
+	query := map[string]*string{
+		"RegionId":        tea.String(regionId),
+		"ScalingGroupId":  tea.String(scalingGroupId),
+		"DesiredCapacity": tea.String(strconv.Itoa(desiredCapacity)),
+		"MinSize":         tea.String(strconv.Itoa(minSize)),
+	}
+	_err = callRpcApi(client, "ModifyScalingGroup", essApiVersion, query, nil)
+	if _err != nil {
+		log.Errorf(ctx, "modify aliyun scaling group capacity failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "modify aliyun scaling group capacity failed")
+	}
+	return spec.Success()
+}
+
+// remove instances from scaling group, release them if terminate is true
+func removeScalingInstances(ctx context.Context, accessKeyId, accessKeySecret, regionId, scalingGroupId string, instances []string, terminate bool) *spec.Response {
+	client, _err := CreateOpenApiClient(tea.String(accessKeyId), tea.String(accessKeySecret), "ess."+regionId+".aliyuncs.com")
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aliyun client failed")
+	}
+
+	removePolicy := "remove"
+	if terminate {
+		removePolicy = "release"
+	}
+	query := map[string]*string{
+		"RegionId":                tea.String(regionId),
+		"ScalingGroupId":          tea.String(scalingGroupId),
+		"RemovePolicy":            tea.String(removePolicy),
+		"DecreaseDesiredCapacity": tea.String("false"),
+	}
+	setRepeatQuery(query, "InstanceIds", instances)
+	_err = callRpcApi(client, "RemoveInstances", essApiVersion, query, nil)
+	if _err != nil {
+		log.Errorf(ctx, "remove aliyun scaling instances failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "remove aliyun scaling instances failed")
+	}
+	return spec.Success()
+}
+
+// describe scaling group
+func describeScalingGroup(ctx context.Context, accessKeyId, accessKeySecret, regionId, scalingGroupId string) (_result *essScalingGroup, _err error) {
+	client, _err := CreateOpenApiClient(tea.String(accessKeyId), tea.String(accessKeySecret), "ess."+regionId+".aliyuncs.com")
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun client failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	query := map[string]*string{
+		"RegionId":         tea.String(regionId),
+		"ScalingGroupId.1": tea.String(scalingGroupId),
+	}
+	var body struct {
+		ScalingGroups struct {
+			ScalingGroup []*essScalingGroup
+		}
+	}
+	_err = callRpcApi(client, "DescribeScalingGroups", essApiVersion, query, &body)
+	if _err != nil {
+		log.Errorf(ctx, "describe aliyun scaling group failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	if len(body.ScalingGroups.ScalingGroup) == 0 {
+		_err = fmt.Errorf("scaling group %s not found", scalingGroupId)
+		log.Errorf(ctx, "describe aliyun scaling group failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	_result = body.ScalingGroups.ScalingGroup[0]
+	return _result, _err
+}
+
+// describe the in-service instances of scaling group
+func describeInServiceScalingInstances(ctx context.Context, accessKeyId, accessKeySecret, regionId, scalingGroupId string) (_result []string, _err error) {
+	client, _err := CreateOpenApiClient(tea.String(accessKeyId), tea.String(accessKeySecret), "ess."+regionId+".aliyuncs.com")
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun client failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	for pageNumber := 1; ; pageNumber++ {
+		query := map[string]*string{
+			"RegionId":       tea.String(regionId),
+			"ScalingGroupId": tea.String(scalingGroupId),
+			"LifecycleState": tea.String("InService"),
+			"PageNumber":     tea.String(strconv.Itoa(pageNumber)),
+			"PageSize":       tea.String("50"),
+		}
+		var body struct {
+			TotalCount       int
+			ScalingInstances struct {
+				ScalingInstance []struct {
+					InstanceId string
+				}
+			}
+		}
+		_err = callRpcApi(client, "DescribeScalingInstances", essApiVersion, query, &body)
+		if _err != nil {
+			log.Errorf(ctx, "describe aliyun scaling instances failed, err: %s", _err.Error())
+			return _result, _err
+		}
+		for _, instance := range body.ScalingInstances.ScalingInstance {
+			_result = append(_result, instance.InstanceId)
+		}
+		if len(body.ScalingInstances.ScalingInstance) == 0 || len(_result) >= body.TotalCount {
+			break
+		}
+	}
+	return _result, _err
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aliyun
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+func TestAliyunEssSuspendProcesses(t *testing.T) {
+	result := suspendScalingProcesses(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "regionId", "asg-x", []string{"ScaleIn"})
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAliyunEssResumeProcesses(t *testing.T) {
+	result := resumeScalingProcesses(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "regionId", "asg-x", []string{"ScaleIn"})
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAliyunEssModifyCapacity(t *testing.T) {
+	result := modifyScalingGroupCapacity(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "regionId", "asg-x", 1, 1)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAliyunEssRemoveInstances(t *testing.T) {
+	result := removeScalingInstances(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "regionId", "asg-x", []string{"i-x"}, false)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAliyunEssDescribe(t *testing.T) {
+	_, _err := describeScalingGroup(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "regionId", "asg-x")
+	assert.NotNil(t, _err, "they should be equal")
+	_, _err = describeInServiceScalingInstances(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "regionId", "asg-x")
+	assert.NotNil(t, _err, "they should be equal")
+}
+
+func TestAliyunEssStopMismatchedRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	ctx := context.WithValue(context.Background(), "uid", "123")
+	assert.Nil(t, exec.SaveRecord("123", essRecord{OperationType: "suspend", ScalingGroupId: "asg-x", SuspendedProcesses: []string{"ScaleIn"}}))
+
+	result := (&EssExecutor{}).stop(ctx, "123", "capacity", "accessKeyId", "accessKeySecret", "regionId", "asg-x")
+	assert.Equal(t, int32(47000), result.Code, "they should be equal")
+}
@@ -0,0 +1,425 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aliyun
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const OssBin = "chaos_aliyun_oss"
+
+// the data actions denied by default, the management actions are kept so the policy can be restored
+const ossDefaultActions = "oss:GetObject,oss:PutObject,oss:DeleteObject,oss:ListObjects"
+
+type OssActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewOssActionSpec() spec.ExpActionCommandSpec {
+	return &OssActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aliyun, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aliyun, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aliyun",
+				},
+				&spec.ExpFlag{
+					Name: "endpoint",
+					Desc: "the endpoint of oss, if not provided, https://oss-{regionId}.aliyuncs.com",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of bucket, support deny, referer",
+				},
+				&spec.ExpFlag{
+					Name: "bucket",
+					Desc: "the bucket name",
+				},
+				&spec.ExpFlag{
+					Name: "principals",
+					Desc: "the principals denied when operationType is deny, split by comma, default is all",
+				},
+				&spec.ExpFlag{
+					Name: "prefixes",
+					Desc: "the object prefixes denied when operationType is deny, split by comma, default is the whole bucket",
+				},
+				&spec.ExpFlag{
+					Name: "actions",
+					Desc: "the actions denied when operationType is deny, split by comma, default is " + ossDefaultActions,
+				},
+				&spec.ExpFlag{
+					Name: "sourceIps",
+					Desc: "the source ips or cidr blocks denied when operationType is deny, split by comma, default is all",
+				},
+				&spec.ExpFlag{
+					Name: "referers",
+					Desc: "the referers blocked when operationType is referer, split by comma",
+				},
+			},
+			ActionExecutor: &OssExecutor{},
+			ActionExample: `
+# deny all principals to read and write the objects of bucket b-x
+blade create aliyun oss --accessKeyId xxx --accessKeySecret yyy --regionId cn-qingdao --type deny --bucket b-x
+
+# deny user 20214760404935xxxx to get the objects under prefix logs/ of bucket b-x
+blade create aliyun oss --accessKeyId xxx --accessKeySecret yyy --regionId cn-qingdao --type deny --bucket b-x --principals 20214760404935xxxx --prefixes logs/ --actions oss:GetObject
+
+# deny the requests from 192.168.0.0/16 to bucket b-x
+blade create aliyun oss --accessKeyId xxx --accessKeySecret yyy --regionId cn-qingdao --type deny --bucket b-x --sourceIps 192.168.0.0/16
+
+# block the requests of bucket b-x which referer is http://www.example.com
+blade create aliyun oss --accessKeyId xxx --accessKeySecret yyy --regionId cn-qingdao --type referer --bucket b-x --referers http://www.example.com`,
+			ActionPrograms:   []string{OssBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aliyun + "_" + category.Oss},
+		},
+	}
+}
+
+func (*OssActionSpec) Name() string {
+	return "oss"
+}
+
+func (*OssActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*OssActionSpec) ShortDesc() string {
+	return "do some aliyun oss bucket Operations, like deny, referer"
+}
+
+func (b *OssActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aliyun oss bucket Operations, like install a deny bucket policy, block referers. The previous bucket policy or referer configuration is restored on destroy"
+}
+
+type OssExecutor struct {
+	channel spec.Channel
+}
+
+func (*OssExecutor) Name() string {
+	return "oss"
+}
+
+// ossRecord is the bucket configuration before the experiment
+type ossRecord struct {
+	Bucket    string `json:"bucket"`
+	HasPolicy bool   `json:"hasPolicy"`
+	Policy    string `json:"policy,omitempty"`
+	Referer   string `json:"referer,omitempty"`
+}
+
+func (be *OssExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	endpoint := model.ActionFlags["endpoint"]
+	operationType := model.ActionFlags["type"]
+	bucket := model.ActionFlags["bucket"]
+	principals := model.ActionFlags["principals"]
+	prefixes := model.ActionFlags["prefixes"]
+	actions := model.ActionFlags["actions"]
+	sourceIps := model.ActionFlags["sourceIps"]
+	referers := model.ActionFlags["referers"]
+
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if endpoint == "" {
+		if regionId == "" {
+			log.Errorf(ctx, "regionId or endpoint is required!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId|endpoint")
+		}
+		endpoint = "https://oss-" + regionId + ".aliyuncs.com"
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if bucket == "" {
+		log.Errorf(ctx, "bucket is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "bucket")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, endpoint, bucket)
+	}
+
+	if operationType == "referer" && referers == "" {
+		log.Errorf(ctx, "referers is required when operationType is referer!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "referers")
+	}
+	if actions == "" {
+		actions = ossDefaultActions
+	}
+	return be.start(ctx, uid, operationType, accessKeyId, accessKeySecret, endpoint, bucket, exec.SplitFlag(principals), exec.SplitFlag(prefixes), exec.SplitFlag(actions), exec.SplitFlag(sourceIps), exec.SplitFlag(referers))
+}
+
+func (be *OssExecutor) start(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, endpoint, bucket string, principals, prefixes, actions, sourceIps, referers []string) *spec.Response {
+	switch operationType {
+	case "deny":
+		return denyOssBucket(ctx, uid, accessKeyId, accessKeySecret, endpoint, bucket, principals, prefixes, actions, sourceIps)
+	case "referer":
+		return blockOssReferers(ctx, uid, accessKeyId, accessKeySecret, endpoint, bucket, referers)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support deny, referer)")
+	}
+}
+
+func (be *OssExecutor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, endpoint, bucket string) *spec.Response {
+	switch operationType {
+	case "deny":
+		return restoreOssBucketPolicy(ctx, uid, accessKeyId, accessKeySecret, endpoint)
+	case "referer":
+		return restoreOssReferer(ctx, uid, accessKeyId, accessKeySecret, endpoint)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support deny, referer)")
+	}
+}
+
+func (be *OssExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// build the deny statement of bucket policy
+func ossDenyStatement(bucket string, principals, prefixes, actions, sourceIps []string) map[string]interface{} {
+	if len(principals) == 0 {
+		principals = []string{"*"}
+	}
+	var resources []string
+	if len(prefixes) == 0 {
+		resources = []string{"acs:oss:*:*:" + bucket, "acs:oss:*:*:" + bucket + "/*"}
+	} else {
+		for _, prefix := range prefixes {
+			resources = append(resources, "acs:oss:*:*:"+bucket+"/"+strings.TrimPrefix(prefix, "/")+"*")
+		}
+	}
+	statement := map[string]interface{}{
+		"Effect":    "Deny",
+		"Action":    actions,
+		"Principal": principals,
+		"Resource":  resources,
+	}
+	if len(sourceIps) > 0 {
+		statement["Condition"] = map[string]interface{}{
+			"IpAddress": map[string]interface{}{
+				"acs:SourceIp": sourceIps,
+			},
+		}
+	}
+	return statement
+}
+
+// merge the deny statement into the bucket policy, a new policy is created if policy is empty
+func mergeOssPolicy(policy string, statement map[string]interface{}) (string, error) {
+	document := map[string]interface{}{
+		"Version": "1",
+	}
+	if policy != "" {
+		if err := json.Unmarshal([]byte(policy), &document); err != nil {
+			return "", err
+		}
+	}
+	statements, _ := document["Statement"].([]interface{})
+	document["Statement"] = append(statements, statement)
+	bytes, err := json.Marshal(document)
+	return string(bytes), err
+}
+
+// is the error of oss caused by the configuration not found
+func isOssNotFound(err error) bool {
+	serviceError, ok := err.(oss.ServiceError)
+	return ok && serviceError.StatusCode == http.StatusNotFound
+}
+
+// install the deny bucket policy, the previous policy is saved for destroy
+func denyOssBucket(ctx context.Context, uid, accessKeyId, accessKeySecret, endpoint, bucket string, principals, prefixes, actions, sourceIps []string) *spec.Response {
+	client, _err := oss.New(endpoint, accessKeyId, accessKeySecret)
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun oss client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aliyun oss client failed")
+	}
+
+	record := ossRecord{Bucket: bucket, HasPolicy: true}
+	record.Policy, _err = client.GetBucketPolicy(bucket)
+	if _err != nil {
+		if !isOssNotFound(_err) {
+			log.Errorf(ctx, "get aliyun oss bucket policy failed, err: %s", _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "get aliyun oss bucket policy failed")
+		}
+		record.HasPolicy = false
+	}
+	policy, _err := mergeOssPolicy(record.Policy, ossDenyStatement(bucket, principals, prefixes, actions, sourceIps))
+	if _err != nil {
+		log.Errorf(ctx, "merge aliyun oss bucket policy failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "merge aliyun oss bucket policy failed")
+	}
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	_err = client.SetBucketPolicy(bucket, policy)
+	if _err != nil {
+		log.Errorf(ctx, "set aliyun oss bucket policy failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "set aliyun oss bucket policy failed")
+	}
+	return spec.Success()
+}
+
+// restore the bucket policy saved by denyOssBucket
+func restoreOssBucketPolicy(ctx context.Context, uid, accessKeyId, accessKeySecret, endpoint string) *spec.Response {
+	var record ossRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	client, _err := oss.New(endpoint, accessKeyId, accessKeySecret)
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun oss client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aliyun oss client failed")
+	}
+
+	if record.HasPolicy {
+		_err = client.SetBucketPolicy(record.Bucket, record.Policy)
+	} else {
+		_err = client.DeleteBucketPolicy(record.Bucket)
+	}
+	if _err != nil {
+		log.Errorf(ctx, "restore aliyun oss bucket policy failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "restore aliyun oss bucket policy failed")
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return spec.Success()
+}
+
+// block the referers of bucket, the previous referer configuration is saved for destroy
+func blockOssReferers(ctx context.Context, uid, accessKeyId, accessKeySecret, endpoint, bucket string, referers []string) *spec.Response {
+	client, _err := oss.New(endpoint, accessKeyId, accessKeySecret)
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun oss client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aliyun oss client failed")
+	}
+
+	referer, _err := client.GetBucketRefererXml(bucket)
+	if _err != nil {
+		log.Errorf(ctx, "get aliyun oss bucket referer failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "get aliyun oss bucket referer failed")
+	}
+	var configuration oss.RefererXML
+	if _err = xml.Unmarshal([]byte(referer), &configuration); _err != nil {
+		log.Errorf(ctx, "parse aliyun oss bucket referer failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "parse aliyun oss bucket referer failed")
+	}
+	if configuration.RefererBlacklist == nil {
+		configuration.RefererBlacklist = &oss.RefererBlacklist{}
+	}
+	configuration.RefererBlacklist.Referer = append(configuration.RefererBlacklist.Referer, referers...)
+	if _err = exec.SaveRecord(uid, ossRecord{Bucket: bucket, Referer: referer}); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	_err = client.SetBucketRefererV2(bucket, configuration)
+	if _err != nil {
+		log.Errorf(ctx, "set aliyun oss bucket referer failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "set aliyun oss bucket referer failed")
+	}
+	return spec.Success()
+}
+
+// restore the referer configuration saved by blockOssReferers
+func restoreOssReferer(ctx context.Context, uid, accessKeyId, accessKeySecret, endpoint string) *spec.Response {
+	var record ossRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	var configuration oss.RefererXML
+	if _err = xml.Unmarshal([]byte(record.Referer), &configuration); _err != nil {
+		log.Errorf(ctx, "parse aliyun oss bucket referer failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "parse aliyun oss bucket referer failed")
+	}
+	client, _err := oss.New(endpoint, accessKeyId, accessKeySecret)
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun oss client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aliyun oss client failed")
+	}
+
+	_err = client.SetBucketRefererV2(record.Bucket, configuration)
+	if _err != nil {
+		log.Errorf(ctx, "restore aliyun oss bucket referer failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "restore aliyun oss bucket referer failed")
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return spec.Success()
+}
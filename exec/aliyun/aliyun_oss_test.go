@@ -0,0 +1,144 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aliyun
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+// fakeOss is a local oss stand-in which keeps the policy and referer configuration of buckets
+type fakeOss struct {
+	sync.Mutex
+	policies map[string]string
+	referers map[string]string
+}
+
+func newFakeOss() *fakeOss {
+	return &fakeOss{policies: map[string]string{}, referers: map[string]string{}}
+}
+
+func (f *fakeOss) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	bucket := r.URL.Path[1:]
+	if len(bucket) > 0 && bucket[len(bucket)-1] == '/' {
+		bucket = bucket[:len(bucket)-1]
+	}
+	query := r.URL.Query()
+	configurations := f.policies
+	if _, ok := query["referer"]; ok {
+		configurations = f.referers
+	} else if _, ok := query["policy"]; !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		configuration, ok := configurations[bucket]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchBucketPolicy</Code><Message>The bucket policy does not exist</Message></Error>`)
+			return
+		}
+		io.WriteString(w, configuration)
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		configurations[bucket] = string(body)
+	case http.MethodDelete:
+		delete(configurations, bucket)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestAliyunOssDenyAndRestore(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	fake := newFakeOss()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	original := `{"Version":"1","Statement":[{"Effect":"Allow","Action":["oss:GetObject"],"Principal":["123"],"Resource":["acs:oss:*:*:bucket/*"]}]}`
+	fake.policies["bucket"] = original
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := denyOssBucket(ctx, "123", "accessKeyId", "accessKeySecret", server.URL, "bucket", nil, []string{"logs/"}, []string{"oss:GetObject"}, []string{"10.0.0.0/8"})
+	assert.True(t, result.Success, result.Err)
+	var document struct {
+		Statement []map[string]interface{}
+	}
+	assert.Nil(t, json.Unmarshal([]byte(fake.policies["bucket"]), &document))
+	assert.Len(t, document.Statement, 2)
+	assert.Equal(t, "Deny", document.Statement[1]["Effect"], "they should be equal")
+	assert.Equal(t, []interface{}{"acs:oss:*:*:bucket/logs/*"}, document.Statement[1]["Resource"], "they should be equal")
+
+	result = restoreOssBucketPolicy(ctx, "123", "accessKeyId", "accessKeySecret", server.URL)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, original, fake.policies["bucket"], "they should be equal")
+}
+
+func TestAliyunOssDenyWithoutPolicy(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	fake := newFakeOss()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := denyOssBucket(ctx, "123", "accessKeyId", "accessKeySecret", server.URL, "bucket", nil, nil, []string{"oss:*"}, nil)
+	assert.True(t, result.Success, result.Err)
+	assert.Contains(t, fake.policies["bucket"], `"Effect":"Deny"`)
+
+	result = restoreOssBucketPolicy(ctx, "123", "accessKeyId", "accessKeySecret", server.URL)
+	assert.True(t, result.Success, result.Err)
+	_, ok := fake.policies["bucket"]
+	assert.False(t, ok)
+}
+
+func TestAliyunOssRefererBlockAndRestore(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	fake := newFakeOss()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	fake.referers["bucket"] = `<?xml version="1.0" encoding="UTF-8"?><RefererConfiguration><AllowEmptyReferer>true</AllowEmptyReferer><RefererList></RefererList></RefererConfiguration>`
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := blockOssReferers(ctx, "123", "accessKeyId", "accessKeySecret", server.URL, "bucket", []string{"http://www.example.com"})
+	assert.True(t, result.Success, result.Err)
+	assert.Contains(t, fake.referers["bucket"], "<RefererBlacklist><Referer>http://www.example.com</Referer></RefererBlacklist>")
+
+	result = restoreOssReferer(ctx, "123", "accessKeyId", "accessKeySecret", server.URL)
+	assert.True(t, result.Success, result.Err)
+	assert.NotContains(t, fake.referers["bucket"], "RefererBlacklist")
+}
+
+func TestAliyunOssRestoreWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := restoreOssBucketPolicy(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "http://127.0.0.1:1")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
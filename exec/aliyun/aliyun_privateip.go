@@ -18,7 +18,10 @@ package aliyun
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
 	"os"
+	"strconv"
 	"strings"
 
 	ecs20140526 "github.com/alibabacloud-go/ecs-20140526/v4/client"
@@ -57,19 +60,41 @@ func NewPrivateIpActionSpec() spec.ExpActionCommandSpec {
 					Name: "networkInterfaceId",
 					Desc: "the networkInterfaceId",
 				},
+				&spec.ExpFlag{
+					Name: "instanceId",
+					Desc: "the instanceId, the secondary private ips of all networkInterfaces attached to it are targeted",
+				},
+				&spec.ExpFlag{
+					Name: "tagKey",
+					Desc: "the tag key of the networkInterfaces to target",
+				},
+				&spec.ExpFlag{
+					Name: "tagValue",
+					Desc: "the tag value of the networkInterfaces to target, used with tagKey",
+				},
 				&spec.ExpFlag{
 					Name: "regionId",
 					Desc: "the regionId of aliyun",
 				},
 				&spec.ExpFlag{
 					Name: "privateIpAddress",
-					Desc: "the PrivateIpAddress",
+					Desc: "the PrivateIpAddress, split by comma, if not provided, all secondary private ips of the target networkInterfaces",
+				},
+				&spec.ExpFlag{
+					Name: "count",
+					Desc: "the count of private ips randomly chosen from the targets to unassign, if not provided, all of them",
 				},
 			},
 			ActionExecutor: &PrivateIpExecutor{},
 			ActionExample: `
 # unassociate private ip from networkInterfaceId n-x which privateIpAddress is 1.1.1.1,2.2.2.2
-blade create aliyun privateIp --accessKeyId xxx --accessKeySecret yyy --type unassign --regionId cn-qingdao --networkInterfaceId n-x --privateIpAddress 1.1.1.1,2.2.2.2`,
+blade create aliyun privateIp --accessKeyId xxx --accessKeySecret yyy --type unassign --regionId cn-qingdao --networkInterfaceId n-x --privateIpAddress 1.1.1.1,2.2.2.2
+
+# unassociate all secondary private ips of the networkInterfaces attached to instance i-x
+blade create aliyun privateIp --accessKeyId xxx --accessKeySecret yyy --type unassign --regionId cn-qingdao --instanceId i-x
+
+# unassociate 2 random secondary private ips of the networkInterfaces which tag env is test
+blade create aliyun privateIp --accessKeyId xxx --accessKeySecret yyy --type unassign --regionId cn-qingdao --tagKey env --tagValue test --count 2`,
 			ActionPrograms:   []string{PrivateIpBin},
 			ActionCategories: []string{category.Cloud + "_" + category.Aliyun + "_" + category.PrivateIp},
 		},
@@ -92,7 +117,7 @@ func (b *PrivateIpActionSpec) LongDesc() string {
 	if b.ActionLongDesc != "" {
 		return b.ActionLongDesc
 	}
-	return "do some aliyun private ip Operations, like unassign"
+	return "do some aliyun private ip Operations, like unassign. The unassigned private ips are recorded and assigned back to the same networkInterfaces on destroy"
 }
 
 type PrivateIpExecutor struct {
@@ -103,6 +128,13 @@ func (*PrivateIpExecutor) Name() string {
 	return "privateIp"
 }
 
+// privateIpRecord is the private ips unassigned from one networkInterface
+type privateIpRecord struct {
+	VpcId              string   `json:"vpcId"`
+	NetworkInterfaceId string   `json:"networkInterfaceId"`
+	PrivateIpAddress   []string `json:"privateIpAddress"`
+}
+
 func (be *PrivateIpExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
 	if be.channel == nil {
 		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
@@ -113,7 +145,11 @@ func (be *PrivateIpExecutor) Exec(uid string, ctx context.Context, model *spec.E
 	operationType := model.ActionFlags["type"]
 	regionId := model.ActionFlags["regionId"]
 	networkInterfaceId := model.ActionFlags["networkInterfaceId"]
+	instanceId := model.ActionFlags["instanceId"]
+	tagKey := model.ActionFlags["tagKey"]
+	tagValue := model.ActionFlags["tagValue"]
 	privateIpAddress := model.ActionFlags["privateIpAddress"]
+	countStr := model.ActionFlags["count"]
 
 	if accessKeyId == "" {
 		val, ok := os.LookupEnv("ACCESS_KEY_ID")
@@ -138,9 +174,9 @@ func (be *PrivateIpExecutor) Exec(uid string, ctx context.Context, model *spec.E
 		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
 	}
 
-	if networkInterfaceId == "" {
-		log.Errorf(ctx, "networkInterfaceId is required!")
-		return spec.ResponseFailWithFlags(spec.ParameterLess, "networkInterfaceId")
+	if networkInterfaceId == "" && instanceId == "" && tagKey == "" {
+		log.Errorf(ctx, "networkInterfaceId, instanceId or tagKey is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "networkInterfaceId|instanceId|tagKey")
 	}
 
 	if operationType == "" {
@@ -148,49 +184,192 @@ func (be *PrivateIpExecutor) Exec(uid string, ctx context.Context, model *spec.E
 		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
 	}
 
-	if privateIpAddress == "" {
-		log.Errorf(ctx, "privateIpAddress is required!")
-		return spec.ResponseFailWithFlags(spec.ParameterLess, "privateIpAddress")
+	var privateIpAddressArray []string
+	if privateIpAddress != "" {
+		privateIpAddressArray = strings.Split(privateIpAddress, ",")
 	}
-	privateIpAddressArray := strings.Split(privateIpAddress, ",")
 
-	networkInterfaceAttributeStatusMap, _err := describeNetworkInterfaceAttributeStatus(ctx, accessKeyId, accessKeySecret, regionId, networkInterfaceId)
-	if _err != nil {
-		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe networkInterface status failed")
-	}
-	for _, privateIpAddressItem := range privateIpAddressArray {
-		if networkInterfaceAttributeStatusMap[privateIpAddressItem] != "InUse" && operationType == "unassign" {
-			return be.stop(ctx, operationType, accessKeyId, accessKeySecret, regionId, networkInterfaceId, privateIpAddressArray)
+	count := 0
+	if countStr != "" {
+		var err error
+		count, err = strconv.Atoi(countStr)
+		if err != nil || count <= 0 {
+			log.Errorf(ctx, "count %s is illegal, it must be a positive integer", countStr)
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "count", countStr, "it must be a positive integer")
 		}
 	}
-	return be.start(ctx, operationType, accessKeyId, accessKeySecret, regionId, networkInterfaceId, privateIpAddressArray)
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, networkInterfaceId, privateIpAddressArray)
+	}
+	return be.start(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, networkInterfaceId, instanceId, tagKey, tagValue, privateIpAddressArray, count)
 }
 
-func (be *PrivateIpExecutor) start(ctx context.Context, operationType, accessKeyId, accessKeySecret, regionId, networkInterfaceId string, privateIpAddressArray []string) *spec.Response {
+func (be *PrivateIpExecutor) start(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId, networkInterfaceId, instanceId, tagKey, tagValue string, privateIpAddressArray []string, count int) *spec.Response {
 	switch operationType {
 	case "unassign":
-		return unassignPrivateIpAddress(ctx, accessKeyId, accessKeySecret, regionId, networkInterfaceId, privateIpAddressArray)
+		records, _err := describeSecondaryPrivateIps(ctx, accessKeyId, accessKeySecret, regionId, networkInterfaceId, instanceId, tagKey, tagValue)
+		if _err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe networkInterfaces failed")
+		}
+		if len(privateIpAddressArray) > 0 {
+			records = filterPrivateIps(records, privateIpAddressArray)
+		}
+		records = pickPrivateIps(records, count)
+		if len(records) == 0 {
+			log.Errorf(ctx, "no secondary private ip found in the target networkInterfaces")
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "privateIpAddress", strings.Join(privateIpAddressArray, ","), "no secondary private ip found")
+		}
+		return unassignPrivateIpRecords(ctx, uid, accessKeyId, accessKeySecret, regionId, records)
 	default:
 		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support unassign)")
 	}
-	select {}
 }
 
-func (be *PrivateIpExecutor) stop(ctx context.Context, operationType, accessKeyId, accessKeySecret, regionId, networkInterfaceId string, privateIpAddressArray []string) *spec.Response {
+func (be *PrivateIpExecutor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId, networkInterfaceId string, privateIpAddressArray []string) *spec.Response {
 	switch operationType {
 	case "unassign":
-		return assignPrivateIpAddress(ctx, accessKeyId, accessKeySecret, regionId, networkInterfaceId, privateIpAddressArray)
+		var records []privateIpRecord
+		exist, _err := exec.LoadRecord(uid, &records)
+		if _err != nil {
+			log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+			return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+		}
+		if !exist {
+			// the experiment was created without record, assign the private ips in the flags back
+			if networkInterfaceId == "" || len(privateIpAddressArray) == 0 {
+				return spec.ResponseFailWithFlags(spec.ParameterLess, "networkInterfaceId|privateIpAddress")
+			}
+			return assignPrivateIpAddress(ctx, accessKeyId, accessKeySecret, regionId, networkInterfaceId, privateIpAddressArray)
+		}
+		response := assignPrivateIpRecords(ctx, accessKeyId, accessKeySecret, regionId, records)
+		if !response.Success {
+			return response
+		}
+		if _err = exec.RemoveRecord(uid); _err != nil {
+			log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+		}
+		return response
 	default:
 		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support unassign)")
 	}
-	ctx = context.WithValue(ctx, "bin", PrivateIpBin)
-	return exec.Destroy(ctx, be.channel, "aliyun private Ip")
 }
 
 func (be *PrivateIpExecutor) SetChannel(channel spec.Channel) {
 	be.channel = channel
 }
 
+// unassign the private ips of records and save them for destroy, the private ips unassigned already are assigned back
+// if any of them fails, as the failed experiment is never destroyed
+func unassignPrivateIpRecords(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId string, records []privateIpRecord) *spec.Response {
+	unassigned := make([]privateIpRecord, 0, len(records))
+	for _, record := range records {
+		response := unassignPrivateIpAddress(ctx, accessKeyId, accessKeySecret, regionId, record.NetworkInterfaceId, record.PrivateIpAddress)
+		if !response.Success {
+			if len(unassigned) > 0 {
+				if rollback := assignPrivateIpRecords(ctx, accessKeyId, accessKeySecret, regionId, unassigned); !rollback.Success {
+					// keep the record to assign them back by destroy
+					log.Errorf(ctx, "assign the unassigned private ips %v back failed, err: %s", unassigned, rollback.Err)
+					if _err := exec.SaveRecord(uid, unassigned); _err != nil {
+						log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+					}
+				}
+			}
+			return response
+		}
+		unassigned = append(unassigned, record)
+	}
+	if _err := exec.SaveRecord(uid, unassigned); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	return spec.Success()
+}
+
+// assign the private ips of records back to their networkInterfaces, fail if any of them is reallocated
+func assignPrivateIpRecords(ctx context.Context, accessKeyId, accessKeySecret, regionId string, records []privateIpRecord) *spec.Response {
+	for _, record := range records {
+		var privateIps []string
+		for _, ip := range record.PrivateIpAddress {
+			owner, _err := describePrivateIpOwner(ctx, accessKeyId, accessKeySecret, regionId, record.VpcId, ip)
+			if _err != nil {
+				return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe private ip owner failed")
+			}
+			if owner == record.NetworkInterfaceId {
+				continue
+			}
+			if owner != "" {
+				log.Errorf(ctx, "private ip %s has been reallocated to networkInterface %s, could not assign it back to %s", ip, owner, record.NetworkInterfaceId)
+				return spec.ResponseFailWithFlags(spec.ParameterInvalid, "privateIpAddress", ip,
+					fmt.Sprintf("it has been reallocated to networkInterface %s", owner))
+			}
+			privateIps = append(privateIps, ip)
+		}
+		if len(privateIps) == 0 {
+			continue
+		}
+		response := assignPrivateIpAddress(ctx, accessKeyId, accessKeySecret, regionId, record.NetworkInterfaceId, privateIps)
+		if !response.Success {
+			return response
+		}
+	}
+	return spec.Success()
+}
+
+// keep the private ips in privateIpAddress only
+func filterPrivateIps(records []privateIpRecord, privateIpAddress []string) []privateIpRecord {
+	wanted := make(map[string]bool, len(privateIpAddress))
+	for _, ip := range privateIpAddress {
+		wanted[strings.TrimSpace(ip)] = true
+	}
+	result := make([]privateIpRecord, 0, len(records))
+	for _, record := range records {
+		var ips []string
+		for _, ip := range record.PrivateIpAddress {
+			if wanted[ip] {
+				ips = append(ips, ip)
+			}
+		}
+		if len(ips) > 0 {
+			record.PrivateIpAddress = ips
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+// pick count private ips from records randomly, all of them if count is not positive
+func pickPrivateIps(records []privateIpRecord, count int) []privateIpRecord {
+	type candidate struct {
+		index int
+		ip    string
+	}
+	var candidates []candidate
+	for i, record := range records {
+		for _, ip := range record.PrivateIpAddress {
+			candidates = append(candidates, candidate{i, ip})
+		}
+	}
+	if count <= 0 || count >= len(candidates) {
+		return records
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	picked := make([][]string, len(records))
+	for _, c := range candidates[:count] {
+		picked[c.index] = append(picked[c.index], c.ip)
+	}
+	result := make([]privateIpRecord, 0, len(records))
+	for i, record := range records {
+		if len(picked[i]) > 0 {
+			record.PrivateIpAddress = picked[i]
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
 // unassign Private Ip
 func unassignPrivateIpAddress(ctx context.Context, accessKeyId, accessKeySecret, regionId, networkInterfaceId string, privateIpAddress []string) *spec.Response {
 	client, _err := CreateClient(tea.String(accessKeyId), tea.String(accessKeySecret), regionId)
@@ -254,3 +433,84 @@ func describeNetworkInterfaceAttributeStatus(ctx context.Context, accessKeyId, a
 	_result = statusMap
 	return _result, _err
 }
+
+// describe the secondary private ips of the networkInterfaces found by id, instance or tag
+func describeSecondaryPrivateIps(ctx context.Context, accessKeyId, accessKeySecret, regionId, networkInterfaceId, instanceId, tagKey, tagValue string) (_result []privateIpRecord, _err error) {
+	client, _err := CreateClient(tea.String(accessKeyId), tea.String(accessKeySecret), regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun client failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	describeNetworkInterfacesRequest := &ecs20140526.DescribeNetworkInterfacesRequest{
+		RegionId:   tea.String(regionId),
+		MaxResults: tea.Int32(100),
+	}
+	if networkInterfaceId != "" {
+		describeNetworkInterfacesRequest.NetworkInterfaceId = tea.StringSlice([]string{networkInterfaceId})
+	}
+	if instanceId != "" {
+		// only the secondary networkInterfaces of the instance are targeted, the primary one is kept
+		describeNetworkInterfacesRequest.InstanceId = tea.String(instanceId)
+		describeNetworkInterfacesRequest.Type = tea.String("Secondary")
+	}
+	if tagKey != "" {
+		tag := &ecs20140526.DescribeNetworkInterfacesRequestTag{Key: tea.String(tagKey)}
+		if tagValue != "" {
+			tag.Value = tea.String(tagValue)
+		}
+		describeNetworkInterfacesRequest.Tag = []*ecs20140526.DescribeNetworkInterfacesRequestTag{tag}
+	}
+	for {
+		response, _err := client.DescribeNetworkInterfaces(describeNetworkInterfacesRequest)
+		if _err != nil {
+			log.Errorf(ctx, "describe aliyun networkInterfaces failed, err: %s", _err.Error())
+			return _result, _err
+		}
+		for _, networkInterface := range response.Body.NetworkInterfaceSets.NetworkInterfaceSet {
+			record := privateIpRecord{
+				VpcId:              tea.StringValue(networkInterface.VpcId),
+				NetworkInterfaceId: tea.StringValue(networkInterface.NetworkInterfaceId),
+			}
+			if networkInterface.PrivateIpSets != nil {
+				for _, privateIpSet := range networkInterface.PrivateIpSets.PrivateIpSet {
+					if !tea.BoolValue(privateIpSet.Primary) {
+						record.PrivateIpAddress = append(record.PrivateIpAddress, tea.StringValue(privateIpSet.PrivateIpAddress))
+					}
+				}
+			}
+			if len(record.PrivateIpAddress) > 0 {
+				_result = append(_result, record)
+			}
+		}
+		if tea.StringValue(response.Body.NextToken) == "" {
+			break
+		}
+		describeNetworkInterfacesRequest.NextToken = response.Body.NextToken
+	}
+	return _result, _err
+}
+
+// describe the networkInterface which the private ip is assigned to, empty if it is not assigned
+func describePrivateIpOwner(ctx context.Context, accessKeyId, accessKeySecret, regionId, vpcId, privateIpAddress string) (_result string, _err error) {
+	client, _err := CreateClient(tea.String(accessKeyId), tea.String(accessKeySecret), regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun client failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	describeNetworkInterfacesRequest := &ecs20140526.DescribeNetworkInterfacesRequest{
+		RegionId:         tea.String(regionId),
+		PrivateIpAddress: tea.StringSlice([]string{privateIpAddress}),
+	}
+	if vpcId != "" {
+		describeNetworkInterfacesRequest.VpcId = tea.String(vpcId)
+	}
+	response, _err := client.DescribeNetworkInterfaces(describeNetworkInterfacesRequest)
+	if _err != nil {
+		log.Errorf(ctx, "describe aliyun networkInterfaces of private ip %s failed, err: %s", privateIpAddress, _err.Error())
+		return _result, _err
+	}
+	for _, networkInterface := range response.Body.NetworkInterfaceSets.NetworkInterfaceSet {
+		_result = tea.StringValue(networkInterface.NetworkInterfaceId)
+	}
+	return _result, _err
+}
@@ -37,3 +37,35 @@ func TestAliyunNetworkInterfaceAttributeDescribe(t *testing.T) {
 	_, _err := describeNetworkInterfaceAttributeStatus(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "regionId", "networkInterfaceId")
 	assert.NotNil(t, _err, "they should be equal")
 }
+
+func TestAliyunSecondaryPrivateIpsDescribe(t *testing.T) {
+	_, _err := describeSecondaryPrivateIps(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "regionId", "", "i-x", "", "")
+	assert.NotNil(t, _err, "they should be equal")
+}
+
+func TestAliyunPrivateIpOwnerDescribe(t *testing.T) {
+	_, _err := describePrivateIpOwner(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "regionId", "vpc-x", "1.1.1.1")
+	assert.NotNil(t, _err, "they should be equal")
+}
+
+func TestAliyunPrivateIpFilter(t *testing.T) {
+	records := []privateIpRecord{
+		{NetworkInterfaceId: "eni-x", PrivateIpAddress: []string{"1.1.1.1", "2.2.2.2"}},
+		{NetworkInterfaceId: "eni-y", PrivateIpAddress: []string{"3.3.3.3"}},
+	}
+	result := filterPrivateIps(records, []string{"2.2.2.2"})
+	assert.Equal(t, []privateIpRecord{{NetworkInterfaceId: "eni-x", PrivateIpAddress: []string{"2.2.2.2"}}}, result, "they should be equal")
+}
+
+func TestAliyunPrivateIpPick(t *testing.T) {
+	records := []privateIpRecord{
+		{NetworkInterfaceId: "eni-x", PrivateIpAddress: []string{"1.1.1.1", "2.2.2.2"}},
+		{NetworkInterfaceId: "eni-y", PrivateIpAddress: []string{"3.3.3.3"}},
+	}
+	assert.Equal(t, records, pickPrivateIps(records, 0), "they should be equal")
+	picked := 0
+	for _, record := range pickPrivateIps(records, 2) {
+		picked += len(record.PrivateIpAddress)
+	}
+	assert.Equal(t, 2, picked, "they should be equal")
+}
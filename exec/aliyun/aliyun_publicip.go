@@ -19,6 +19,7 @@ package aliyun
 import (
 	"context"
 	"os"
+	"strconv"
 
 	ecs20140526 "github.com/alibabacloud-go/ecs-20140526/v4/client"
 	"github.com/alibabacloud-go/tea/tea"
@@ -50,7 +51,7 @@ func NewPublicIpActionSpec() spec.ExpActionCommandSpec {
 				},
 				&spec.ExpFlag{
 					Name: "type",
-					Desc: "the operation of PublicIp, support release, unassociate, etc",
+					Desc: "the operation of PublicIp, support release, unassociate, throttle, etc",
 				},
 				&spec.ExpFlag{
 					Name: "allocationId",
@@ -64,6 +65,10 @@ func NewPublicIpActionSpec() spec.ExpActionCommandSpec {
 					Name: "publicIpAddress",
 					Desc: "the PublicIpAddress",
 				},
+				&spec.ExpFlag{
+					Name: "bandwidth",
+					Desc: "the peak bandwidth of the eip in Mbps when operationType is throttle, the original value is restored on destroy",
+				},
 			},
 			ActionExecutor: &PublicIpExecutor{},
 			ActionExample: `
@@ -71,7 +76,10 @@ func NewPublicIpActionSpec() spec.ExpActionCommandSpec {
 blade create aliyun publicIp --accessKeyId xxx --accessKeySecret yyy --type release --publicIpAddress 1.1.1.1
 
 # unassociate publicIp from instance i-x which allocationId id is a-x
-blade create aliyun publicIp --accessKeyId xxx --accessKeySecret yyy --type unassociate --instanceId i-x --allocationId a-x`,
+blade create aliyun publicIp --accessKeyId xxx --accessKeySecret yyy --type unassociate --instanceId i-x --allocationId a-x
+
+# throttle the bandwidth of eip which allocationId id is a-x to 1 Mbps
+blade create aliyun publicIp --accessKeyId xxx --accessKeySecret yyy --regionId cn-qingdao --type throttle --allocationId a-x --bandwidth 1`,
 			ActionPrograms:   []string{PublicIpBin},
 			ActionCategories: []string{category.Cloud + "_" + category.Aliyun + "_" + category.PublicIp},
 		},
@@ -87,14 +95,14 @@ func (*PublicIpActionSpec) Aliases() []string {
 }
 
 func (*PublicIpActionSpec) ShortDesc() string {
-	return "do some aliyun publicIp Operations, like release, unassociate"
+	return "do some aliyun publicIp Operations, like release, unassociate, throttle"
 }
 
 func (b *PublicIpActionSpec) LongDesc() string {
 	if b.ActionLongDesc != "" {
 		return b.ActionLongDesc
 	}
-	return "do some aliyun publicIp Operations, like release, unassociate"
+	return "do some aliyun publicIp Operations, like release, unassociate, throttle"
 }
 
 type PublicIpExecutor struct {
@@ -117,6 +125,7 @@ func (be *PublicIpExecutor) Exec(uid string, ctx context.Context, model *spec.Ex
 	instanceId := model.ActionFlags["instanceId"]
 	allocationId := model.ActionFlags["allocationId"]
 	publicIpAddress := model.ActionFlags["publicIpAddress"]
+	bandwidth := model.ActionFlags["bandwidth"]
 
 	if accessKeyId == "" {
 		val, ok := os.LookupEnv("ACCESS_KEY_ID")
@@ -156,6 +165,25 @@ func (be *PublicIpExecutor) Exec(uid string, ctx context.Context, model *spec.Ex
 		return spec.ResponseFailWithFlags(spec.ParameterLess, "instanceId")
 	}
 
+	if operationType == "throttle" && allocationId == "" && publicIpAddress == "" {
+		log.Errorf(ctx, "allocationId or publicIpAddress is required when operationType is throttle!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "allocationId|publicIpAddress")
+	}
+
+	if operationType == "throttle" {
+		if _, ok := spec.IsDestroy(ctx); ok {
+			return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, allocationId, instanceId, publicIpAddress, bandwidth)
+		}
+		if bandwidth == "" {
+			log.Errorf(ctx, "bandwidth is required when operationType is throttle!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "bandwidth")
+		}
+		if value, err := strconv.Atoi(bandwidth); err != nil || value <= 0 {
+			log.Errorf(ctx, "bandwidth %s is illegal, it must be a positive integer", bandwidth)
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "bandwidth", bandwidth, "it must be a positive integer")
+		}
+	}
+
 	if operationType == "release" || operationType == "associate" {
 		ipStatusMap, _err := describeInstances(ctx, accessKeyId, accessKeySecret, regionId, instanceId)
 		if _err != nil {
@@ -168,7 +196,7 @@ func (be *PublicIpExecutor) Exec(uid string, ctx context.Context, model *spec.Ex
 			}
 		}
 		if (!isExist && operationType == "release") || (isExist && operationType == "associate") {
-			return be.stop(ctx, operationType, accessKeyId, accessKeySecret, regionId, allocationId, instanceId, publicIpAddress)
+			return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, allocationId, instanceId, publicIpAddress, bandwidth)
 		}
 	}
 
@@ -177,14 +205,18 @@ func (be *PublicIpExecutor) Exec(uid string, ctx context.Context, model *spec.Ex
 		if _err != nil {
 			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe eip status failed")
 		}
-		if (eipStatusMap[publicIpAddress] != "InUse" && operationType == "unassociateEip") || (eipStatusMap[publicIpAddress] == "InUse" && operationType == "associateEip") {
-			return be.stop(ctx, operationType, accessKeyId, accessKeySecret, regionId, allocationId, instanceId, publicIpAddress)
+		eipStatus := ""
+		if eipAddress, ok := eipStatusMap[publicIpAddress]; ok {
+			eipStatus = tea.StringValue(eipAddress.Status)
+		}
+		if (eipStatus != "InUse" && operationType == "unassociateEip") || (eipStatus == "InUse" && operationType == "associateEip") {
+			return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, allocationId, instanceId, publicIpAddress, bandwidth)
 		}
 	}
-	return be.start(ctx, operationType, accessKeyId, accessKeySecret, regionId, allocationId, instanceId, publicIpAddress)
+	return be.start(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, allocationId, instanceId, publicIpAddress, bandwidth)
 }
 
-func (be *PublicIpExecutor) start(ctx context.Context, operationType, accessKeyId, accessKeySecret, regionId, allocationId, instanceId, publicIpAddress string) *spec.Response {
+func (be *PublicIpExecutor) start(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId, allocationId, instanceId, publicIpAddress, bandwidth string) *spec.Response {
 	switch operationType {
 	case "release":
 		return releasePublicIpAddress(ctx, accessKeyId, accessKeySecret, regionId, publicIpAddress, instanceId)
@@ -194,13 +226,15 @@ func (be *PublicIpExecutor) start(ctx context.Context, operationType, accessKeyI
 		return unassociateEipAddress(ctx, accessKeyId, accessKeySecret, regionId, allocationId, instanceId)
 	case "associateEip":
 		return associateEipAddress(ctx, accessKeyId, accessKeySecret, regionId, allocationId, instanceId)
+	case "throttle":
+		return throttleEipBandwidth(ctx, uid, accessKeyId, accessKeySecret, regionId, allocationId, publicIpAddress, bandwidth)
 	default:
-		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support release, associate, unassociateEip, associateEip)")
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support release, associate, unassociateEip, associateEip, throttle)")
 	}
 	select {}
 }
 
-func (be *PublicIpExecutor) stop(ctx context.Context, operationType, accessKeyId, accessKeySecret, regionId, allocationId, instanceId, publicIpAddress string) *spec.Response {
+func (be *PublicIpExecutor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId, allocationId, instanceId, publicIpAddress, bandwidth string) *spec.Response {
 	switch operationType {
 	case "release":
 		return allocatePublicIpAddress(ctx, accessKeyId, accessKeySecret, regionId, publicIpAddress, instanceId)
@@ -210,8 +244,10 @@ func (be *PublicIpExecutor) stop(ctx context.Context, operationType, accessKeyId
 		return associateEipAddress(ctx, accessKeyId, accessKeySecret, regionId, allocationId, instanceId)
 	case "associateEip":
 		return unassociateEipAddress(ctx, accessKeyId, accessKeySecret, regionId, allocationId, instanceId)
+	case "throttle":
+		return restoreEipBandwidth(ctx, uid, accessKeyId, accessKeySecret, regionId)
 	default:
-		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support release, associate, unassociateEip, associateEip)")
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support release, associate, unassociateEip, associateEip, throttle)")
 	}
 	ctx = context.WithValue(ctx, "bin", PublicIpBin)
 	return exec.Destroy(ctx, be.channel, "aliyun public Ip")
@@ -328,17 +364,103 @@ func associateEipAddress(ctx context.Context, accessKeyId, accessKeySecret, regi
 	return spec.Success()
 }
 
-// describe eip addresses status
-func describeEipAddresses(ctx context.Context, accessKeyId, accessKeySecret, regionId, allocationId, eipAddress string) (_result map[string]string, _err error) {
+// eipBandwidthRecord is the original bandwidth of the throttled eip
+type eipBandwidthRecord struct {
+	AllocationId string `json:"allocationId"`
+	Bandwidth    string `json:"bandwidth"`
+}
+
+// throttle the bandwidth of eip, the original bandwidth is saved for destroy
+func throttleEipBandwidth(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId, allocationId, publicIpAddress, bandwidth string) *spec.Response {
+	eipAddressMap, _err := describeEipAddresses(ctx, accessKeyId, accessKeySecret, regionId, allocationId, publicIpAddress)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe eip addresses failed")
+	}
+	if len(eipAddressMap) != 1 {
+		log.Errorf(ctx, "found %d eip addresses by allocationId %s and publicIpAddress %s, expected 1", len(eipAddressMap), allocationId, publicIpAddress)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "allocationId|publicIpAddress", allocationId+"|"+publicIpAddress, "the eip address is not found or not unique")
+	}
+	var record eipBandwidthRecord
+	for _, eipAddress := range eipAddressMap {
+		record = eipBandwidthRecord{
+			AllocationId: tea.StringValue(eipAddress.AllocationId),
+			Bandwidth:    tea.StringValue(eipAddress.Bandwidth),
+		}
+	}
+	original, _err := strconv.Atoi(record.Bandwidth)
+	if _err != nil {
+		log.Errorf(ctx, "parse the bandwidth %s of eip %s failed, err: %s", record.Bandwidth, record.AllocationId, _err.Error())
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "parse eip bandwidth failed")
+	}
+	if value, _ := strconv.Atoi(bandwidth); value >= original {
+		log.Errorf(ctx, "bandwidth %s must be lower than the original bandwidth %s of eip %s", bandwidth, record.Bandwidth, record.AllocationId)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "bandwidth", bandwidth, "it must be lower than the original bandwidth "+record.Bandwidth)
+	}
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	return modifyEipBandwidth(ctx, accessKeyId, accessKeySecret, regionId, record.AllocationId, bandwidth)
+}
+
+// restore the bandwidth of eip saved by throttleEipBandwidth
+func restoreEipBandwidth(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	var record eipBandwidthRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the original eip bandwidth of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	response := modifyEipBandwidth(ctx, accessKeyId, accessKeySecret, regionId, record.AllocationId, record.Bandwidth)
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+// modify Eip bandwidth
+func modifyEipBandwidth(ctx context.Context, accessKeyId, accessKeySecret, regionId, allocationId, bandwidth string) *spec.Response {
 	client, _err := CreateClient(tea.String(accessKeyId), tea.String(accessKeySecret), regionId)
 	if _err != nil {
 		log.Errorf(ctx, "create aliyun client failed, err: %s", _err.Error())
-		return _result, _err
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aliyun client failed")
 	}
-	describeEipAddressesRequest := &ecs20140526.DescribeEipAddressesRequest{
+
+	modifyEipAddressAttributeRequest := &ecs20140526.ModifyEipAddressAttributeRequest{
 		AllocationId: tea.String(allocationId),
+		Bandwidth:    tea.String(bandwidth),
 		RegionId:     tea.String(regionId),
-		EipAddress:   tea.String(eipAddress),
+	}
+	_, _err = client.ModifyEipAddressAttribute(modifyEipAddressAttributeRequest)
+	if _err != nil {
+		log.Errorf(ctx, "modify aliyun Eip bandwidth failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "modify aliyun Eip bandwidth failed")
+	}
+	return spec.Success()
+}
+
+// describe eip addresses, keyed by ip address
+func describeEipAddresses(ctx context.Context, accessKeyId, accessKeySecret, regionId, allocationId, eipAddress string) (_result map[string]*ecs20140526.DescribeEipAddressesResponseBodyEipAddressesEipAddress, _err error) {
+	client, _err := CreateClient(tea.String(accessKeyId), tea.String(accessKeySecret), regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aliyun client failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	describeEipAddressesRequest := &ecs20140526.DescribeEipAddressesRequest{
+		RegionId: tea.String(regionId),
+	}
+	if allocationId != "" {
+		describeEipAddressesRequest.AllocationId = tea.String(allocationId)
+	}
+	if eipAddress != "" {
+		describeEipAddressesRequest.EipAddress = tea.String(eipAddress)
 	}
 	response, _err := client.DescribeEipAddresses(describeEipAddressesRequest)
 	if _err != nil {
@@ -346,9 +468,9 @@ func describeEipAddresses(ctx context.Context, accessKeyId, accessKeySecret, reg
 		return _result, _err
 	}
 	eipAddressStatusList := response.Body.EipAddresses.EipAddress
-	statusMap := map[string]string{}
+	statusMap := map[string]*ecs20140526.DescribeEipAddressesResponseBodyEipAddressesEipAddress{}
 	for _, eipAddressStatus := range eipAddressStatusList {
-		statusMap[*eipAddressStatus.IpAddress] = *eipAddressStatus.Status
+		statusMap[*eipAddressStatus.IpAddress] = eipAddressStatus
 	}
 	_result = statusMap
 	return _result, _err
@@ -21,6 +21,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
 )
 
 func TestAliyunPublicIpRelease(t *testing.T) {
@@ -52,3 +54,22 @@ func TestAliyunDescribeInstances(t *testing.T) {
 	_, _err := describeInstances(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "cn-hangzhou", "i-xx")
 	assert.NotNil(t, _err, "they should be equal")
 }
+
+func TestAliyunModifyEipBandwidth(t *testing.T) {
+	result := modifyEipBandwidth(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "regionId", "allocationId", "1")
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAliyunThrottleEipBandwidth(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := throttleEipBandwidth(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "regionId", "allocationId", "", "1")
+	assert.Equal(t, int32(48000), result.Code, "they should be equal")
+}
+
+func TestAliyunRestoreEipBandwidthWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := restoreEipBandwidth(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "regionId")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
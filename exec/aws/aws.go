@@ -28,13 +28,24 @@ func NewAwsCommandSpec() spec.ExpModelCommandSpec {
 	return &AwsCommandSpec{
 		spec.BaseExpModelCommandSpec{
 			ExpActions: []spec.ExpActionCommandSpec{
-				NewEcsActionSpec(),
+				NewEc2ActionSpec(),
+				NewEbsActionSpec(),
+				NewSecurityGroupActionSpec(),
+				NewEipActionSpec(),
+				NewNetworkInterfaceActionSpec(),
+				NewNetworkAclActionSpec(),
+				NewAsgActionSpec(),
+				NewElbActionSpec(),
+				NewRdsActionSpec(),
+				NewRouteTableActionSpec(),
+				NewS3ActionSpec(),
+				NewLambdaActionSpec(),
+				NewDynamodbActionSpec(),
+				NewRoute53ActionSpec(),
+				NewEcsTaskActionSpec(),
+				NewEksNodeActionSpec(),
 				// NewVSwitchActionSpec(),
-				// NewSecurityGroupActionSpec(),
-				// NewNetworkInterfaceActionSpec(),
-				// NewPublicIpActionSpec(),
 				// NewPrivateIpActionSpec(),
-				// NewDiskActionSpec(),
 			},
 			ExpFlags: []spec.ExpFlagSpec{},
 		},
@@ -50,5 +61,5 @@ func (*AwsCommandSpec) ShortDesc() string {
 }
 
 func (*AwsCommandSpec) LongDesc() string {
-	return "Aws experiment contains ec2"
+	return "Aws experiment contains ec2, ebs, securityGroup, eip, networkInterface, networkAcl, asg, elb, rds, routeTable, s3, lambda, dynamodb, route53, ecsTask, eksNode"
 }
@@ -0,0 +1,412 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const AsgBin = "chaos_aws_asg"
+
+type AsgActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewAsgActionSpec() spec.ExpActionCommandSpec {
+	return &AsgActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of auto scaling group, support terminate, suspend",
+				},
+				&spec.ExpFlag{
+					Name: "groupName",
+					Desc: "the name of auto scaling group",
+				},
+				&spec.ExpFlag{
+					Name: "count",
+					Desc: "the count of in-service instances to terminate when operationType is terminate",
+				},
+				&spec.ExpFlag{
+					Name: "percent",
+					Desc: "the percent of in-service instances to terminate when operationType is terminate, used if count is not provided",
+				},
+				&spec.ExpFlag{
+					Name:    "decrement",
+					Desc:    "decrement the desired capacity when terminating instances, it is restored on destroy, default is false",
+					Default: "false",
+				},
+				&spec.ExpFlag{
+					Name:    "processes",
+					Desc:    "the processes to suspend when operationType is suspend, split by comma, like Launch,Terminate,HealthCheck,ReplaceUnhealthy,AZRebalance,AlarmNotification,ScheduledActions,AddToLoadBalancer,InstanceRefresh",
+					Default: "Launch,HealthCheck",
+				},
+			},
+			ActionExecutor: &AsgExecutor{},
+			ActionExample: `
+# terminate 2 in-service instances of auto scaling group asg-x, the group launches new instances to heal
+blade create aws asg --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type terminate --groupName asg-x --count 2
+
+# terminate 50 percent of the in-service instances of auto scaling group asg-x and decrement the desired capacity
+blade create aws asg --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type terminate --groupName asg-x --percent 50 --decrement true
+
+# suspend the Launch and HealthCheck processes of auto scaling group asg-x
+blade create aws asg --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type suspend --groupName asg-x --processes Launch,HealthCheck`,
+			ActionPrograms:   []string{AsgBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.Asg},
+		},
+	}
+}
+
+func (*AsgActionSpec) Name() string {
+	return "asg"
+}
+
+func (*AsgActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*AsgActionSpec) ShortDesc() string {
+	return "do some aws auto scaling group Operations, like terminate, suspend"
+}
+
+func (b *AsgActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws auto scaling group Operations, like terminate the in-service instances, suspend the processes. " +
+		"The suspended processes are resumed and the decremented desired capacity is restored on destroy"
+}
+
+type AsgExecutor struct {
+	channel spec.Channel
+}
+
+func (*AsgExecutor) Name() string {
+	return "asg"
+}
+
+// asgRecord is the state of auto scaling group changed by the experiment
+type asgRecord struct {
+	OperationType       string   `json:"operationType"`
+	GroupName           string   `json:"groupName"`
+	SuspendedProcesses  []string `json:"suspendedProcesses,omitempty"`
+	TerminatedInstances []string `json:"terminatedInstances,omitempty"`
+	DesiredCapacity     *int32   `json:"desiredCapacity,omitempty"`
+}
+
+func (be *AsgExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	groupName := model.ActionFlags["groupName"]
+	count := model.ActionFlags["count"]
+	percent := model.ActionFlags["percent"]
+	decrement := model.ActionFlags["decrement"] == "true"
+	processes := model.ActionFlags["processes"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if groupName == "" {
+		log.Errorf(ctx, "groupName is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "groupName")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId)
+	}
+
+	countValue, percentValue := 0, 0
+	if operationType == "terminate" {
+		if count == "" && percent == "" {
+			log.Errorf(ctx, "count or percent is required when operationType is terminate!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "count|percent")
+		}
+		var err error
+		if count != "" {
+			if countValue, err = strconv.Atoi(count); err != nil || countValue <= 0 {
+				return spec.ResponseFailWithFlags(spec.ParameterIllegal, "count", count, "it must be a positive integer")
+			}
+		} else if percentValue, err = strconv.Atoi(percent); err != nil || percentValue <= 0 || percentValue > 100 {
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "percent", percent, "it must be in (0, 100]")
+		}
+	}
+	return be.start(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, groupName, countValue, percentValue, decrement, exec.SplitFlag(processes))
+}
+
+func (be *AsgExecutor) start(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId, groupName string, count, percent int, decrement bool, processes []string) *spec.Response {
+	switch operationType {
+	case "terminate", "suspend":
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support terminate, suspend)")
+	}
+	group, _err := describeAutoScalingGroup(ctx, accessKeyId, accessKeySecret, regionId, groupName)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe auto scaling group failed")
+	}
+	record := asgRecord{OperationType: operationType, GroupName: groupName}
+	if operationType == "suspend" {
+		if len(processes) == 0 {
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "processes")
+		}
+		suspended := map[string]bool{}
+		for _, process := range group.SuspendedProcesses {
+			suspended[aws.ToString(process.ProcessName)] = true
+		}
+		// the processes suspended before the experiment are kept suspended on destroy
+		for _, process := range processes {
+			if !suspended[process] {
+				record.SuspendedProcesses = append(record.SuspendedProcesses, process)
+			}
+		}
+		if len(record.SuspendedProcesses) == 0 {
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "processes", strings.Join(processes, ","), "the processes are already suspended")
+		}
+		if _err = exec.SaveRecord(uid, record); _err != nil {
+			log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+			return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+		}
+		return suspendAsgProcesses(ctx, accessKeyId, accessKeySecret, regionId, groupName, record.SuspendedProcesses)
+	}
+
+	var instances []string
+	for _, instance := range group.Instances {
+		if instance.LifecycleState == types.LifecycleStateInService {
+			instances = append(instances, aws.ToString(instance.InstanceId))
+		}
+	}
+	if len(instances) == 0 {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "groupName", groupName, "no in-service instance in the auto scaling group")
+	}
+	if count == 0 {
+		count = exec.PercentCount(len(instances), percent)
+	}
+	record.TerminatedInstances = exec.PickRandomly(instances, count)
+	if decrement {
+		record.DesiredCapacity = group.DesiredCapacity
+	}
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	return terminateAsgInstances(ctx, accessKeyId, accessKeySecret, regionId, record.TerminatedInstances, decrement)
+}
+
+func (be *AsgExecutor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	var record asgRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	if record.OperationType != operationType {
+		log.Errorf(ctx, "the experiment %s is created by type %s, not %s", uid, record.OperationType, operationType)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type", operationType, "it must be the type of the experiment "+record.OperationType)
+	}
+	var response *spec.Response
+	switch operationType {
+	case "suspend":
+		response = resumeAsgProcesses(ctx, accessKeyId, accessKeySecret, regionId, record.GroupName, record.SuspendedProcesses)
+	case "terminate":
+		// the terminated instances are replaced by the group itself
+		response = spec.Success()
+		if record.DesiredCapacity != nil {
+			response = setAsgDesiredCapacity(ctx, accessKeyId, accessKeySecret, regionId, record.GroupName, *record.DesiredCapacity)
+		}
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support terminate, suspend)")
+	}
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *AsgExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// terminate instances in auto scaling group
+func terminateAsgInstances(ctx context.Context, accessKeyId, accessKeySecret, regionId string, instances []string, decrement bool) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := autoscaling.NewFromConfig(cfg)
+
+	for _, instance := range instances {
+		_, _err = client.TerminateInstanceInAutoScalingGroup(context.TODO(), &autoscaling.TerminateInstanceInAutoScalingGroupInput{
+			InstanceId:                     aws.String(instance),
+			ShouldDecrementDesiredCapacity: aws.Bool(decrement),
+		})
+		if _err != nil {
+			log.Errorf(ctx, "terminate aws instance %s in auto scaling group failed, err: %s", instance, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "terminate aws instance in auto scaling group failed")
+		}
+	}
+	return spec.Success()
+}
+
+// set desired capacity of auto scaling group
+func setAsgDesiredCapacity(ctx context.Context, accessKeyId, accessKeySecret, regionId, groupName string, desiredCapacity int32) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := autoscaling.NewFromConfig(cfg)
+
+	_, _err = client.SetDesiredCapacity(context.TODO(), &autoscaling.SetDesiredCapacityInput{
+		AutoScalingGroupName: aws.String(groupName),
+		DesiredCapacity:      aws.Int32(desiredCapacity),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "set desired capacity of aws auto scaling group failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "set desired capacity of aws auto scaling group failed")
+	}
+	return spec.Success()
+}
+
+// suspend processes of auto scaling group
+func suspendAsgProcesses(ctx context.Context, accessKeyId, accessKeySecret, regionId, groupName string, processes []string) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := autoscaling.NewFromConfig(cfg)
+
+	_, _err = client.SuspendProcesses(context.TODO(), &autoscaling.SuspendProcessesInput{
+		AutoScalingGroupName: aws.String(groupName),
+		ScalingProcesses:     processes,
+	})
+	if _err != nil {
+		log.Errorf(ctx, "suspend processes of aws auto scaling group failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "suspend processes of aws auto scaling group failed")
+	}
+	return spec.Success()
+}
+
+// resume processes of auto scaling group
+func resumeAsgProcesses(ctx context.Context, accessKeyId, accessKeySecret, regionId, groupName string, processes []string) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := autoscaling.NewFromConfig(cfg)
+
+	_, _err = client.ResumeProcesses(context.TODO(), &autoscaling.ResumeProcessesInput{
+		AutoScalingGroupName: aws.String(groupName),
+		ScalingProcesses:     processes,
+	})
+	if _err != nil {
+		log.Errorf(ctx, "resume processes of aws auto scaling group failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "resume processes of aws auto scaling group failed")
+	}
+	return spec.Success()
+}
+
+// describe auto scaling group
+func describeAutoScalingGroup(ctx context.Context, accessKeyId, accessKeySecret, regionId, groupName string) (_result *types.AutoScalingGroup, _err error) {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	client := autoscaling.NewFromConfig(cfg)
+
+	resp, _err := client.DescribeAutoScalingGroups(context.TODO(), &autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []string{groupName},
+	})
+	if _err != nil {
+		log.Errorf(ctx, "describe aws auto scaling group failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	if len(resp.AutoScalingGroups) == 0 {
+		_err = fmt.Errorf("auto scaling group %s not found", groupName)
+		log.Errorf(ctx, "describe aws auto scaling group failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	_result = &resp.AutoScalingGroups[0]
+	return _result, _err
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+func TestAwsAsgTerminate(t *testing.T) {
+	result := terminateAsgInstances(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", []string{"instance1"}, false)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsAsgSuspend(t *testing.T) {
+	result := suspendAsgProcesses(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "asg-1", []string{"Launch"})
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsAsgResume(t *testing.T) {
+	result := resumeAsgProcesses(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "asg-1", []string{"Launch"})
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsAsgSetDesiredCapacity(t *testing.T) {
+	result := setAsgDesiredCapacity(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "asg-1", 2)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsAsgDescribe(t *testing.T) {
+	_, _err := describeAutoScalingGroup(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "asg-1")
+	assert.NotNil(t, _err, "they should be equal")
+}
+
+func TestAwsAsgStopWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := (&AsgExecutor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", "suspend", "accessKeyId", "accessKeySecret", "us-west-2")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
+
+func TestAwsAsgStopMismatchedRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	assert.Nil(t, exec.SaveRecord("123", asgRecord{OperationType: "terminate", GroupName: "asg-1"}))
+	result := (&AsgExecutor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", "suspend", "accessKeyId", "accessKeySecret", "us-west-2")
+	assert.Equal(t, int32(47000), result.Code, "they should be equal")
+}
@@ -0,0 +1,361 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const DynamodbBin = "chaos_aws_dynamodb"
+
+// the max time to wait for the table to be active before restoring the capacities
+const dynamodbActiveTimeout = 5 * time.Minute
+
+type DynamodbActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewDynamodbActionSpec() spec.ExpActionCommandSpec {
+	return &DynamodbActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of dynamodb table, support throttle",
+				},
+				&spec.ExpFlag{
+					Name: "tableName",
+					Desc: "the name of provisioned dynamodb table",
+				},
+				&spec.ExpFlag{
+					Name:    "readCapacity",
+					Desc:    "the floor of read capacity units of table and global secondary indexes, default is 1",
+					Default: "1",
+				},
+				&spec.ExpFlag{
+					Name:    "writeCapacity",
+					Desc:    "the floor of write capacity units of table and global secondary indexes, default is 1",
+					Default: "1",
+				},
+			},
+			ActionExecutor: &DynamodbExecutor{},
+			ActionExample: `
+# drop the read and write capacity units of table t-x and its global secondary indexes to 1
+blade create aws dynamodb --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type throttle --tableName t-x
+
+# drop the read capacity units to 5 and the write capacity units to 2
+blade create aws dynamodb --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type throttle --tableName t-x --readCapacity 5 --writeCapacity 2`,
+			ActionPrograms:   []string{DynamodbBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.Dynamodb},
+		},
+	}
+}
+
+func (*DynamodbActionSpec) Name() string {
+	return "dynamodb"
+}
+
+func (*DynamodbActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*DynamodbActionSpec) ShortDesc() string {
+	return "do some aws dynamodb Operations, like throttle"
+}
+
+func (b *DynamodbActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws dynamodb Operations, like throttle the provisioned table by dropping the capacity units of table and global secondary indexes. " +
+		"The original capacities are restored on destroy, on-demand tables are refused"
+}
+
+type DynamodbExecutor struct {
+	channel spec.Channel
+}
+
+func (*DynamodbExecutor) Name() string {
+	return "dynamodb"
+}
+
+// dynamodbCapacity is the provisioned throughput of table, or of global secondary index if IndexName is not empty
+type dynamodbCapacity struct {
+	IndexName          string `json:"indexName,omitempty"`
+	ReadCapacityUnits  int64  `json:"readCapacityUnits"`
+	WriteCapacityUnits int64  `json:"writeCapacityUnits"`
+}
+
+// dynamodbRecord is the original capacities of the table and indexes changed by the experiment
+type dynamodbRecord struct {
+	TableName  string             `json:"tableName"`
+	Capacities []dynamodbCapacity `json:"capacities"`
+}
+
+func (be *DynamodbExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	tableName := model.ActionFlags["tableName"]
+	readCapacity := model.ActionFlags["readCapacity"]
+	writeCapacity := model.ActionFlags["writeCapacity"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId)
+	}
+
+	switch operationType {
+	case "throttle":
+		if tableName == "" {
+			log.Errorf(ctx, "tableName is required!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "tableName")
+		}
+		readFloor, err := strconv.ParseInt(readCapacity, 10, 64)
+		if err != nil || readFloor < 1 {
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "readCapacity", readCapacity, "it must be a positive integer")
+		}
+		writeFloor, err := strconv.ParseInt(writeCapacity, 10, 64)
+		if err != nil || writeFloor < 1 {
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "writeCapacity", writeCapacity, "it must be a positive integer")
+		}
+		return throttleDynamodbTable(ctx, uid, accessKeyId, accessKeySecret, regionId, tableName, readFloor, writeFloor)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support throttle)")
+	}
+}
+
+func (be *DynamodbExecutor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	if operationType != "throttle" {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support throttle)")
+	}
+	var record dynamodbRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	response := restoreDynamodbTable(ctx, accessKeyId, accessKeySecret, regionId, record)
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *DynamodbExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// drop the capacities of table and global secondary indexes above the floor, the original capacities are saved for destroy
+func throttleDynamodbTable(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId, tableName string, readFloor, writeFloor int64) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+
+	resp, _err := client.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+	if _err != nil {
+		log.Errorf(ctx, "describe aws dynamodb table failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "describe aws dynamodb table failed")
+	}
+	if isDynamodbOnDemand(resp.Table) {
+		log.Errorf(ctx, "the dynamodb table %s is on-demand", tableName)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "tableName", tableName,
+			"the table is on-demand(PAY_PER_REQUEST) and has no provisioned capacity to throttle")
+	}
+	original, throttled := dynamodbThrottledCapacities(resp.Table, readFloor, writeFloor)
+	if len(throttled) == 0 {
+		log.Errorf(ctx, "the capacities of dynamodb table %s are not above the floor", tableName)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "tableName", tableName,
+			"the capacities of table and global secondary indexes are not above the floor")
+	}
+	if _err = exec.SaveRecord(uid, dynamodbRecord{TableName: tableName, Capacities: original}); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	_, _err = client.UpdateTable(context.TODO(), dynamodbUpdateTableInput(tableName, throttled))
+	if _err != nil {
+		log.Errorf(ctx, "update aws dynamodb table failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "update aws dynamodb table failed")
+	}
+	return spec.Success()
+}
+
+// restore the original capacities of table and global secondary indexes once the table is active
+func restoreDynamodbTable(ctx context.Context, accessKeyId, accessKeySecret, regionId string, record dynamodbRecord) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := dynamodb.NewFromConfig(cfg)
+
+	// the table exists waiter only checks the table status, so the global secondary indexes are checked as well
+	waiter := dynamodb.NewTableExistsWaiter(client, func(options *dynamodb.TableExistsWaiterOptions) {
+		options.Retryable = func(_ context.Context, _ *dynamodb.DescribeTableInput, output *dynamodb.DescribeTableOutput, err error) (bool, error) {
+			if err != nil {
+				return false, err
+			}
+			return !isDynamodbTableActive(output.Table), nil
+		}
+	})
+	_err = waiter.Wait(context.TODO(), &dynamodb.DescribeTableInput{TableName: aws.String(record.TableName)}, dynamodbActiveTimeout)
+	if _err != nil {
+		log.Errorf(ctx, "wait aws dynamodb table active failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "wait aws dynamodb table active failed")
+	}
+	_, _err = client.UpdateTable(context.TODO(), dynamodbUpdateTableInput(record.TableName, record.Capacities))
+	if _err != nil {
+		log.Errorf(ctx, "restore aws dynamodb table capacities failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "restore aws dynamodb table capacities failed")
+	}
+	return spec.Success()
+}
+
+// whether the table and all of its global secondary indexes are active
+func isDynamodbTableActive(table *types.TableDescription) bool {
+	if table == nil || table.TableStatus != types.TableStatusActive {
+		return false
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		if index.IndexStatus != types.IndexStatusActive {
+			return false
+		}
+	}
+	return true
+}
+
+// whether the table is billed by request rather than by provisioned capacity
+func isDynamodbOnDemand(table *types.TableDescription) bool {
+	return table != nil && table.BillingModeSummary != nil && table.BillingModeSummary.BillingMode == types.BillingModePayPerRequest
+}
+
+// get the original and throttled capacities of table and global secondary indexes which are above the floor
+func dynamodbThrottledCapacities(table *types.TableDescription, readFloor, writeFloor int64) (original, throttled []dynamodbCapacity) {
+	if table == nil {
+		return nil, nil
+	}
+	add := func(indexName string, throughput *types.ProvisionedThroughputDescription) {
+		if throughput == nil {
+			return
+		}
+		read, write := aws.ToInt64(throughput.ReadCapacityUnits), aws.ToInt64(throughput.WriteCapacityUnits)
+		if read <= readFloor && write <= writeFloor {
+			return
+		}
+		original = append(original, dynamodbCapacity{IndexName: indexName, ReadCapacityUnits: read, WriteCapacityUnits: write})
+		if read > readFloor {
+			read = readFloor
+		}
+		if write > writeFloor {
+			write = writeFloor
+		}
+		throttled = append(throttled, dynamodbCapacity{IndexName: indexName, ReadCapacityUnits: read, WriteCapacityUnits: write})
+	}
+	add("", table.ProvisionedThroughput)
+	for _, index := range table.GlobalSecondaryIndexes {
+		add(aws.ToString(index.IndexName), index.ProvisionedThroughput)
+	}
+	return original, throttled
+}
+
+// build the update of table from the capacities of table and global secondary indexes
+func dynamodbUpdateTableInput(tableName string, capacities []dynamodbCapacity) *dynamodb.UpdateTableInput {
+	input := &dynamodb.UpdateTableInput{TableName: aws.String(tableName)}
+	for _, capacity := range capacities {
+		throughput := &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(capacity.ReadCapacityUnits),
+			WriteCapacityUnits: aws.Int64(capacity.WriteCapacityUnits),
+		}
+		if capacity.IndexName == "" {
+			input.ProvisionedThroughput = throughput
+			continue
+		}
+		input.GlobalSecondaryIndexUpdates = append(input.GlobalSecondaryIndexUpdates, types.GlobalSecondaryIndexUpdate{
+			Update: &types.UpdateGlobalSecondaryIndexAction{
+				IndexName:             aws.String(capacity.IndexName),
+				ProvisionedThroughput: throughput,
+			},
+		})
+	}
+	return input
+}
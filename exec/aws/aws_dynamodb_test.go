@@ -0,0 +1,93 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+func TestAwsDynamodbThrottle(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := throttleDynamodbTable(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "us-west-2", "t-x", 1, 1)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsDynamodbOnDemand(t *testing.T) {
+	assert.True(t, isDynamodbOnDemand(&types.TableDescription{
+		BillingModeSummary: &types.BillingModeSummary{BillingMode: types.BillingModePayPerRequest},
+	}))
+	assert.False(t, isDynamodbOnDemand(&types.TableDescription{
+		BillingModeSummary: &types.BillingModeSummary{BillingMode: types.BillingModeProvisioned},
+	}))
+	assert.False(t, isDynamodbOnDemand(&types.TableDescription{}))
+}
+
+func TestAwsDynamodbTableActive(t *testing.T) {
+	table := &types.TableDescription{
+		TableStatus: types.TableStatusActive,
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndexDescription{
+			{IndexName: aws.String("gsi-1"), IndexStatus: types.IndexStatusActive},
+			{IndexName: aws.String("gsi-2"), IndexStatus: types.IndexStatusUpdating},
+		},
+	}
+	assert.False(t, isDynamodbTableActive(table))
+	table.GlobalSecondaryIndexes[1].IndexStatus = types.IndexStatusActive
+	assert.True(t, isDynamodbTableActive(table))
+	table.TableStatus = types.TableStatusUpdating
+	assert.False(t, isDynamodbTableActive(table))
+	assert.False(t, isDynamodbTableActive(nil))
+}
+
+func TestAwsDynamodbThrottledCapacities(t *testing.T) {
+	table := &types.TableDescription{
+		ProvisionedThroughput: &types.ProvisionedThroughputDescription{ReadCapacityUnits: aws.Int64(100), WriteCapacityUnits: aws.Int64(1)},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndexDescription{
+			{IndexName: aws.String("gsi-1"), ProvisionedThroughput: &types.ProvisionedThroughputDescription{ReadCapacityUnits: aws.Int64(10), WriteCapacityUnits: aws.Int64(20)}},
+			{IndexName: aws.String("gsi-2"), ProvisionedThroughput: &types.ProvisionedThroughputDescription{ReadCapacityUnits: aws.Int64(1), WriteCapacityUnits: aws.Int64(1)}},
+		},
+	}
+	original, throttled := dynamodbThrottledCapacities(table, 1, 1)
+	assert.Equal(t, []dynamodbCapacity{
+		{ReadCapacityUnits: 100, WriteCapacityUnits: 1},
+		{IndexName: "gsi-1", ReadCapacityUnits: 10, WriteCapacityUnits: 20},
+	}, original, "they should be equal")
+	assert.Equal(t, []dynamodbCapacity{
+		{ReadCapacityUnits: 1, WriteCapacityUnits: 1},
+		{IndexName: "gsi-1", ReadCapacityUnits: 1, WriteCapacityUnits: 1},
+	}, throttled, "they should be equal")
+
+	input := dynamodbUpdateTableInput("t-x", original)
+	assert.Equal(t, int64(100), aws.ToInt64(input.ProvisionedThroughput.ReadCapacityUnits), "they should be equal")
+	assert.Equal(t, 1, len(input.GlobalSecondaryIndexUpdates), "they should be equal")
+	assert.Equal(t, "gsi-1", aws.ToString(input.GlobalSecondaryIndexUpdates[0].Update.IndexName), "they should be equal")
+	assert.Equal(t, int64(20), aws.ToInt64(input.GlobalSecondaryIndexUpdates[0].Update.ProvisionedThroughput.WriteCapacityUnits), "they should be equal")
+}
+
+func TestAwsDynamodbStopWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := (&DynamodbExecutor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", "throttle", "accessKeyId", "accessKeySecret", "us-west-2")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
@@ -0,0 +1,455 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const EbsBin = "chaos_aws_ebs"
+
+// the max time to wait for the detached volume to be available before reattaching it
+const ebsAvailableTimeout = 5 * time.Minute
+
+type EbsActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewEbsActionSpec() spec.ExpActionCommandSpec {
+	return &EbsActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of volume, support detach, degrade",
+				},
+				&spec.ExpFlag{
+					Name: "volumeId",
+					Desc: "the volumeId",
+				},
+				&spec.ExpFlag{
+					Name: "instanceId",
+					Desc: "the instanceId which the volume is detached from, required if the volume is attached to multiple instances",
+				},
+				&spec.ExpFlag{
+					Name:    "force",
+					Desc:    "force the volume to detach when operationType is detach, default is false",
+					Default: "false",
+				},
+				&spec.ExpFlag{
+					Name: "iops",
+					Desc: "the iops of the volume when operationType is degrade, only for gp3, io1 and io2 volumes, at least 3000 for gp3 and 100 for io1 and io2",
+				},
+				&spec.ExpFlag{
+					Name: "throughput",
+					Desc: "the throughput of the volume in MiB/s when operationType is degrade, only for gp3 volumes, at least 125",
+				},
+			},
+			ActionExecutor: &EbsExecutor{},
+			ActionExample: `
+# force detach volume vol-x from its instance
+blade create aws ebs --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type detach --volumeId vol-x --force true
+
+# lower the iops and throughput of gp3 volume vol-x provisioned above the baseline to the minimum of gp3
+blade create aws ebs --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type degrade --volumeId vol-x --iops 3000 --throughput 125
+
+# lower the iops of io2 volume vol-y to 100
+blade create aws ebs --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type degrade --volumeId vol-y --iops 100`,
+			ActionPrograms:   []string{EbsBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.Ebs},
+		},
+	}
+}
+
+func (*EbsActionSpec) Name() string {
+	return "ebs"
+}
+
+func (*EbsActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*EbsActionSpec) ShortDesc() string {
+	return "do some aws ebs Operations, like detach, degrade"
+}
+
+func (b *EbsActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws ebs Operations, like detach the volume from its instance, degrade the iops and throughput. " +
+		"The volume is reattached to the same device and the original iops and throughput are restored on destroy, " +
+		"note that aws only allows to modify a volume once in six hours, so the destroy of degrade may need to be retried"
+}
+
+type EbsExecutor struct {
+	channel spec.Channel
+}
+
+func (*EbsExecutor) Name() string {
+	return "ebs"
+}
+
+// ebsRecord is the attachment or performance of the volume before the experiment
+type ebsRecord struct {
+	OperationType       string `json:"operationType"`
+	VolumeId            string `json:"volumeId"`
+	InstanceId          string `json:"instanceId,omitempty"`
+	Device              string `json:"device,omitempty"`
+	DeleteOnTermination bool   `json:"deleteOnTermination,omitempty"`
+	Iops                *int32 `json:"iops,omitempty"`
+	Throughput          *int32 `json:"throughput,omitempty"`
+}
+
+func (be *EbsExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	volumeId := model.ActionFlags["volumeId"]
+	instanceId := model.ActionFlags["instanceId"]
+	force := model.ActionFlags["force"] == "true"
+	iops := model.ActionFlags["iops"]
+	throughput := model.ActionFlags["throughput"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if volumeId == "" {
+		log.Errorf(ctx, "volumeId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "volumeId")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId)
+	}
+
+	var iopsValue, throughputValue *int32
+	if operationType == "degrade" {
+		if iops == "" && throughput == "" {
+			log.Errorf(ctx, "iops or throughput is required when operationType is degrade!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "iops|throughput")
+		}
+		if iops != "" {
+			value, err := strconv.ParseInt(iops, 10, 32)
+			if err != nil || value <= 0 {
+				return spec.ResponseFailWithFlags(spec.ParameterIllegal, "iops", iops, "it must be a positive integer")
+			}
+			iopsValue = aws.Int32(int32(value))
+		}
+		if throughput != "" {
+			value, err := strconv.ParseInt(throughput, 10, 32)
+			if err != nil || value <= 0 {
+				return spec.ResponseFailWithFlags(spec.ParameterIllegal, "throughput", throughput, "it must be a positive integer")
+			}
+			throughputValue = aws.Int32(int32(value))
+		}
+	}
+	return be.start(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, volumeId, instanceId, force, iopsValue, throughputValue)
+}
+
+func (be *EbsExecutor) start(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId, volumeId, instanceId string, force bool, iops, throughput *int32) *spec.Response {
+	switch operationType {
+	case "detach", "degrade":
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support detach, degrade)")
+	}
+	volume, _err := describeAwsVolume(ctx, accessKeyId, accessKeySecret, regionId, volumeId)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe volume failed")
+	}
+	record := ebsRecord{OperationType: operationType, VolumeId: volumeId}
+	if operationType == "detach" {
+		var attachments []types.VolumeAttachment
+		for _, attachment := range volume.Attachments {
+			if attachment.State == types.VolumeAttachmentStateAttached && (instanceId == "" || aws.ToString(attachment.InstanceId) == instanceId) {
+				attachments = append(attachments, attachment)
+			}
+		}
+		if len(attachments) != 1 {
+			log.Errorf(ctx, "found %d attachments of volume %s on instance %s, expected 1", len(attachments), volumeId, instanceId)
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "instanceId", instanceId, "the volume is not attached or attached to multiple instances")
+		}
+		record.InstanceId = aws.ToString(attachments[0].InstanceId)
+		record.Device = aws.ToString(attachments[0].Device)
+		record.DeleteOnTermination = aws.ToBool(attachments[0].DeleteOnTermination)
+		if _err = exec.SaveRecord(uid, record); _err != nil {
+			log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+			return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+		}
+		return detachAwsVolume(ctx, accessKeyId, accessKeySecret, regionId, volumeId, record.InstanceId, record.Device, force)
+	}
+
+	switch volume.VolumeType {
+	case types.VolumeTypeGp3:
+	case types.VolumeTypeIo1, types.VolumeTypeIo2:
+		if throughput != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "throughput", strconv.Itoa(int(*throughput)), "only gp3 volumes support throughput")
+		}
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "volumeId", volumeId, fmt.Sprintf("the volume type %s does not support degrade", volume.VolumeType))
+	}
+	// ModifyVolume rejects the performance below the minimum of the volume type
+	minIops, minThroughput := ebsMinPerformance(volume.VolumeType)
+	if iops != nil && *iops < minIops {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "iops", strconv.Itoa(int(*iops)),
+			fmt.Sprintf("it must be at least %d for %s volumes", minIops, volume.VolumeType))
+	}
+	if throughput != nil && *throughput < minThroughput {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "throughput", strconv.Itoa(int(*throughput)),
+			fmt.Sprintf("it must be at least %d for %s volumes", minThroughput, volume.VolumeType))
+	}
+	if iops != nil {
+		if *iops >= aws.ToInt32(volume.Iops) {
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "iops", strconv.Itoa(int(*iops)),
+				fmt.Sprintf("it must be lower than the current iops %d", aws.ToInt32(volume.Iops)))
+		}
+		record.Iops = volume.Iops
+	}
+	if throughput != nil {
+		if *throughput >= aws.ToInt32(volume.Throughput) {
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "throughput", strconv.Itoa(int(*throughput)),
+				fmt.Sprintf("it must be lower than the current throughput %d", aws.ToInt32(volume.Throughput)))
+		}
+		record.Throughput = volume.Throughput
+	}
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	return modifyAwsVolume(ctx, accessKeyId, accessKeySecret, regionId, volumeId, iops, throughput)
+}
+
+func (be *EbsExecutor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	var record ebsRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	if record.OperationType != operationType {
+		log.Errorf(ctx, "the experiment %s is created by type %s, not %s", uid, record.OperationType, operationType)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type", operationType, "it must be the type of the experiment "+record.OperationType)
+	}
+	var response *spec.Response
+	switch operationType {
+	case "detach":
+		response = attachAwsVolume(ctx, accessKeyId, accessKeySecret, regionId, record.VolumeId, record.InstanceId, record.Device, record.DeleteOnTermination)
+	case "degrade":
+		response = modifyAwsVolume(ctx, accessKeyId, accessKeySecret, regionId, record.VolumeId, record.Iops, record.Throughput)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support detach, degrade)")
+	}
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *EbsExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// the minimum iops and throughput of the volume type
+func ebsMinPerformance(volumeType types.VolumeType) (iops, throughput int32) {
+	switch volumeType {
+	case types.VolumeTypeGp3:
+		return 3000, 125
+	case types.VolumeTypeIo1, types.VolumeTypeIo2:
+		return 100, 0
+	}
+	return 0, 0
+}
+
+// detach volume
+func detachAwsVolume(ctx context.Context, accessKeyId, accessKeySecret, regionId, volumeId, instanceId, device string, force bool) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	input := &ec2.DetachVolumeInput{
+		VolumeId:   aws.String(volumeId),
+		InstanceId: aws.String(instanceId),
+		Device:     aws.String(device),
+		Force:      aws.Bool(force),
+	}
+	_, _err = client.DetachVolume(context.TODO(), input)
+	if _err != nil {
+		log.Errorf(ctx, "detach aws volume failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "detach aws volume failed")
+	}
+	return spec.Success()
+}
+
+// attach volume to the device of instance after it is available
+func attachAwsVolume(ctx context.Context, accessKeyId, accessKeySecret, regionId, volumeId, instanceId, device string, deleteOnTermination bool) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	waiter := ec2.NewVolumeAvailableWaiter(client)
+	_err = waiter.Wait(context.TODO(), &ec2.DescribeVolumesInput{VolumeIds: []string{volumeId}}, ebsAvailableTimeout)
+	if _err != nil {
+		log.Errorf(ctx, "wait aws volume available failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "wait aws volume available failed")
+	}
+	input := &ec2.AttachVolumeInput{
+		VolumeId:   aws.String(volumeId),
+		InstanceId: aws.String(instanceId),
+		Device:     aws.String(device),
+	}
+	_, _err = client.AttachVolume(context.TODO(), input)
+	if _err != nil {
+		log.Errorf(ctx, "attach aws volume failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "attach aws volume failed")
+	}
+	if !deleteOnTermination {
+		return spec.Success()
+	}
+	// the reattached volume is not deleted on termination by default
+	_, _err = client.ModifyInstanceAttribute(context.TODO(), &ec2.ModifyInstanceAttributeInput{
+		InstanceId: aws.String(instanceId),
+		BlockDeviceMappings: []types.InstanceBlockDeviceMappingSpecification{
+			{
+				DeviceName: aws.String(device),
+				Ebs: &types.EbsInstanceBlockDeviceSpecification{
+					VolumeId:            aws.String(volumeId),
+					DeleteOnTermination: aws.Bool(true),
+				},
+			},
+		},
+	})
+	if _err != nil {
+		log.Errorf(ctx, "restore delete on termination of aws volume failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "restore delete on termination of aws volume failed")
+	}
+	return spec.Success()
+}
+
+// modify the iops and throughput of volume, nil means unchanged
+func modifyAwsVolume(ctx context.Context, accessKeyId, accessKeySecret, regionId, volumeId string, iops, throughput *int32) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	input := &ec2.ModifyVolumeInput{
+		VolumeId:   aws.String(volumeId),
+		Iops:       iops,
+		Throughput: throughput,
+	}
+	_, _err = client.ModifyVolume(context.TODO(), input)
+	if _err != nil {
+		log.Errorf(ctx, "modify aws volume failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "modify aws volume failed")
+	}
+	return spec.Success()
+}
+
+// describe volume
+func describeAwsVolume(ctx context.Context, accessKeyId, accessKeySecret, regionId, volumeId string) (_result *types.Volume, _err error) {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	resp, _err := client.DescribeVolumes(context.TODO(), &ec2.DescribeVolumesInput{
+		VolumeIds: []string{volumeId},
+	})
+	if _err != nil {
+		log.Errorf(ctx, "describe aws volume failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	if len(resp.Volumes) == 0 {
+		_err = fmt.Errorf("volume %s not found", volumeId)
+		log.Errorf(ctx, "describe aws volume failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	_result = &resp.Volumes[0]
+	return _result, _err
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+func TestAwsEbsDetach(t *testing.T) {
+	result := detachAwsVolume(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "vol-1", "instance1", "/dev/sdf", true)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsEbsModify(t *testing.T) {
+	result := modifyAwsVolume(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "vol-1", aws.Int32(3000), aws.Int32(125))
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsEbsDescribe(t *testing.T) {
+	_, _err := describeAwsVolume(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "vol-1")
+	assert.NotNil(t, _err, "they should be equal")
+}
+
+func TestAwsEbsStopWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := (&EbsExecutor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", "detach", "accessKeyId", "accessKeySecret", "us-west-2")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
+
+func TestAwsEbsStopMismatchedRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	ctx := context.WithValue(context.Background(), "uid", "123")
+	assert.Nil(t, exec.SaveRecord("123", ebsRecord{OperationType: "detach", VolumeId: "vol-1", InstanceId: "i-x", Device: "/dev/sdf"}))
+
+	result := (&EbsExecutor{}).stop(ctx, "123", "degrade", "accessKeyId", "accessKeySecret", "us-west-2")
+	assert.Equal(t, int32(47000), result.Code, "they should be equal")
+}
+
+func TestAwsEbsMinPerformance(t *testing.T) {
+	iops, throughput := ebsMinPerformance(types.VolumeTypeGp3)
+	assert.Equal(t, []int32{3000, 125}, []int32{iops, throughput}, "they should be equal")
+	iops, throughput = ebsMinPerformance(types.VolumeTypeIo2)
+	assert.Equal(t, []int32{100, 0}, []int32{iops, throughput}, "they should be equal")
+}
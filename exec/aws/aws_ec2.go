@@ -19,7 +19,9 @@ package aws
 import (
 	"context"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -29,18 +31,20 @@ import (
 	"github.com/chaosblade-io/chaosblade-spec-go/spec"
 	"github.com/chaosblade-io/chaosblade-spec-go/util"
 
-	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
 	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
 )
 
 const Ec2Bin = "chaos_aws_ec2"
 
-type EcsActionSpec struct {
+// the max time to wait for the instances in transitional states, like stopping, to be settled before recovering them
+const ec2SettledTimeout = 10 * time.Minute
+
+type Ec2ActionSpec struct {
 	spec.BaseExpActionCommandSpec
 }
 
-func NewEcsActionSpec() spec.ExpActionCommandSpec {
-	return &EcsActionSpec{
+func NewEc2ActionSpec() spec.ExpActionCommandSpec {
+	return &Ec2ActionSpec{
 		spec.BaseExpActionCommandSpec{
 			ActionFlags: []spec.ExpFlagSpec{
 				&spec.ExpFlag{
@@ -57,57 +61,96 @@ func NewEcsActionSpec() spec.ExpActionCommandSpec {
 				},
 				&spec.ExpFlag{
 					Name: "type",
-					Desc: "the operation of instances, support start, stop, reboot, etc",
+					Desc: "the operation of instances, support start, stop, reboot, terminate, interrupt, etc",
 				},
 				&spec.ExpFlag{
 					Name: "instances",
 					Desc: "the instances list, split by comma",
 				},
+				&spec.ExpFlag{
+					Name:    "force",
+					Desc:    "force the instances to stop without flushing file system caches when operationType is stop, default is false",
+					Default: "false",
+				},
+				&spec.ExpFlag{
+					Name:    "hibernate",
+					Desc:    "hibernate the instances instead of stopping them when operationType is stop, default is false",
+					Default: "false",
+				},
+				&spec.ExpFlag{
+					Name:    "confirmTerminate",
+					Desc:    "confirm to terminate the instances when operationType is terminate, or interrupt with interruptAction terminate, it must be true because terminated instances can not be recovered",
+					Default: "false",
+				},
+				&spec.ExpFlag{
+					Name:    "interruptAction",
+					Desc:    "the action of spot interruption when operationType is interrupt, support terminate, stop, hibernate, default is terminate",
+					Default: "terminate",
+				},
+				&spec.ExpFlag{
+					Name:    "notice",
+					Desc:    "the seconds between the interruption notice and the interruption action when operationType is interrupt, default is 120",
+					Default: "120",
+				},
 			},
-			ActionExecutor: &EcsExecutor{},
+			ActionExecutor: &Ec2Executor{},
 			ActionExample: `
 # stop instances which instance id is i-x,i-y
-blade create aws ecs --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type stop --instances i-x,i-y
+blade create aws ec2 --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type stop --instances i-x,i-y
+
+# force stop instances which instance id is i-x,i-y
+blade create aws ec2 --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type stop --instances i-x,i-y --force true
+
+# hibernate instances which instance id is i-x,i-y
+blade create aws ec2 --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type stop --instances i-x,i-y --hibernate true
 
 # start instances which instance id is i-x,i-y
-blade create aws ecs --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type start --instances i-x,i-y
+blade create aws ec2 --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type start --instances i-x,i-y
 
 # reboot instances which instance id is i-x,i-y
-blade create aws ecs --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type reboot --instances i-x,i-y`,
+blade create aws ec2 --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type reboot --instances i-x,i-y
+
+# terminate instances which instance id is i-x,i-y, they can not be recovered
+blade create aws ec2 --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type terminate --instances i-x,i-y --confirmTerminate true
+
+# simulate the spot interruption of instances which instance id is i-x,i-y, they are stopped two minutes after the notice tags
+blade create aws ec2 --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type interrupt --instances i-x,i-y --interruptAction stop --notice 120`,
 			ActionPrograms:   []string{Ec2Bin},
 			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.Ec2},
 		},
 	}
 }
 
-func (*EcsActionSpec) Name() string {
-	return "ecs"
+func (*Ec2ActionSpec) Name() string {
+	return "ec2"
 }
 
-func (*EcsActionSpec) Aliases() []string {
-	return []string{}
+func (*Ec2ActionSpec) Aliases() []string {
+	return []string{"ecs"}
 }
 
-func (*EcsActionSpec) ShortDesc() string {
-	return "do some aws ecs Operations, like stop, start, reboot"
+func (*Ec2ActionSpec) ShortDesc() string {
+	return "do some aws ec2 Operations, like stop, start, reboot, terminate, interrupt"
 }
 
-func (b *EcsActionSpec) LongDesc() string {
+func (b *Ec2ActionSpec) LongDesc() string {
 	if b.ActionLongDesc != "" {
 		return b.ActionLongDesc
 	}
-	return "do some aws ecs Operations, like stop, start, reboot"
+	return "do some aws ec2 Operations, like stop, start, reboot, terminate, interrupt. The stopped instances are started and the started instances are stopped on destroy, reboot and terminate can not be recovered. " +
+		"The interrupt operation simulates the spot interruption, it tags the instances with the rebalance recommendation and instance action notices, " +
+		"which can be read from the instance metadata if the instance tags are allowed in it, and operates the instances after the notice from a detached chaos_cloud timer"
 }
 
-type EcsExecutor struct {
+type Ec2Executor struct {
 	channel spec.Channel
 }
 
-func (*EcsExecutor) Name() string {
-	return "ecs"
+func (*Ec2Executor) Name() string {
+	return "ec2"
 }
 
-func (be *EcsExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+func (be *Ec2Executor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
 	if be.channel == nil {
 		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
 		return spec.ResponseFailWithFlags(spec.ChannelNil)
@@ -117,6 +160,11 @@ func (be *EcsExecutor) Exec(uid string, ctx context.Context, model *spec.ExpMode
 	regionId := model.ActionFlags["regionId"]
 	operationType := model.ActionFlags["type"]
 	instances := model.ActionFlags["instances"]
+	force := model.ActionFlags["force"] == "true"
+	hibernate := model.ActionFlags["hibernate"] == "true"
+	confirmTerminate := model.ActionFlags["confirmTerminate"] == "true"
+	interruptAction := model.ActionFlags["interruptAction"]
+	notice := model.ActionFlags["notice"]
 	if accessKeyId == "" {
 		val, ok := os.LookupEnv("ACCESS_KEY_ID")
 		if !ok {
@@ -150,53 +198,90 @@ func (be *EcsExecutor) Exec(uid string, ctx context.Context, model *spec.ExpMode
 		return spec.ResponseFailWithFlags(spec.ParameterLess, "instances")
 	}
 	instancesArray := strings.Split(instances, ",")
-	instanceStatusMap, _err := describeInstancesStatus(ctx, accessKeyId, accessKeySecret, regionId, instancesArray)
-	if _err != nil {
-		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe instances status failed")
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		if operationType == "interrupt" {
+			return be.stopInterrupt(ctx, uid, accessKeyId, accessKeySecret, regionId)
+		}
+		return be.stop(ctx, operationType, accessKeyId, accessKeySecret, regionId, instancesArray)
 	}
 
-	for _, instance := range instancesArray {
-		if (instanceStatusMap[instance] == "Running" && operationType == "start") || (instanceStatusMap[instance] == "Stopped" && operationType == "stop") {
-			return be.stop(ctx, operationType, accessKeyId, accessKeySecret, regionId, instancesArray)
+	if operationType == "interrupt" {
+		if interruptAction == "" {
+			interruptAction = "terminate"
+		}
+		if interruptAction != "terminate" && interruptAction != "stop" && interruptAction != "hibernate" {
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "interruptAction", interruptAction, "it must be terminate, stop or hibernate")
+		}
+		if interruptAction == "terminate" && !confirmTerminate {
+			log.Errorf(ctx, "confirmTerminate must be true when interruptAction is terminate, the terminated instances can not be recovered!")
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "confirmTerminate", model.ActionFlags["confirmTerminate"], "it must be true to terminate instances")
 		}
+		noticeSeconds, err := strconv.Atoi(notice)
+		if err != nil || noticeSeconds < 0 {
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "notice", notice, "it must be a non-negative integer")
+		}
+		if deadline, ok := os.LookupEnv(ec2InterruptTimerEnv); ok {
+			return runAwsInterruptTimer(ctx, accessKeyId, accessKeySecret, regionId, instancesArray, interruptAction, deadline)
+		}
+		return interruptAwsInstances(ctx, uid, accessKeyId, accessKeySecret, regionId, instancesArray, interruptAction, time.Duration(noticeSeconds)*time.Second)
+	}
+
+	if operationType == "terminate" && !confirmTerminate {
+		log.Errorf(ctx, "confirmTerminate must be true when operationType is terminate, the terminated instances can not be recovered!")
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "confirmTerminate", model.ActionFlags["confirmTerminate"], "it must be true to terminate instances")
 	}
-	return be.start(ctx, operationType, accessKeyId, accessKeySecret, regionId, instancesArray)
+	return be.start(ctx, operationType, accessKeyId, accessKeySecret, regionId, instancesArray, force, hibernate)
 }
 
-func (be *EcsExecutor) start(ctx context.Context, operationType, accessKeyId, accessKeySecret, regionId string, instancesArray []string) *spec.Response {
+func (be *Ec2Executor) start(ctx context.Context, operationType, accessKeyId, accessKeySecret, regionId string, instancesArray []string, force, hibernate bool) *spec.Response {
 	switch operationType {
 	case "start":
 		return startAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instancesArray)
 	case "stop":
-		return stopAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instancesArray)
+		return stopAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instancesArray, force, hibernate)
 	case "reboot":
 		return rebootAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instancesArray)
-	// case "delete":
-	//	return deleteAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instancesArray)
+	case "terminate":
+		return terminateAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instancesArray)
 	default:
-		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support start, stop, reboot)")
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support start, stop, reboot, terminate, interrupt)")
 	}
-	select {}
 }
 
-func (be *EcsExecutor) stop(ctx context.Context, operationType, accessKeyId, accessKeySecret, regionId string, instancesArray []string) *spec.Response {
+func (be *Ec2Executor) stop(ctx context.Context, operationType, accessKeyId, accessKeySecret, regionId string, instancesArray []string) *spec.Response {
 	switch operationType {
-	case "start":
-		return stopAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instancesArray)
-	case "stop":
-		return startAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instancesArray)
-	// case "reboot":
-	//	return rebootAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instancesArray)
-	// case "delete":
-	//	return deleteAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instancesArray)
+	case "start", "stop":
+		instanceStatusMap, _err := describeSettledInstancesStatus(ctx, accessKeyId, accessKeySecret, regionId, instancesArray)
+		if _err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe instances status failed")
+		}
+		// only the instances still in the injected state are recovered
+		injectedStatus := map[string]string{"start": "running", "stop": "stopped"}[operationType]
+		var recovering []string
+		for _, instance := range instancesArray {
+			if instanceStatusMap[instance] == injectedStatus {
+				recovering = append(recovering, instance)
+			}
+		}
+		if len(recovering) == 0 {
+			log.Infof(ctx, "no instance of %v is %s, nothing to recover", instancesArray, injectedStatus)
+			return spec.Success()
+		}
+		if operationType == "start" {
+			return stopAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, recovering, false, false)
+		}
+		return startAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, recovering)
+	case "reboot", "terminate":
+		// the rebooted instances recover by themselves, the terminated instances can not be recovered
+		log.Infof(ctx, "nothing to recover for %s instances %v", operationType, instancesArray)
+		return spec.Success()
 	default:
-		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support start, stop, reboot)")
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support start, stop, reboot, terminate, interrupt)")
 	}
-	ctx = context.WithValue(ctx, "bin", Ec2Bin)
-	return exec.Destroy(ctx, be.channel, "aws es")
 }
 
-func (be *EcsExecutor) SetChannel(channel spec.Channel) {
+func (be *Ec2Executor) SetChannel(channel spec.Channel) {
 	be.channel = channel
 }
 
@@ -234,8 +319,8 @@ func startAwsInstances(ctx context.Context, accessKeyId, accessKeySecret, region
 	return spec.Success()
 }
 
-// stop instances
-func stopAwsInstances(ctx context.Context, accessKeyId, accessKeySecret, regionId string, instances []string) *spec.Response {
+// stop instances, force stops them without flushing caches and hibernate suspends them to disk
+func stopAwsInstances(ctx context.Context, accessKeyId, accessKeySecret, regionId string, instances []string, force, hibernate bool) *spec.Response {
 	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
 	if _err != nil {
 		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
@@ -245,6 +330,8 @@ func stopAwsInstances(ctx context.Context, accessKeyId, accessKeySecret, regionI
 
 	input := &ec2.StopInstancesInput{
 		InstanceIds: instances,
+		Force:       aws.Bool(force),
+		Hibernate:   aws.Bool(hibernate),
 	}
 	_, _err = client.StopInstances(context.TODO(), input)
 	if _err != nil {
@@ -274,8 +361,8 @@ func rebootAwsInstances(ctx context.Context, accessKeyId, accessKeySecret, regio
 	return spec.Success()
 }
 
-// delete instances
-func deleteAwsInstances(ctx context.Context, accessKeyId, accessKeySecret, regionId string, instances []string) *spec.Response {
+// terminate instances
+func terminateAwsInstances(ctx context.Context, accessKeyId, accessKeySecret, regionId string, instances []string) *spec.Response {
 	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
 	if _err != nil {
 		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
@@ -288,8 +375,8 @@ func deleteAwsInstances(ctx context.Context, accessKeyId, accessKeySecret, regio
 	}
 	_, _err = client.TerminateInstances(context.TODO(), input)
 	if _err != nil {
-		log.Errorf(ctx, "delete aws instances failed, err: %s", _err.Error())
-		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "delete aws instances failed")
+		log.Errorf(ctx, "terminate aws instances failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "terminate aws instances failed")
 	}
 	return spec.Success()
 }
@@ -305,7 +392,8 @@ func describeInstancesStatus(ctx context.Context, accessKeyId, accessKeySecret,
 
 	// Create an input object with the instance IDs
 	input := &ec2.DescribeInstanceStatusInput{
-		InstanceIds: instances,
+		InstanceIds:         instances,
+		IncludeAllInstances: aws.Bool(true),
 	}
 
 	// Describe the instance status
@@ -323,3 +411,48 @@ func describeInstancesStatus(ctx context.Context, accessKeyId, accessKeySecret,
 	_result = statusMap
 	return _result, _err
 }
+
+// describe instances status after the instances in transitional states are settled, like stopping to stopped and
+// pending to running, so that the instances operated just now are not missed
+func describeSettledInstancesStatus(ctx context.Context, accessKeyId, accessKeySecret, regionId string, instances []string) (_result map[string]string, _err error) {
+	statusMap, _err := describeInstancesStatus(ctx, accessKeyId, accessKeySecret, regionId, instances)
+	if _err != nil {
+		return _result, _err
+	}
+	var stopping, pending []string
+	for _, instance := range instances {
+		switch statusMap[instance] {
+		case "stopping":
+			stopping = append(stopping, instance)
+		case "pending":
+			pending = append(pending, instance)
+		}
+	}
+	if len(stopping) == 0 && len(pending) == 0 {
+		return statusMap, nil
+	}
+
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	client := ec2.NewFromConfig(cfg)
+	if len(stopping) > 0 {
+		log.Infof(ctx, "wait aws instances %v stopped", stopping)
+		waiter := ec2.NewInstanceStoppedWaiter(client)
+		if _err = waiter.Wait(context.TODO(), &ec2.DescribeInstancesInput{InstanceIds: stopping}, ec2SettledTimeout); _err != nil {
+			log.Errorf(ctx, "wait aws instances stopped failed, err: %s", _err.Error())
+			return _result, _err
+		}
+	}
+	if len(pending) > 0 {
+		log.Infof(ctx, "wait aws instances %v running", pending)
+		waiter := ec2.NewInstanceRunningWaiter(client)
+		if _err = waiter.Wait(context.TODO(), &ec2.DescribeInstancesInput{InstanceIds: pending}, ec2SettledTimeout); _err != nil {
+			log.Errorf(ctx, "wait aws instances running failed, err: %s", _err.Error())
+			return _result, _err
+		}
+	}
+	return describeInstancesStatus(ctx, accessKeyId, accessKeySecret, regionId, instances)
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+// the env of the detached chaos_cloud timer, its value is the time to operate the interrupted instances
+const ec2InterruptTimerEnv = "CHAOS_CLOUD_EC2_INTERRUPT_TIME"
+
+// the tags of interruption notices, the values have the same format as the spot instance metadata
+const (
+	ec2RebalanceTagKey      = "chaosblade-rebalance-recommendation"
+	ec2InstanceActionTagKey = "chaosblade-spot-instance-action"
+)
+
+// ec2InterruptRecord is the interrupted instances, the time of interruption action and the pid of the timer
+type ec2InterruptRecord struct {
+	Instances []string `json:"instances"`
+	Action    string   `json:"action"`
+	Time      string   `json:"time"`
+	TimerPid  int      `json:"timerPid,omitempty"`
+}
+
+// tag the instances with interruption notices and start the detached timer to operate them after the notice
+func interruptAwsInstances(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId string, instances []string, action string, notice time.Duration) *spec.Response {
+	noticeTime := time.Now().UTC().Truncate(time.Second)
+	actionTime := noticeTime.Add(notice)
+	record := ec2InterruptRecord{Instances: instances, Action: action, Time: actionTime.Format(time.RFC3339)}
+	if _err := exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	response := createAwsTags(ctx, accessKeyId, accessKeySecret, regionId, instances, awsInterruptTags(action, noticeTime, actionTime))
+	if !response.Success {
+		return response
+	}
+
+	executable, _err := os.Executable()
+	if _err != nil {
+		log.Errorf(ctx, "get the chaos_cloud program failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.OsCmdExecFailed, "chaos_cloud", _err)
+	}
+	cmd := awsInterruptTimerCommand(executable, uid, accessKeyId, accessKeySecret, regionId, instances, action, actionTime)
+	if _err = cmd.Start(); _err != nil {
+		log.Errorf(ctx, "start the interrupt timer failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.OsCmdExecFailed, cmd.String(), _err)
+	}
+	record.TimerPid = cmd.Process.Pid
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		cmd.Process.Kill()
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	log.Infof(ctx, "the interrupt timer %d will %s instances %v at %s", record.TimerPid, action, instances, record.Time)
+	cmd.Process.Release()
+	return spec.Success()
+}
+
+// build the interruption notices in the format of spot instance metadata
+func awsInterruptTags(action string, noticeTime, actionTime time.Time) []types.Tag {
+	return []types.Tag{
+		{
+			Key:   aws.String(ec2RebalanceTagKey),
+			Value: aws.String(fmt.Sprintf(`{"noticeTime":"%s"}`, noticeTime.UTC().Format(time.RFC3339))),
+		},
+		{
+			Key:   aws.String(ec2InstanceActionTagKey),
+			Value: aws.String(fmt.Sprintf(`{"action":"%s","time":"%s"}`, action, actionTime.UTC().Format(time.RFC3339))),
+		},
+	}
+}
+
+// build the detached chaos_cloud timer, the uid is kept in the command line so that destroy can verify the pid of it
+func awsInterruptTimerCommand(executable, uid, accessKeyId, accessKeySecret, regionId string, instances []string, action string, actionTime time.Time) *osexec.Cmd {
+	cmd := osexec.Command(executable, spec.Create, "aws", "ec2",
+		"--type", "interrupt",
+		"--regionId", regionId,
+		"--instances", strings.Join(instances, ","),
+		"--interruptAction", action,
+		"--confirmTerminate", "true",
+		"--uid", uid,
+	)
+	// the credentials are passed by env to keep them out of the process list
+	cmd.Env = append(os.Environ(),
+		"ACCESS_KEY_ID="+accessKeyId,
+		"ACCESS_KEY_SECRET="+accessKeySecret,
+		ec2InterruptTimerEnv+"="+actionTime.UTC().Format(time.RFC3339),
+	)
+	// the timer runs in its own session to outlive the blade command
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	return cmd
+}
+
+// wait until the interruption time and operate the instances, it runs in the detached chaos_cloud timer
+func runAwsInterruptTimer(ctx context.Context, accessKeyId, accessKeySecret, regionId string, instances []string, action, actionTime string) *spec.Response {
+	at, _err := time.Parse(time.RFC3339, actionTime)
+	if _err != nil {
+		log.Errorf(ctx, "parse the interruption time %s failed, err: %s", actionTime, _err.Error())
+		return spec.ResponseFailWithFlags(spec.ParameterIllegal, ec2InterruptTimerEnv, actionTime, _err.Error())
+	}
+	time.Sleep(time.Until(at))
+	log.Infof(ctx, "interrupt instances %v by %s", instances, action)
+	switch action {
+	case "stop":
+		return stopAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instances, false, false)
+	case "hibernate":
+		return stopAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instances, false, true)
+	default:
+		return terminateAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instances)
+	}
+}
+
+// cancel the pending timer, remove the interruption notices and start the stopped instances
+func (be *Ec2Executor) stopInterrupt(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	var record ec2InterruptRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+
+	if record.TimerPid > 0 && isAwsInterruptTimer(record.TimerPid, uid) {
+		response := be.channel.Run(ctx, "kill", fmt.Sprintf("-9 %d", record.TimerPid))
+		if !response.Success {
+			return response
+		}
+		log.Infof(ctx, "the interrupt timer %d of experiment %s is canceled", record.TimerPid, uid)
+	}
+
+	response := deleteAwsTags(ctx, accessKeyId, accessKeySecret, regionId, record.Instances, []string{ec2RebalanceTagKey, ec2InstanceActionTagKey})
+	if !response.Success {
+		return response
+	}
+	if record.Action != "terminate" {
+		instanceStatusMap, _err := describeSettledInstancesStatus(ctx, accessKeyId, accessKeySecret, regionId, record.Instances)
+		if _err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe instances status failed")
+		}
+		var recovering []string
+		for _, instance := range record.Instances {
+			if instanceStatusMap[instance] == "stopped" {
+				recovering = append(recovering, instance)
+			}
+		}
+		if len(recovering) > 0 {
+			if response = startAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, recovering); !response.Success {
+				return response
+			}
+		}
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return spec.Success()
+}
+
+// check the pid is still the interrupt timer of the experiment, the pid may be reused after the timer exits
+func isAwsInterruptTimer(pid int, uid string) bool {
+	cmdline, _err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+	if _err != nil {
+		return false
+	}
+	args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+	var isInterrupt, isExperiment bool
+	for i := 0; i+1 < len(args); i++ {
+		switch {
+		case args[i] == "--type" && args[i+1] == "interrupt":
+			isInterrupt = true
+		case args[i] == "--uid" && args[i+1] == uid:
+			isExperiment = true
+		}
+	}
+	return isInterrupt && isExperiment
+}
+
+// create tags of instances
+func createAwsTags(ctx context.Context, accessKeyId, accessKeySecret, regionId string, instances []string, tags []types.Tag) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	_, _err = client.CreateTags(context.TODO(), &ec2.CreateTagsInput{
+		Resources: instances,
+		Tags:      tags,
+	})
+	if _err != nil {
+		log.Errorf(ctx, "create aws tags failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws tags failed")
+	}
+	return spec.Success()
+}
+
+// delete tags of instances by keys
+func deleteAwsTags(ctx context.Context, accessKeyId, accessKeySecret, regionId string, instances, keys []string) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	var tags []types.Tag
+	for _, key := range keys {
+		tags = append(tags, types.Tag{Key: aws.String(key)})
+	}
+	_, _err = client.DeleteTags(context.TODO(), &ec2.DeleteTagsInput{
+		Resources: instances,
+		Tags:      tags,
+	})
+	if _err != nil {
+		log.Errorf(ctx, "delete aws tags failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "delete aws tags failed")
+	}
+	return spec.Success()
+}
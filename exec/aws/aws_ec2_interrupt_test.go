@@ -0,0 +1,80 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"os"
+	osexec "os/exec"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+func TestAwsEcsInterrupt(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := interruptAwsInstances(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "us-west-2", []string{"instance1", "instance2"}, "stop", 2*time.Minute)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsEcsInterruptTags(t *testing.T) {
+	noticeTime := time.Date(2020, 1, 1, 8, 0, 0, 0, time.UTC)
+	tags := awsInterruptTags("terminate", noticeTime, noticeTime.Add(2*time.Minute))
+	assert.Equal(t, ec2RebalanceTagKey, aws.ToString(tags[0].Key), "they should be equal")
+	assert.Equal(t, `{"noticeTime":"2020-01-01T08:00:00Z"}`, aws.ToString(tags[0].Value), "they should be equal")
+	assert.Equal(t, ec2InstanceActionTagKey, aws.ToString(tags[1].Key), "they should be equal")
+	assert.Equal(t, `{"action":"terminate","time":"2020-01-01T08:02:00Z"}`, aws.ToString(tags[1].Value), "they should be equal")
+}
+
+func TestAwsEcsInterruptTimerCommand(t *testing.T) {
+	cmd := awsInterruptTimerCommand("/opt/chaosblade/bin/chaos_cloud", "123", "accessKeyId", "accessKeySecret", "us-west-2", []string{"instance1", "instance2"}, "stop", time.Date(2020, 1, 1, 8, 2, 0, 0, time.UTC))
+	assert.Equal(t, []string{"/opt/chaosblade/bin/chaos_cloud", "create", "aws", "ec2", "--type", "interrupt", "--regionId", "us-west-2",
+		"--instances", "instance1,instance2", "--interruptAction", "stop", "--confirmTerminate", "true", "--uid", "123"}, cmd.Args, "they should be equal")
+	assert.NotContains(t, cmd.Args, "accessKeySecret")
+	assert.Contains(t, cmd.Env, "ACCESS_KEY_SECRET=accessKeySecret")
+	assert.Contains(t, cmd.Env, ec2InterruptTimerEnv+"=2020-01-01T08:02:00Z")
+	assert.True(t, cmd.SysProcAttr.Setsid)
+}
+
+func TestAwsEcsInterruptIsTimer(t *testing.T) {
+	cmd := osexec.Command("sh", "-c", "sleep 10", "--type", "interrupt", "--uid", "123")
+	assert.Nil(t, cmd.Start())
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	assert.True(t, isAwsInterruptTimer(cmd.Process.Pid, "123"))
+	assert.False(t, isAwsInterruptTimer(cmd.Process.Pid, "456"))
+	assert.False(t, isAwsInterruptTimer(os.Getpid(), "123"))
+}
+
+func TestAwsEcsInterruptTimer(t *testing.T) {
+	result := runAwsInterruptTimer(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", []string{"instance1"}, "terminate", time.Now().UTC().Format(time.RFC3339))
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsEcsInterruptStopWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := (&Ec2Executor{}).stopInterrupt(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "us-west-2")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
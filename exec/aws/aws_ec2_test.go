@@ -29,7 +29,7 @@ func TestAwsEcsStart(t *testing.T) {
 }
 
 func TestAwsEcsStop(t *testing.T) {
-	result := stopAwsInstances(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", []string{"instance1", "instance2", "instance3"})
+	result := stopAwsInstances(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", []string{"instance1", "instance2", "instance3"}, false, false)
 	assert.Equal(t, int32(56002), result.Code, "they should be equal")
 }
 
@@ -38,8 +38,18 @@ func TestAwsEcsReboot(t *testing.T) {
 	assert.Equal(t, int32(56002), result.Code, "they should be equal")
 }
 
-func TestAwsEcsDelete(t *testing.T) {
-	result := deleteAwsInstances(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", []string{"instance1", "instance2", "instance3"})
+func TestAwsEcsForceStop(t *testing.T) {
+	result := stopAwsInstances(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", []string{"instance1", "instance2", "instance3"}, true, false)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsEcsHibernate(t *testing.T) {
+	result := stopAwsInstances(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", []string{"instance1", "instance2", "instance3"}, false, true)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsEcsTerminate(t *testing.T) {
+	result := terminateAwsInstances(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", []string{"instance1", "instance2", "instance3"})
 	assert.Equal(t, int32(56002), result.Code, "they should be equal")
 }
 
@@ -47,3 +57,8 @@ func TestAwsEcsDescribe(t *testing.T) {
 	_, _err := describeInstancesStatus(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", []string{"instance1", "instance2", "instance3"})
 	assert.NotNil(t, _err, "they should be equal")
 }
+
+func TestAwsEcsDescribeSettled(t *testing.T) {
+	_, _err := describeSettledInstancesStatus(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", []string{"instance1", "instance2", "instance3"})
+	assert.NotNil(t, _err, "they should be equal")
+}
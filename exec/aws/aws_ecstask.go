@@ -0,0 +1,261 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const EcsTaskBin = "chaos_aws_ecstask"
+
+type EcsTaskActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewEcsTaskActionSpec() spec.ExpActionCommandSpec {
+	return &EcsTaskActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of ecs tasks, support stop",
+				},
+				&spec.ExpFlag{
+					Name: "cluster",
+					Desc: "the name or arn of ecs cluster",
+				},
+				&spec.ExpFlag{
+					Name: "serviceName",
+					Desc: "the name of ecs service",
+				},
+				&spec.ExpFlag{
+					Name: "count",
+					Desc: "the count of running tasks to stop",
+				},
+				&spec.ExpFlag{
+					Name: "percent",
+					Desc: "the percent of running tasks to stop, used if count is not provided",
+				},
+			},
+			ActionExecutor: &EcsTaskExecutor{},
+			ActionExample: `
+# stop 2 running tasks of service svc-x in cluster c-x, the service starts new tasks to heal
+blade create aws ecsTask --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type stop --cluster c-x --serviceName svc-x --count 2
+
+# stop 50 percent of the running tasks of service svc-x in cluster c-x
+blade create aws ecsTask --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type stop --cluster c-x --serviceName svc-x --percent 50`,
+			ActionPrograms:   []string{EcsTaskBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.EcsTask},
+		},
+	}
+}
+
+func (*EcsTaskActionSpec) Name() string {
+	return "ecsTask"
+}
+
+func (*EcsTaskActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*EcsTaskActionSpec) ShortDesc() string {
+	return "do some aws ecs task Operations, like stop"
+}
+
+func (b *EcsTaskActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws ecs task Operations, like stop the running tasks of service. " +
+		"The stopped tasks are replaced by the service scheduler, so nothing is recovered on destroy"
+}
+
+type EcsTaskExecutor struct {
+	channel spec.Channel
+}
+
+func (*EcsTaskExecutor) Name() string {
+	return "ecsTask"
+}
+
+func (be *EcsTaskExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	cluster := model.ActionFlags["cluster"]
+	serviceName := model.ActionFlags["serviceName"]
+	count := model.ActionFlags["count"]
+	percent := model.ActionFlags["percent"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if operationType != "stop" {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support stop)")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		// the stopped tasks are replaced by the service scheduler
+		log.Infof(ctx, "nothing to recover for stopped ecs tasks of experiment %s", uid)
+		return spec.Success()
+	}
+
+	if cluster == "" {
+		log.Errorf(ctx, "cluster is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "cluster")
+	}
+
+	if serviceName == "" {
+		log.Errorf(ctx, "serviceName is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "serviceName")
+	}
+
+	if count == "" && percent == "" {
+		log.Errorf(ctx, "count or percent is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "count|percent")
+	}
+	countValue, percentValue := 0, 0
+	var err error
+	if count != "" {
+		if countValue, err = strconv.Atoi(count); err != nil || countValue <= 0 {
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "count", count, "it must be a positive integer")
+		}
+	} else if percentValue, err = strconv.Atoi(percent); err != nil || percentValue <= 0 || percentValue > 100 {
+		return spec.ResponseFailWithFlags(spec.ParameterIllegal, "percent", percent, "it must be in (0, 100]")
+	}
+	return stopEcsServiceTasks(ctx, uid, accessKeyId, accessKeySecret, regionId, cluster, serviceName, countValue, percentValue)
+}
+
+func (be *EcsTaskExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// stop the running tasks of service picked randomly
+func stopEcsServiceTasks(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId, cluster, serviceName string, count, percent int) *spec.Response {
+	tasks, _err := listEcsServiceTasks(ctx, accessKeyId, accessKeySecret, regionId, cluster, serviceName)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "list ecs tasks failed")
+	}
+	if len(tasks) == 0 {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "serviceName", serviceName, "no running task of the service")
+	}
+	if count == 0 {
+		count = exec.PercentCount(len(tasks), percent)
+	}
+	return stopEcsTasks(ctx, accessKeyId, accessKeySecret, regionId, cluster, exec.PickRandomly(tasks, count), "stopped by chaosblade experiment "+uid)
+}
+
+// stop tasks of cluster
+func stopEcsTasks(ctx context.Context, accessKeyId, accessKeySecret, regionId, cluster string, tasks []string, reason string) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ecs.NewFromConfig(cfg)
+
+	for _, task := range tasks {
+		_, _err = client.StopTask(context.TODO(), &ecs.StopTaskInput{
+			Cluster: aws.String(cluster),
+			Task:    aws.String(task),
+			Reason:  aws.String(reason),
+		})
+		if _err != nil {
+			log.Errorf(ctx, "stop aws ecs task %s failed, err: %s", task, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "stop aws ecs task failed")
+		}
+	}
+	return spec.Success()
+}
+
+// list the running tasks of service
+func listEcsServiceTasks(ctx context.Context, accessKeyId, accessKeySecret, regionId, cluster, serviceName string) (_result []string, _err error) {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	client := ecs.NewFromConfig(cfg)
+
+	paginator := ecs.NewListTasksPaginator(client, &ecs.ListTasksInput{
+		Cluster:       aws.String(cluster),
+		ServiceName:   aws.String(serviceName),
+		DesiredStatus: types.DesiredStatusRunning,
+	})
+	for paginator.HasMorePages() {
+		resp, _err := paginator.NextPage(context.TODO())
+		if _err != nil {
+			log.Errorf(ctx, "list aws ecs tasks failed, err: %s", _err.Error())
+			return nil, _err
+		}
+		_result = append(_result, resp.TaskArns...)
+	}
+	return _result, nil
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwsEcsTaskStopServiceTasks(t *testing.T) {
+	result := stopEcsServiceTasks(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "us-west-2", "c-x", "svc-x", 0, 50)
+	assert.Equal(t, int32(48000), result.Code, "they should be equal")
+}
+
+func TestAwsEcsTaskStop(t *testing.T) {
+	result := stopEcsTasks(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "c-x", []string{"task1"}, "chaosblade")
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsEcsTaskList(t *testing.T) {
+	_, _err := listEcsServiceTasks(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "c-x", "svc-x")
+	assert.NotNil(t, _err, "they should be equal")
+}
@@ -0,0 +1,358 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const EipBin = "chaos_aws_eip"
+
+type EipActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewEipActionSpec() spec.ExpActionCommandSpec {
+	return &EipActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of eip, support disassociate",
+				},
+				&spec.ExpFlag{
+					Name: "allocationId",
+					Desc: "the allocationId list of eip, split by comma",
+				},
+				&spec.ExpFlag{
+					Name: "publicIpAddress",
+					Desc: "the public ip list of eip, split by comma",
+				},
+				&spec.ExpFlag{
+					Name: "instanceId",
+					Desc: "the instanceId which all eips are disassociated from",
+				},
+			},
+			ActionExecutor: &EipExecutor{},
+			ActionExample: `
+# disassociate eip eipalloc-x from its instance or network interface
+blade create aws eip --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type disassociate --allocationId eipalloc-x
+
+# disassociate eip 1.1.1.1
+blade create aws eip --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type disassociate --publicIpAddress 1.1.1.1
+
+# disassociate all eips of instance i-x
+blade create aws eip --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type disassociate --instanceId i-x`,
+			ActionPrograms:   []string{EipBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.Eip},
+		},
+	}
+}
+
+func (*EipActionSpec) Name() string {
+	return "eip"
+}
+
+func (*EipActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*EipActionSpec) ShortDesc() string {
+	return "do some aws eip Operations, like disassociate"
+}
+
+func (b *EipActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws eip Operations, like disassociate the eip from its instance or network interface. " +
+		"The eip is associated to the same network interface and private ip on destroy, " +
+		"the destroy fails if the eip has been associated to another resource in between"
+}
+
+type EipExecutor struct {
+	channel spec.Channel
+}
+
+func (*EipExecutor) Name() string {
+	return "eip"
+}
+
+// eipRecord is the association of eip before it is disassociated
+type eipRecord struct {
+	AllocationId       string `json:"allocationId"`
+	PublicIp           string `json:"publicIp"`
+	InstanceId         string `json:"instanceId,omitempty"`
+	NetworkInterfaceId string `json:"networkInterfaceId,omitempty"`
+	PrivateIpAddress   string `json:"privateIpAddress,omitempty"`
+}
+
+func (be *EipExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	allocationId := model.ActionFlags["allocationId"]
+	publicIpAddress := model.ActionFlags["publicIpAddress"]
+	instanceId := model.ActionFlags["instanceId"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId)
+	}
+
+	if allocationId == "" && publicIpAddress == "" && instanceId == "" {
+		log.Errorf(ctx, "allocationId, publicIpAddress or instanceId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "allocationId|publicIpAddress|instanceId")
+	}
+	return be.start(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, exec.SplitFlag(allocationId), exec.SplitFlag(publicIpAddress), instanceId)
+}
+
+func (be *EipExecutor) start(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId string, allocationIds, publicIps []string, instanceId string) *spec.Response {
+	switch operationType {
+	case "disassociate":
+		return disassociateAwsAddresses(ctx, uid, accessKeyId, accessKeySecret, regionId, allocationIds, publicIps, instanceId)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support disassociate)")
+	}
+}
+
+func (be *EipExecutor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	switch operationType {
+	case "disassociate":
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support disassociate)")
+	}
+	var records []eipRecord
+	exist, _err := exec.LoadRecord(uid, &records)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	response := associateAwsAddresses(ctx, accessKeyId, accessKeySecret, regionId, records)
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *EipExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// disassociate the eips and record their associations
+func disassociateAwsAddresses(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId string, allocationIds, publicIps []string, instanceId string) *spec.Response {
+	addresses, _err := describeAwsAddresses(ctx, accessKeyId, accessKeySecret, regionId, allocationIds, publicIps, instanceId)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe addresses failed")
+	}
+	var records []eipRecord
+	var associations []string
+	for _, address := range addresses {
+		if address.AssociationId == nil {
+			log.Errorf(ctx, "eip %s is not associated", aws.ToString(address.PublicIp))
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "allocationId", aws.ToString(address.AllocationId), "the eip is not associated")
+		}
+		records = append(records, eipRecord{
+			AllocationId:       aws.ToString(address.AllocationId),
+			PublicIp:           aws.ToString(address.PublicIp),
+			InstanceId:         aws.ToString(address.InstanceId),
+			NetworkInterfaceId: aws.ToString(address.NetworkInterfaceId),
+			PrivateIpAddress:   aws.ToString(address.PrivateIpAddress),
+		})
+		associations = append(associations, aws.ToString(address.AssociationId))
+	}
+	if len(records) == 0 {
+		log.Errorf(ctx, "no eip found")
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "allocationId|publicIpAddress|instanceId", instanceId, "no eip found")
+	}
+	if _err = exec.SaveRecord(uid, records); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	for _, association := range associations {
+		_, _err = client.DisassociateAddress(context.TODO(), &ec2.DisassociateAddressInput{
+			AssociationId: aws.String(association),
+		})
+		if _err != nil {
+			log.Errorf(ctx, "disassociate aws address failed, err: %s", _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "disassociate aws address failed")
+		}
+	}
+	return spec.Success()
+}
+
+// associate the eips to the recorded network interfaces and private ips
+func associateAwsAddresses(ctx context.Context, accessKeyId, accessKeySecret, regionId string, records []eipRecord) *spec.Response {
+	var allocationIds []string
+	for _, record := range records {
+		allocationIds = append(allocationIds, record.AllocationId)
+	}
+	addresses, _err := describeAwsAddresses(ctx, accessKeyId, accessKeySecret, regionId, allocationIds, nil, "")
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe addresses failed")
+	}
+	current := make(map[string]types.Address, len(addresses))
+	for _, address := range addresses {
+		current[aws.ToString(address.AllocationId)] = address
+	}
+
+	var pending []eipRecord
+	for _, record := range records {
+		address, ok := current[record.AllocationId]
+		if !ok {
+			log.Errorf(ctx, "eip %s has been released", record.PublicIp)
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "allocationId", record.AllocationId, "the eip has been released")
+		}
+		if address.AssociationId == nil {
+			pending = append(pending, record)
+			continue
+		}
+		if aws.ToString(address.NetworkInterfaceId) == record.NetworkInterfaceId &&
+			aws.ToString(address.InstanceId) == record.InstanceId &&
+			aws.ToString(address.PrivateIpAddress) == record.PrivateIpAddress {
+			continue
+		}
+		owner := aws.ToString(address.NetworkInterfaceId)
+		if owner == "" {
+			owner = aws.ToString(address.InstanceId)
+		}
+		log.Errorf(ctx, "eip %s has been associated to %s", record.PublicIp, owner)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "allocationId", record.AllocationId,
+			fmt.Sprintf("the eip has been associated to %s", owner))
+	}
+
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	for _, record := range pending {
+		input := &ec2.AssociateAddressInput{
+			AllocationId:       aws.String(record.AllocationId),
+			AllowReassociation: aws.Bool(false),
+		}
+		if record.NetworkInterfaceId != "" {
+			input.NetworkInterfaceId = aws.String(record.NetworkInterfaceId)
+			input.PrivateIpAddress = aws.String(record.PrivateIpAddress)
+		} else {
+			input.InstanceId = aws.String(record.InstanceId)
+		}
+		_, _err = client.AssociateAddress(context.TODO(), input)
+		if _err != nil {
+			log.Errorf(ctx, "associate aws address %s failed, err: %s", record.PublicIp, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "associate aws address failed")
+		}
+	}
+	return spec.Success()
+}
+
+// describe addresses by allocation id, public ip or the instance associated to
+func describeAwsAddresses(ctx context.Context, accessKeyId, accessKeySecret, regionId string, allocationIds, publicIps []string, instanceId string) (_result []types.Address, _err error) {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	input := &ec2.DescribeAddressesInput{
+		AllocationIds: allocationIds,
+		PublicIps:     publicIps,
+	}
+	if instanceId != "" {
+		input.Filters = []types.Filter{{Name: aws.String("instance-id"), Values: []string{instanceId}}}
+	}
+	resp, _err := client.DescribeAddresses(context.TODO(), input)
+	if _err != nil {
+		log.Errorf(ctx, "describe aws addresses failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	_result = resp.Addresses
+	return _result, _err
+}
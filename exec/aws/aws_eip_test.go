@@ -0,0 +1,51 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+func TestAwsEipDisassociate(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := disassociateAwsAddresses(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "us-west-2", []string{"eipalloc-1"}, nil, "")
+	assert.Equal(t, int32(48000), result.Code, "they should be equal")
+}
+
+func TestAwsEipAssociate(t *testing.T) {
+	result := associateAwsAddresses(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2",
+		[]eipRecord{{AllocationId: "eipalloc-1", PublicIp: "1.1.1.1", NetworkInterfaceId: "eni-1", PrivateIpAddress: "10.0.0.1"}})
+	assert.Equal(t, int32(48000), result.Code, "they should be equal")
+}
+
+func TestAwsEipDescribe(t *testing.T) {
+	_, _err := describeAwsAddresses(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", nil, []string{"1.1.1.1"}, "")
+	assert.NotNil(t, _err, "they should be equal")
+}
+
+func TestAwsEipStopWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := (&EipExecutor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", "disassociate", "accessKeyId", "accessKeySecret", "us-west-2")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
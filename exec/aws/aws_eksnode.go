@@ -0,0 +1,322 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const EksNodeBin = "chaos_aws_eksnode"
+
+type EksNodeActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewEksNodeActionSpec() spec.ExpActionCommandSpec {
+	return &EksNodeActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of eks nodes, support stop, terminate",
+				},
+				&spec.ExpFlag{
+					Name: "clusterName",
+					Desc: "the name of eks cluster",
+				},
+				&spec.ExpFlag{
+					Name: "nodegroupName",
+					Desc: "the name of eks managed node group",
+				},
+				&spec.ExpFlag{
+					Name: "count",
+					Desc: "the count of in-service nodes to operate",
+				},
+				&spec.ExpFlag{
+					Name: "percent",
+					Desc: "the percent of in-service nodes to operate, used if count is not provided",
+				},
+				&spec.ExpFlag{
+					Name:    "force",
+					Desc:    "force the nodes to stop without flushing file system caches when operationType is stop, default is false",
+					Default: "false",
+				},
+				&spec.ExpFlag{
+					Name:    "confirmTerminate",
+					Desc:    "confirm to terminate the nodes when operationType is terminate, it must be true because terminated nodes can not be recovered",
+					Default: "false",
+				},
+			},
+			ActionExecutor: &EksNodeExecutor{},
+			ActionExample: `
+# stop 1 node of node group ng-x in cluster c-x
+blade create aws eksNode --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type stop --clusterName c-x --nodegroupName ng-x --count 1
+
+# terminate 30 percent of the nodes of node group ng-x in cluster c-x, the node group launches new nodes to heal
+blade create aws eksNode --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type terminate --clusterName c-x --nodegroupName ng-x --percent 30 --confirmTerminate true`,
+			ActionPrograms:   []string{EksNodeBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.EksNode},
+		},
+	}
+}
+
+func (*EksNodeActionSpec) Name() string {
+	return "eksNode"
+}
+
+func (*EksNodeActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*EksNodeActionSpec) ShortDesc() string {
+	return "do some aws eks node Operations, like stop, terminate"
+}
+
+func (b *EksNodeActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws eks node Operations, like stop, terminate the ec2 nodes of managed node group. " +
+		"The stopped nodes are started on destroy, but they may be replaced before it if the auto scaling group checks the health of instances, " +
+		"suspend the HealthCheck process by the asg action to keep them. The terminated nodes are replaced by the node group"
+}
+
+type EksNodeExecutor struct {
+	channel spec.Channel
+}
+
+func (*EksNodeExecutor) Name() string {
+	return "eksNode"
+}
+
+// eksNodeRecord is the nodes stopped by the experiment
+type eksNodeRecord struct {
+	Instances []string `json:"instances"`
+}
+
+func (be *EksNodeExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	clusterName := model.ActionFlags["clusterName"]
+	nodegroupName := model.ActionFlags["nodegroupName"]
+	count := model.ActionFlags["count"]
+	percent := model.ActionFlags["percent"]
+	force := model.ActionFlags["force"] == "true"
+	confirmTerminate := model.ActionFlags["confirmTerminate"] == "true"
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId)
+	}
+
+	switch operationType {
+	case "stop", "terminate":
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support stop, terminate)")
+	}
+
+	if clusterName == "" {
+		log.Errorf(ctx, "clusterName is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "clusterName")
+	}
+
+	if nodegroupName == "" {
+		log.Errorf(ctx, "nodegroupName is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "nodegroupName")
+	}
+
+	if operationType == "terminate" && !confirmTerminate {
+		log.Errorf(ctx, "confirmTerminate must be true when operationType is terminate, the terminated nodes can not be recovered!")
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "confirmTerminate", model.ActionFlags["confirmTerminate"], "it must be true to terminate nodes")
+	}
+
+	if count == "" && percent == "" {
+		log.Errorf(ctx, "count or percent is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "count|percent")
+	}
+	countValue, percentValue := 0, 0
+	var err error
+	if count != "" {
+		if countValue, err = strconv.Atoi(count); err != nil || countValue <= 0 {
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "count", count, "it must be a positive integer")
+		}
+	} else if percentValue, err = strconv.Atoi(percent); err != nil || percentValue <= 0 || percentValue > 100 {
+		return spec.ResponseFailWithFlags(spec.ParameterIllegal, "percent", percent, "it must be in (0, 100]")
+	}
+	return be.start(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, clusterName, nodegroupName, countValue, percentValue, force)
+}
+
+func (be *EksNodeExecutor) start(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId, clusterName, nodegroupName string, count, percent int, force bool) *spec.Response {
+	instances, _err := describeEksNodegroupInstances(ctx, accessKeyId, accessKeySecret, regionId, clusterName, nodegroupName)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe eks node group instances failed")
+	}
+	if len(instances) == 0 {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "nodegroupName", nodegroupName, "no in-service node in the node group")
+	}
+	if count == 0 {
+		count = exec.PercentCount(len(instances), percent)
+	}
+	instances = exec.PickRandomly(instances, count)
+	if operationType == "terminate" {
+		return terminateAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instances)
+	}
+	if _err = exec.SaveRecord(uid, eksNodeRecord{Instances: instances}); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	return stopAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, instances, force, false)
+}
+
+func (be *EksNodeExecutor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	switch operationType {
+	case "stop":
+	case "terminate":
+		// the terminated nodes are replaced by the node group
+		log.Infof(ctx, "nothing to recover for terminated eks nodes of experiment %s", uid)
+		return spec.Success()
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support stop, terminate)")
+	}
+	var record eksNodeRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	instanceStatusMap, _err := describeSettledInstancesStatus(ctx, accessKeyId, accessKeySecret, regionId, record.Instances)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe instances status failed")
+	}
+	// the nodes replaced by the node group are gone, only the stopped ones are started
+	var recovering []string
+	for _, instance := range record.Instances {
+		if instanceStatusMap[instance] == "stopped" {
+			recovering = append(recovering, instance)
+		}
+	}
+	if len(recovering) > 0 {
+		if response := startAwsInstances(ctx, accessKeyId, accessKeySecret, regionId, recovering); !response.Success {
+			return response
+		}
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return spec.Success()
+}
+
+func (be *EksNodeExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// describe the in-service instances of the auto scaling groups behind the managed node group
+func describeEksNodegroupInstances(ctx context.Context, accessKeyId, accessKeySecret, regionId, clusterName, nodegroupName string) (_result []string, _err error) {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	client := eks.NewFromConfig(cfg)
+
+	resp, _err := client.DescribeNodegroup(context.TODO(), &eks.DescribeNodegroupInput{
+		ClusterName:   aws.String(clusterName),
+		NodegroupName: aws.String(nodegroupName),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "describe aws eks node group failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	if resp.Nodegroup == nil || resp.Nodegroup.Resources == nil {
+		_err = fmt.Errorf("the resources of node group %s are not found", nodegroupName)
+		log.Errorf(ctx, "describe aws eks node group failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	for _, autoScalingGroup := range resp.Nodegroup.Resources.AutoScalingGroups {
+		group, _err := describeAutoScalingGroup(ctx, accessKeyId, accessKeySecret, regionId, aws.ToString(autoScalingGroup.Name))
+		if _err != nil {
+			return nil, _err
+		}
+		for _, instance := range group.Instances {
+			if instance.LifecycleState == types.LifecycleStateInService {
+				_result = append(_result, aws.ToString(instance.InstanceId))
+			}
+		}
+	}
+	return _result, nil
+}
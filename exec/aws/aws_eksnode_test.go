@@ -0,0 +1,50 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+func TestAwsEksNodeStart(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := (&EksNodeExecutor{}).start(context.WithValue(context.Background(), "uid", "123"), "123", "stop", "accessKeyId", "accessKeySecret", "us-west-2", "c-x", "ng-x", 1, 0, false)
+	assert.Equal(t, int32(48000), result.Code, "they should be equal")
+}
+
+func TestAwsEksNodeDescribe(t *testing.T) {
+	_, _err := describeEksNodegroupInstances(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "c-x", "ng-x")
+	assert.NotNil(t, _err, "they should be equal")
+}
+
+func TestAwsEksNodeStopTerminated(t *testing.T) {
+	result := (&EksNodeExecutor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", "terminate", "accessKeyId", "accessKeySecret", "us-west-2")
+	assert.True(t, result.Success)
+}
+
+func TestAwsEksNodeStopWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := (&EksNodeExecutor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", "stop", "accessKeyId", "accessKeySecret", "us-west-2")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
@@ -0,0 +1,405 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	elb "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const ElbBin = "chaos_aws_elb"
+
+type ElbActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewElbActionSpec() spec.ExpActionCommandSpec {
+	return &ElbActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of load balancer target group, support deregister",
+				},
+				&spec.ExpFlag{
+					Name: "targetGroupArn",
+					Desc: "the arn of application or network load balancer target group",
+				},
+				&spec.ExpFlag{
+					Name: "targetId",
+					Desc: "the target list to deregister, like instance id or ip address, split by comma",
+				},
+				&spec.ExpFlag{
+					Name: "tagKey",
+					Desc: "the tag key of instances to deregister",
+				},
+				&spec.ExpFlag{
+					Name: "tagValue",
+					Desc: "the tag value of instances to deregister, used with tagKey",
+				},
+				&spec.ExpFlag{
+					Name: "count",
+					Desc: "the count of the matched targets to deregister",
+				},
+				&spec.ExpFlag{
+					Name: "percent",
+					Desc: "the percent of the matched targets to deregister, used if count is not provided",
+				},
+			},
+			ActionExecutor: &ElbExecutor{},
+			ActionExample: `
+# deregister instance i-x from target group arn:aws:elasticloadbalancing:us-west-2:123456789012:targetgroup/tg/x
+blade create aws elb --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type deregister --targetGroupArn arn:aws:elasticloadbalancing:us-west-2:123456789012:targetgroup/tg/x --targetId i-x
+
+# deregister the targets which instances are tagged with env=test
+blade create aws elb --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type deregister --targetGroupArn arn:aws:elasticloadbalancing:us-west-2:123456789012:targetgroup/tg/x --tagKey env --tagValue test
+
+# deregister 50 percent of the targets of the target group
+blade create aws elb --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type deregister --targetGroupArn arn:aws:elasticloadbalancing:us-west-2:123456789012:targetgroup/tg/x --percent 50`,
+			ActionPrograms:   []string{ElbBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.Elb},
+		},
+	}
+}
+
+func (*ElbActionSpec) Name() string {
+	return "elb"
+}
+
+func (*ElbActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*ElbActionSpec) ShortDesc() string {
+	return "do some aws elb Operations, like deregister"
+}
+
+func (b *ElbActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws elb Operations, like deregister the targets from the application or network load balancer target group. " +
+		"The targets are registered again with the same ports and availability zones on destroy"
+}
+
+type ElbExecutor struct {
+	channel spec.Channel
+}
+
+func (*ElbExecutor) Name() string {
+	return "elb"
+}
+
+// elbTarget is a target deregistered from the target group
+type elbTarget struct {
+	Id               string `json:"id"`
+	Port             *int32 `json:"port,omitempty"`
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+}
+
+// elbRecord is the targets deregistered from the target group
+type elbRecord struct {
+	TargetGroupArn string      `json:"targetGroupArn"`
+	Targets        []elbTarget `json:"targets"`
+}
+
+func (be *ElbExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	targetGroupArn := model.ActionFlags["targetGroupArn"]
+	targetId := model.ActionFlags["targetId"]
+	tagKey := model.ActionFlags["tagKey"]
+	tagValue := model.ActionFlags["tagValue"]
+	count := model.ActionFlags["count"]
+	percent := model.ActionFlags["percent"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if operationType != "deregister" {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support deregister)")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, accessKeyId, accessKeySecret, regionId)
+	}
+
+	if targetGroupArn == "" {
+		log.Errorf(ctx, "targetGroupArn is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "targetGroupArn")
+	}
+
+	if targetId == "" && tagKey == "" && count == "" && percent == "" {
+		log.Errorf(ctx, "targetId, tagKey, count or percent is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "targetId|tagKey|count|percent")
+	}
+
+	countValue, percentValue := 0, 100
+	var err error
+	if count != "" {
+		if countValue, err = strconv.Atoi(count); err != nil || countValue <= 0 {
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "count", count, "it must be a positive integer")
+		}
+	} else if percent != "" {
+		if percentValue, err = strconv.Atoi(percent); err != nil || percentValue <= 0 || percentValue > 100 {
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "percent", percent, "it must be in (0, 100]")
+		}
+	}
+	return deregisterElbTargets(ctx, uid, accessKeyId, accessKeySecret, regionId, targetGroupArn, exec.SplitFlag(targetId), tagKey, tagValue, countValue, percentValue)
+}
+
+func (be *ElbExecutor) stop(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	var record elbRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	response := registerElbTargets(ctx, accessKeyId, accessKeySecret, regionId, record.TargetGroupArn, record.Targets)
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *ElbExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// deregister the matched targets of target group and record them
+func deregisterElbTargets(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId, targetGroupArn string, targetIds []string, tagKey, tagValue string, count, percent int) *spec.Response {
+	descriptions, _err := describeElbTargetHealth(ctx, accessKeyId, accessKeySecret, regionId, targetGroupArn)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe target health failed")
+	}
+	matched := map[string]bool{}
+	for _, id := range targetIds {
+		matched[id] = true
+	}
+	if tagKey != "" {
+		instances, _err := describeAwsTaggedInstances(ctx, accessKeyId, accessKeySecret, regionId, tagKey, tagValue)
+		if _err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe tagged instances failed")
+		}
+		for _, instance := range instances {
+			matched[instance] = true
+		}
+	}
+
+	var ids []string
+	targets := map[string]elbTarget{}
+	for _, description := range descriptions {
+		if description.Target == nil {
+			continue
+		}
+		if description.TargetHealth != nil && (description.TargetHealth.State == types.TargetHealthStateEnumDraining ||
+			description.TargetHealth.State == types.TargetHealthStateEnumUnavailable) {
+			continue
+		}
+		target := elbTarget{
+			Id:               aws.ToString(description.Target.Id),
+			Port:             description.Target.Port,
+			AvailabilityZone: aws.ToString(description.Target.AvailabilityZone),
+		}
+		if (len(targetIds) > 0 || tagKey != "") && !matched[target.Id] {
+			continue
+		}
+		// a target may be registered with multiple ports
+		key := target.Id + ":" + strconv.Itoa(int(aws.ToInt32(target.Port)))
+		ids = append(ids, key)
+		targets[key] = target
+	}
+	if len(ids) == 0 {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "targetGroupArn", targetGroupArn, "no registered target matched")
+	}
+	if count == 0 {
+		count = exec.PercentCount(len(ids), percent)
+	}
+	record := elbRecord{TargetGroupArn: targetGroupArn}
+	for _, key := range exec.PickRandomly(ids, count) {
+		record.Targets = append(record.Targets, targets[key])
+	}
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := elb.NewFromConfig(cfg)
+
+	_, _err = client.DeregisterTargets(context.TODO(), &elb.DeregisterTargetsInput{
+		TargetGroupArn: aws.String(targetGroupArn),
+		Targets:        elbTargetDescriptions(record.Targets),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "deregister aws elb targets failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "deregister aws elb targets failed")
+	}
+	return spec.Success()
+}
+
+// register targets to target group
+func registerElbTargets(ctx context.Context, accessKeyId, accessKeySecret, regionId, targetGroupArn string, targets []elbTarget) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := elb.NewFromConfig(cfg)
+
+	_, _err = client.RegisterTargets(context.TODO(), &elb.RegisterTargetsInput{
+		TargetGroupArn: aws.String(targetGroupArn),
+		Targets:        elbTargetDescriptions(targets),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "register aws elb targets failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "register aws elb targets failed")
+	}
+	return spec.Success()
+}
+
+func elbTargetDescriptions(targets []elbTarget) []types.TargetDescription {
+	descriptions := make([]types.TargetDescription, 0, len(targets))
+	for _, target := range targets {
+		description := types.TargetDescription{
+			Id:   aws.String(target.Id),
+			Port: target.Port,
+		}
+		if target.AvailabilityZone != "" {
+			description.AvailabilityZone = aws.String(target.AvailabilityZone)
+		}
+		descriptions = append(descriptions, description)
+	}
+	return descriptions
+}
+
+// describe the targets health of target group
+func describeElbTargetHealth(ctx context.Context, accessKeyId, accessKeySecret, regionId, targetGroupArn string) (_result []types.TargetHealthDescription, _err error) {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	client := elb.NewFromConfig(cfg)
+
+	resp, _err := client.DescribeTargetHealth(context.TODO(), &elb.DescribeTargetHealthInput{
+		TargetGroupArn: aws.String(targetGroupArn),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "describe aws elb target health failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	_result = resp.TargetHealthDescriptions
+	return _result, _err
+}
+
+// describe the instances with the tag, any value matches if tagValue is empty
+func describeAwsTaggedInstances(ctx context.Context, accessKeyId, accessKeySecret, regionId, tagKey, tagValue string) (_result []string, _err error) {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	filter := ec2types.Filter{Name: aws.String("tag-key"), Values: []string{tagKey}}
+	if tagValue != "" {
+		filter = ec2types.Filter{Name: aws.String("tag:" + tagKey), Values: []string{tagValue}}
+	}
+	paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{
+		Filters: []ec2types.Filter{filter},
+	})
+	for paginator.HasMorePages() {
+		page, _err := paginator.NextPage(context.TODO())
+		if _err != nil {
+			log.Errorf(ctx, "describe aws tagged instances failed, err: %s", _err.Error())
+			return _result, _err
+		}
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				_result = append(_result, aws.ToString(instance.InstanceId))
+			}
+		}
+	}
+	return _result, _err
+}
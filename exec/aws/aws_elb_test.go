@@ -0,0 +1,61 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+const testTargetGroupArn = "arn:aws:elasticloadbalancing:us-west-2:123456789012:targetgroup/tg/x"
+
+func TestAwsElbDeregister(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := deregisterElbTargets(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "us-west-2", testTargetGroupArn, []string{"instance1"}, "", "", 0, 100)
+	assert.Equal(t, int32(48000), result.Code, "they should be equal")
+}
+
+func TestAwsElbRegister(t *testing.T) {
+	result := registerElbTargets(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", testTargetGroupArn, []elbTarget{{Id: "instance1", Port: aws.Int32(80)}})
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsElbTargetDescriptions(t *testing.T) {
+	descriptions := elbTargetDescriptions([]elbTarget{{Id: "10.0.0.1", Port: aws.Int32(80), AvailabilityZone: "all"}, {Id: "instance1"}})
+	assert.Equal(t, 2, len(descriptions), "they should be equal")
+	assert.Equal(t, "all", aws.ToString(descriptions[0].AvailabilityZone), "they should be equal")
+	assert.Nil(t, descriptions[1].AvailabilityZone)
+	assert.Nil(t, descriptions[1].Port)
+}
+
+func TestAwsElbDescribeTaggedInstances(t *testing.T) {
+	_, _err := describeAwsTaggedInstances(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "env", "test")
+	assert.NotNil(t, _err, "they should be equal")
+}
+
+func TestAwsElbStopWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := (&ElbExecutor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "us-west-2")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
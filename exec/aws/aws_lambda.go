@@ -0,0 +1,354 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const LambdaBin = "chaos_aws_lambda"
+
+type LambdaActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewLambdaActionSpec() spec.ExpActionCommandSpec {
+	return &LambdaActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of lambda function, support throttle, alias",
+				},
+				&spec.ExpFlag{
+					Name: "functionName",
+					Desc: "the name or arn of lambda function",
+				},
+				&spec.ExpFlag{
+					Name:    "concurrency",
+					Desc:    "the reserved concurrency of function when operationType is throttle, 0 throttles all invocations, default is 0",
+					Default: "0",
+				},
+				&spec.ExpFlag{
+					Name: "alias",
+					Desc: "the alias of function to swap when operationType is alias",
+				},
+				&spec.ExpFlag{
+					Name: "version",
+					Desc: "the failing version of function which the alias points to when operationType is alias",
+				},
+			},
+			ActionExecutor: &LambdaExecutor{},
+			ActionExample: `
+# throttle all invocations of function f-x
+blade create aws lambda --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type throttle --functionName f-x
+
+# limit the concurrency of function f-x to 2
+blade create aws lambda --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type throttle --functionName f-x --concurrency 2
+
+# route all traffic of alias live of function f-x to the failing version 3
+blade create aws lambda --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type alias --functionName f-x --alias live --version 3`,
+			ActionPrograms:   []string{LambdaBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.Lambda},
+		},
+	}
+}
+
+func (*LambdaActionSpec) Name() string {
+	return "lambda"
+}
+
+func (*LambdaActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*LambdaActionSpec) ShortDesc() string {
+	return "do some aws lambda Operations, like throttle, alias"
+}
+
+func (b *LambdaActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws lambda Operations, like throttle the function by reserved concurrency, swap the alias to a failing version. " +
+		"The previous reserved concurrency or alias routing is restored on destroy"
+}
+
+type LambdaExecutor struct {
+	channel spec.Channel
+}
+
+func (*LambdaExecutor) Name() string {
+	return "lambda"
+}
+
+// lambdaRecord is the concurrency or alias routing of function before the experiment
+type lambdaRecord struct {
+	FunctionName             string             `json:"functionName"`
+	ReservedConcurrency      *int32             `json:"reservedConcurrency,omitempty"`
+	Alias                    string             `json:"alias,omitempty"`
+	FunctionVersion          string             `json:"functionVersion,omitempty"`
+	AdditionalVersionWeights map[string]float64 `json:"additionalVersionWeights,omitempty"`
+}
+
+func (be *LambdaExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	functionName := model.ActionFlags["functionName"]
+	concurrency := model.ActionFlags["concurrency"]
+	alias := model.ActionFlags["alias"]
+	version := model.ActionFlags["version"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if functionName == "" {
+		log.Errorf(ctx, "functionName is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "functionName")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId)
+	}
+
+	switch operationType {
+	case "throttle":
+		concurrencyValue := 0
+		if concurrency != "" {
+			var err error
+			if concurrencyValue, err = strconv.Atoi(concurrency); err != nil || concurrencyValue < 0 {
+				return spec.ResponseFailWithFlags(spec.ParameterIllegal, "concurrency", concurrency, "it must be a non-negative integer")
+			}
+		}
+		return throttleLambdaFunction(ctx, uid, accessKeyId, accessKeySecret, regionId, functionName, int32(concurrencyValue))
+	case "alias":
+		if alias == "" {
+			log.Errorf(ctx, "alias is required when operationType is alias!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "alias")
+		}
+		if version == "" {
+			log.Errorf(ctx, "version is required when operationType is alias!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "version")
+		}
+		return swapLambdaAlias(ctx, uid, accessKeyId, accessKeySecret, regionId, functionName, alias, version)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support throttle, alias)")
+	}
+}
+
+func (be *LambdaExecutor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	var record lambdaRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	var response *spec.Response
+	switch operationType {
+	case "throttle":
+		response = restoreLambdaConcurrency(ctx, accessKeyId, accessKeySecret, regionId, record.FunctionName, record.ReservedConcurrency)
+	case "alias":
+		response = updateLambdaAlias(ctx, accessKeyId, accessKeySecret, regionId, record.FunctionName, record.Alias, record.FunctionVersion, record.AdditionalVersionWeights)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support throttle, alias)")
+	}
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *LambdaExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// set the reserved concurrency of function, the previous reserved concurrency is saved for destroy
+func throttleLambdaFunction(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId, functionName string, concurrency int32) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := lambda.NewFromConfig(cfg)
+
+	resp, _err := client.GetFunctionConcurrency(context.TODO(), &lambda.GetFunctionConcurrencyInput{
+		FunctionName: aws.String(functionName),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "get aws lambda function concurrency failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "get aws lambda function concurrency failed")
+	}
+	record := lambdaRecord{FunctionName: functionName, ReservedConcurrency: resp.ReservedConcurrentExecutions}
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	_, _err = client.PutFunctionConcurrency(context.TODO(), &lambda.PutFunctionConcurrencyInput{
+		FunctionName:                 aws.String(functionName),
+		ReservedConcurrentExecutions: aws.Int32(concurrency),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "put aws lambda function concurrency failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "put aws lambda function concurrency failed")
+	}
+	return spec.Success()
+}
+
+// restore the reserved concurrency of function, it is deleted if the function had none
+func restoreLambdaConcurrency(ctx context.Context, accessKeyId, accessKeySecret, regionId, functionName string, concurrency *int32) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := lambda.NewFromConfig(cfg)
+
+	if concurrency != nil {
+		_, _err = client.PutFunctionConcurrency(context.TODO(), &lambda.PutFunctionConcurrencyInput{
+			FunctionName:                 aws.String(functionName),
+			ReservedConcurrentExecutions: concurrency,
+		})
+	} else {
+		_, _err = client.DeleteFunctionConcurrency(context.TODO(), &lambda.DeleteFunctionConcurrencyInput{
+			FunctionName: aws.String(functionName),
+		})
+	}
+	if _err != nil {
+		log.Errorf(ctx, "restore aws lambda function concurrency failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "restore aws lambda function concurrency failed")
+	}
+	return spec.Success()
+}
+
+// point all traffic of the alias to the version, the previous routing is saved for destroy
+func swapLambdaAlias(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId, functionName, alias, version string) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := lambda.NewFromConfig(cfg)
+
+	resp, _err := client.GetAlias(context.TODO(), &lambda.GetAliasInput{
+		FunctionName: aws.String(functionName),
+		Name:         aws.String(alias),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "get aws lambda alias failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "get aws lambda alias failed")
+	}
+	record := lambdaRecord{
+		FunctionName:    functionName,
+		Alias:           alias,
+		FunctionVersion: aws.ToString(resp.FunctionVersion),
+	}
+	if resp.RoutingConfig != nil {
+		record.AdditionalVersionWeights = resp.RoutingConfig.AdditionalVersionWeights
+	}
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	return updateLambdaAlias(ctx, accessKeyId, accessKeySecret, regionId, functionName, alias, version, nil)
+}
+
+// update the version and additional version weights of alias
+func updateLambdaAlias(ctx context.Context, accessKeyId, accessKeySecret, regionId, functionName, alias, version string, weights map[string]float64) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := lambda.NewFromConfig(cfg)
+
+	if weights == nil {
+		// an empty routing configuration removes the additional versions
+		weights = map[string]float64{}
+	}
+	_, _err = client.UpdateAlias(context.TODO(), &lambda.UpdateAliasInput{
+		FunctionName:    aws.String(functionName),
+		Name:            aws.String(alias),
+		FunctionVersion: aws.String(version),
+		RoutingConfig:   &types.AliasRoutingConfiguration{AdditionalVersionWeights: weights},
+	})
+	if _err != nil {
+		log.Errorf(ctx, "update aws lambda alias failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "update aws lambda alias failed")
+	}
+	return spec.Success()
+}
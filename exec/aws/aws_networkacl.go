@@ -0,0 +1,403 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const NetworkAclBin = "chaos_aws_networkacl"
+
+type NetworkAclActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewNetworkAclActionSpec() spec.ExpActionCommandSpec {
+	return &NetworkAclActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of network acl, support deny",
+				},
+				&spec.ExpFlag{
+					Name: "subnetId",
+					Desc: "the subnetId list which traffic is denied, split by comma",
+				},
+				&spec.ExpFlag{
+					Name: "vpcId",
+					Desc: "the vpcId which subnets in the zone are denied, used with zoneId",
+				},
+				&spec.ExpFlag{
+					Name: "zoneId",
+					Desc: "the availability zone which subnets of the vpc are denied, like us-west-2a",
+				},
+			},
+			ActionExecutor: &NetworkAclExecutor{},
+			ActionExample: `
+# deny all traffic of subnet subnet-x and subnet-y
+blade create aws networkAcl --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type deny --subnetId subnet-x,subnet-y
+
+# deny all traffic of the subnets of vpc vpc-x in availability zone us-west-2a
+blade create aws networkAcl --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type deny --vpcId vpc-x --zoneId us-west-2a`,
+			ActionPrograms:   []string{NetworkAclBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.NetworkAcl},
+		},
+	}
+}
+
+func (*NetworkAclActionSpec) Name() string {
+	return "networkAcl"
+}
+
+func (*NetworkAclActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*NetworkAclActionSpec) ShortDesc() string {
+	return "do some aws networkAcl Operations, like deny"
+}
+
+func (b *NetworkAclActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws networkAcl Operations, like deny all traffic of the subnets by associating them with a temporary deny-all network acl, " +
+		"which partitions an availability zone when all subnets of the zone are chosen. " +
+		"The original network acls are associated again and the temporary one is deleted on destroy"
+}
+
+type NetworkAclExecutor struct {
+	channel spec.Channel
+}
+
+func (*NetworkAclExecutor) Name() string {
+	return "networkAcl"
+}
+
+// subnetNetworkAcl is the network acl associated with a subnet before the experiment
+type subnetNetworkAcl struct {
+	SubnetId     string `json:"subnetId"`
+	NetworkAclId string `json:"networkAclId"`
+}
+
+// networkAclRecord is the temporary network acl and the original associations it replaced
+type networkAclRecord struct {
+	NetworkAclId string             `json:"networkAclId"`
+	Associations []subnetNetworkAcl `json:"associations"`
+}
+
+func (be *NetworkAclExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	subnetId := model.ActionFlags["subnetId"]
+	vpcId := model.ActionFlags["vpcId"]
+	zoneId := model.ActionFlags["zoneId"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if operationType != "deny" {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support deny)")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, accessKeyId, accessKeySecret, regionId)
+	}
+
+	if subnetId == "" && (vpcId == "" || zoneId == "") {
+		log.Errorf(ctx, "subnetId or vpcId with zoneId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "subnetId|vpcId,zoneId")
+	}
+	return denySubnets(ctx, uid, accessKeyId, accessKeySecret, regionId, exec.SplitFlag(subnetId), vpcId, zoneId)
+}
+
+func (be *NetworkAclExecutor) stop(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	var record networkAclRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	response := restoreSubnets(ctx, accessKeyId, accessKeySecret, regionId, record)
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *NetworkAclExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// associate the subnets with a temporary deny-all network acl
+func denySubnets(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId string, subnets []string, vpcId, zoneId string) *spec.Response {
+	if len(subnets) == 0 {
+		var _err error
+		subnets, _err = describeAwsZoneSubnets(ctx, accessKeyId, accessKeySecret, regionId, vpcId, zoneId)
+		if _err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe subnets failed")
+		}
+		if len(subnets) == 0 {
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "zoneId", zoneId, fmt.Sprintf("no subnet of vpc %s found in the zone", vpcId))
+		}
+	}
+	acls, _err := describeAwsSubnetNetworkAcls(ctx, accessKeyId, accessKeySecret, regionId, subnets)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe network acls failed")
+	}
+
+	record := networkAclRecord{}
+	associations := map[string]string{}
+	for _, subnet := range subnets {
+		for _, acl := range acls {
+			for _, association := range acl.Associations {
+				if aws.ToString(association.SubnetId) != subnet {
+					continue
+				}
+				if vpcId == "" {
+					vpcId = aws.ToString(acl.VpcId)
+				} else if vpcId != aws.ToString(acl.VpcId) {
+					return spec.ResponseFailWithFlags(spec.ParameterInvalid, "subnetId", subnet, "the subnets must be in the same vpc")
+				}
+				record.Associations = append(record.Associations, subnetNetworkAcl{SubnetId: subnet, NetworkAclId: aws.ToString(acl.NetworkAclId)})
+				associations[subnet] = aws.ToString(association.NetworkAclAssociationId)
+			}
+		}
+		if _, ok := associations[subnet]; !ok {
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "subnetId", subnet, "no network acl associated with the subnet")
+		}
+	}
+
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	// a new network acl denies all inbound and outbound traffic until entries are added
+	acl, _err := client.CreateNetworkAcl(context.TODO(), &ec2.CreateNetworkAclInput{
+		VpcId: aws.String(vpcId),
+		TagSpecifications: []types.TagSpecification{
+			{
+				ResourceType: types.ResourceTypeNetworkAcl,
+				Tags:         []types.Tag{{Key: aws.String("Name"), Value: aws.String(fmt.Sprintf("chaosblade-deny-%s", uid))}},
+			},
+		},
+	})
+	if _err != nil {
+		log.Errorf(ctx, "create aws network acl failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws network acl failed")
+	}
+	record.NetworkAclId = aws.ToString(acl.NetworkAcl.NetworkAclId)
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		deleteAwsNetworkAcl(ctx, client, record.NetworkAclId)
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	for _, association := range record.Associations {
+		response := replaceNetworkAclAssociation(ctx, client, associations[association.SubnetId], record.NetworkAclId)
+		if !response.Success {
+			return response
+		}
+	}
+	return spec.Success()
+}
+
+// associate the subnets with the original network acls and delete the temporary one
+func restoreSubnets(ctx context.Context, accessKeyId, accessKeySecret, regionId string, record networkAclRecord) *spec.Response {
+	var subnets []string
+	for _, association := range record.Associations {
+		subnets = append(subnets, association.SubnetId)
+	}
+	acls, _err := describeAwsSubnetNetworkAcls(ctx, accessKeyId, accessKeySecret, regionId, subnets)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe network acls failed")
+	}
+	associations := map[string]string{}
+	for _, acl := range acls {
+		if aws.ToString(acl.NetworkAclId) != record.NetworkAclId {
+			continue
+		}
+		for _, association := range acl.Associations {
+			associations[aws.ToString(association.SubnetId)] = aws.ToString(association.NetworkAclAssociationId)
+		}
+	}
+
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	for _, association := range record.Associations {
+		associationId, ok := associations[association.SubnetId]
+		if !ok {
+			// the subnet is not associated with the temporary network acl any more
+			continue
+		}
+		response := replaceNetworkAclAssociation(ctx, client, associationId, association.NetworkAclId)
+		if !response.Success {
+			return response
+		}
+	}
+	return deleteAwsNetworkAcl(ctx, client, record.NetworkAclId)
+}
+
+// replace the network acl of association
+func replaceNetworkAclAssociation(ctx context.Context, client *ec2.Client, associationId, networkAclId string) *spec.Response {
+	_, _err := client.ReplaceNetworkAclAssociation(context.TODO(), &ec2.ReplaceNetworkAclAssociationInput{
+		AssociationId: aws.String(associationId),
+		NetworkAclId:  aws.String(networkAclId),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "replace aws network acl association %s failed, err: %s", associationId, _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "replace aws network acl association failed")
+	}
+	return spec.Success()
+}
+
+// delete network acl
+func deleteAwsNetworkAcl(ctx context.Context, client *ec2.Client, networkAclId string) *spec.Response {
+	_, _err := client.DeleteNetworkAcl(context.TODO(), &ec2.DeleteNetworkAclInput{
+		NetworkAclId: aws.String(networkAclId),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "delete aws network acl %s failed, err: %s", networkAclId, _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "delete aws network acl failed")
+	}
+	return spec.Success()
+}
+
+// describe the subnets of vpc in the availability zone
+func describeAwsZoneSubnets(ctx context.Context, accessKeyId, accessKeySecret, regionId, vpcId, zoneId string) (_result []string, _err error) {
+	return describeAwsSubnets(ctx, accessKeyId, accessKeySecret, regionId, []types.Filter{
+		{Name: aws.String("vpc-id"), Values: []string{vpcId}},
+		{Name: aws.String("availability-zone"), Values: []string{zoneId}},
+	})
+}
+
+// describe the ids of subnets matching the filters
+func describeAwsSubnets(ctx context.Context, accessKeyId, accessKeySecret, regionId string, filters []types.Filter) (_result []string, _err error) {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	paginator := ec2.NewDescribeSubnetsPaginator(client, &ec2.DescribeSubnetsInput{
+		Filters: filters,
+	})
+	for paginator.HasMorePages() {
+		page, _err := paginator.NextPage(context.TODO())
+		if _err != nil {
+			log.Errorf(ctx, "describe aws subnets failed, err: %s", _err.Error())
+			return _result, _err
+		}
+		for _, subnet := range page.Subnets {
+			_result = append(_result, aws.ToString(subnet.SubnetId))
+		}
+	}
+	return _result, _err
+}
+
+// describe the network acls associated with the subnets
+func describeAwsSubnetNetworkAcls(ctx context.Context, accessKeyId, accessKeySecret, regionId string, subnets []string) (_result []types.NetworkAcl, _err error) {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	paginator := ec2.NewDescribeNetworkAclsPaginator(client, &ec2.DescribeNetworkAclsInput{
+		Filters: []types.Filter{{Name: aws.String("association.subnet-id"), Values: subnets}},
+	})
+	for paginator.HasMorePages() {
+		page, _err := paginator.NextPage(context.TODO())
+		if _err != nil {
+			log.Errorf(ctx, "describe aws network acls failed, err: %s", _err.Error())
+			return _result, _err
+		}
+		_result = append(_result, page.NetworkAcls...)
+	}
+	return _result, _err
+}
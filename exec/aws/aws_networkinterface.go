@@ -0,0 +1,328 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const NetworkInterfaceBin = "chaos_aws_networkinterface"
+
+// the max time to wait for the detached network interface to be available before reattaching it
+const networkInterfaceAvailableTimeout = 5 * time.Minute
+
+type NetworkInterfaceActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewNetworkInterfaceActionSpec() spec.ExpActionCommandSpec {
+	return &NetworkInterfaceActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of network interface, support detach",
+				},
+				&spec.ExpFlag{
+					Name: "networkInterfaceId",
+					Desc: "the secondary networkInterfaceId list, split by comma",
+				},
+				&spec.ExpFlag{
+					Name:    "force",
+					Desc:    "force the network interface to detach, default is false",
+					Default: "false",
+				},
+			},
+			ActionExecutor: &NetworkInterfaceExecutor{},
+			ActionExample: `
+# detach secondary network interface eni-x from its instance
+blade create aws networkInterface --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type detach --networkInterfaceId eni-x
+
+# force detach secondary network interface eni-x and eni-y
+blade create aws networkInterface --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type detach --networkInterfaceId eni-x,eni-y --force true`,
+			ActionPrograms:   []string{NetworkInterfaceBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.NetworkInterface},
+		},
+	}
+}
+
+func (*NetworkInterfaceActionSpec) Name() string {
+	return "networkInterface"
+}
+
+func (*NetworkInterfaceActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*NetworkInterfaceActionSpec) ShortDesc() string {
+	return "do some aws networkInterface Operations, like detach"
+}
+
+func (b *NetworkInterfaceActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws networkInterface Operations, like detach the secondary network interface from its instance. " +
+		"The network interface is attached to the same instance with the same device index on destroy"
+}
+
+type NetworkInterfaceExecutor struct {
+	channel spec.Channel
+}
+
+func (*NetworkInterfaceExecutor) Name() string {
+	return "networkInterface"
+}
+
+// networkInterfaceRecord is the attachment of network interface before it is detached
+type networkInterfaceRecord struct {
+	NetworkInterfaceId  string `json:"networkInterfaceId"`
+	InstanceId          string `json:"instanceId"`
+	DeviceIndex         int32  `json:"deviceIndex"`
+	NetworkCardIndex    *int32 `json:"networkCardIndex,omitempty"`
+	DeleteOnTermination bool   `json:"deleteOnTermination,omitempty"`
+}
+
+func (be *NetworkInterfaceExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	networkInterfaceId := model.ActionFlags["networkInterfaceId"]
+	force := model.ActionFlags["force"] == "true"
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if operationType != "detach" {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support detach)")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, accessKeyId, accessKeySecret, regionId)
+	}
+
+	if networkInterfaceId == "" {
+		log.Errorf(ctx, "networkInterfaceId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "networkInterfaceId")
+	}
+	return detachAwsNetworkInterfaces(ctx, uid, accessKeyId, accessKeySecret, regionId, exec.SplitFlag(networkInterfaceId), force)
+}
+
+func (be *NetworkInterfaceExecutor) stop(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	var records []networkInterfaceRecord
+	exist, _err := exec.LoadRecord(uid, &records)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	response := attachAwsNetworkInterfaces(ctx, accessKeyId, accessKeySecret, regionId, records)
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *NetworkInterfaceExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// detach the secondary network interfaces and record their attachments
+func detachAwsNetworkInterfaces(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId string, networkInterfaces []string, force bool) *spec.Response {
+	interfaces, _err := describeAwsNetworkInterfaces(ctx, accessKeyId, accessKeySecret, regionId, nil, networkInterfaces)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe network interfaces failed")
+	}
+	var records []networkInterfaceRecord
+	var attachments []string
+	for _, networkInterface := range interfaces {
+		networkInterfaceId := aws.ToString(networkInterface.NetworkInterfaceId)
+		attachment := networkInterface.Attachment
+		if attachment == nil || attachment.Status != types.AttachmentStatusAttached {
+			log.Errorf(ctx, "network interface %s is not attached", networkInterfaceId)
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "networkInterfaceId", networkInterfaceId, "the network interface is not attached")
+		}
+		if aws.ToInt32(attachment.DeviceIndex) == 0 {
+			log.Errorf(ctx, "network interface %s is the primary network interface", networkInterfaceId)
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "networkInterfaceId", networkInterfaceId, "the primary network interface can not be detached")
+		}
+		records = append(records, networkInterfaceRecord{
+			NetworkInterfaceId:  networkInterfaceId,
+			InstanceId:          aws.ToString(attachment.InstanceId),
+			DeviceIndex:         aws.ToInt32(attachment.DeviceIndex),
+			NetworkCardIndex:    attachment.NetworkCardIndex,
+			DeleteOnTermination: aws.ToBool(attachment.DeleteOnTermination),
+		})
+		attachments = append(attachments, aws.ToString(attachment.AttachmentId))
+	}
+	if _err = exec.SaveRecord(uid, records); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	for _, attachment := range attachments {
+		_, _err = client.DetachNetworkInterface(context.TODO(), &ec2.DetachNetworkInterfaceInput{
+			AttachmentId: aws.String(attachment),
+			Force:        aws.Bool(force),
+		})
+		if _err != nil {
+			log.Errorf(ctx, "detach aws network interface failed, err: %s", _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "detach aws network interface failed")
+		}
+	}
+	return spec.Success()
+}
+
+// attach the network interfaces to the recorded instances and device indexes after they are available
+func attachAwsNetworkInterfaces(ctx context.Context, accessKeyId, accessKeySecret, regionId string, records []networkInterfaceRecord) *spec.Response {
+	var networkInterfaces []string
+	for _, record := range records {
+		networkInterfaces = append(networkInterfaces, record.NetworkInterfaceId)
+	}
+	interfaces, _err := describeAwsNetworkInterfaces(ctx, accessKeyId, accessKeySecret, regionId, nil, networkInterfaces)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe network interfaces failed")
+	}
+	attached := map[string]string{}
+	for _, networkInterface := range interfaces {
+		// a detaching network interface is waited to be available and reattached below
+		if networkInterface.Attachment == nil {
+			continue
+		}
+		if networkInterface.Attachment.Status == types.AttachmentStatusAttached || networkInterface.Attachment.Status == types.AttachmentStatusAttaching {
+			attached[aws.ToString(networkInterface.NetworkInterfaceId)] = aws.ToString(networkInterface.Attachment.InstanceId)
+		}
+	}
+
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	waiter := ec2.NewNetworkInterfaceAvailableWaiter(client)
+	for _, record := range records {
+		if instanceId, ok := attached[record.NetworkInterfaceId]; ok {
+			if instanceId == record.InstanceId {
+				// attached by a previous destroy
+				continue
+			}
+			log.Errorf(ctx, "network interface %s has been attached to instance %s", record.NetworkInterfaceId, instanceId)
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "networkInterfaceId", record.NetworkInterfaceId, "the network interface has been attached to "+instanceId)
+		}
+		_err = waiter.Wait(context.TODO(), &ec2.DescribeNetworkInterfacesInput{
+			NetworkInterfaceIds: []string{record.NetworkInterfaceId},
+		}, networkInterfaceAvailableTimeout)
+		if _err != nil {
+			log.Errorf(ctx, "wait aws network interface %s available failed, err: %s", record.NetworkInterfaceId, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "wait aws network interface available failed")
+		}
+		resp, _err := client.AttachNetworkInterface(context.TODO(), &ec2.AttachNetworkInterfaceInput{
+			NetworkInterfaceId: aws.String(record.NetworkInterfaceId),
+			InstanceId:         aws.String(record.InstanceId),
+			DeviceIndex:        aws.Int32(record.DeviceIndex),
+			NetworkCardIndex:   record.NetworkCardIndex,
+		})
+		if _err != nil {
+			log.Errorf(ctx, "attach aws network interface %s failed, err: %s", record.NetworkInterfaceId, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "attach aws network interface failed")
+		}
+		if !record.DeleteOnTermination {
+			continue
+		}
+		// the attached network interface is not deleted on termination by default
+		_, _err = client.ModifyNetworkInterfaceAttribute(context.TODO(), &ec2.ModifyNetworkInterfaceAttributeInput{
+			NetworkInterfaceId: aws.String(record.NetworkInterfaceId),
+			Attachment: &types.NetworkInterfaceAttachmentChanges{
+				AttachmentId:        resp.AttachmentId,
+				DeleteOnTermination: aws.Bool(true),
+			},
+		})
+		if _err != nil {
+			log.Errorf(ctx, "restore delete on termination of aws network interface %s failed, err: %s", record.NetworkInterfaceId, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "restore delete on termination of aws network interface failed")
+		}
+	}
+	return spec.Success()
+}
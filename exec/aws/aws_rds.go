@@ -0,0 +1,367 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const RdsBin = "chaos_aws_rds"
+
+// the interval to poll the status of db instance or cluster
+var rdsPollInterval = 10 * time.Second
+
+const rdsAvailable = "available"
+
+type RdsActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewRdsActionSpec() spec.ExpActionCommandSpec {
+	return &RdsActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of rds, support reboot, failover",
+				},
+				&spec.ExpFlag{
+					Name: "dbInstanceId",
+					Desc: "the identifier of db instance to reboot when operationType is reboot",
+				},
+				&spec.ExpFlag{
+					Name:    "forceFailover",
+					Desc:    "reboot the Multi-AZ db instance with failover when operationType is reboot, default is false",
+					Default: "false",
+				},
+				&spec.ExpFlag{
+					Name: "dbClusterId",
+					Desc: "the identifier of aurora db cluster to fail over when operationType is failover",
+				},
+				&spec.ExpFlag{
+					Name: "targetDbInstanceId",
+					Desc: "the identifier of the reader instance promoted to writer when operationType is failover, chosen by aws if not provided",
+				},
+				&spec.ExpFlag{
+					Name:    "timeout",
+					Desc:    "the seconds to wait for the db instance or cluster to be available again, default is 900",
+					Default: "900",
+				},
+			},
+			ActionExecutor: &RdsExecutor{},
+			ActionExample: `
+# reboot db instance db-x with failover and wait for it to be available again
+blade create aws rds --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type reboot --dbInstanceId db-x --forceFailover true
+
+# fail over aurora cluster cluster-x to reader instance db-y
+blade create aws rds --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type failover --dbClusterId cluster-x --targetDbInstanceId db-y`,
+			ActionPrograms:   []string{RdsBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.Rds},
+		},
+	}
+}
+
+func (*RdsActionSpec) Name() string {
+	return "rds"
+}
+
+func (*RdsActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*RdsActionSpec) ShortDesc() string {
+	return "do some aws rds Operations, like reboot, failover"
+}
+
+func (b *RdsActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws rds Operations, like reboot the db instance with failover, fail over the aurora db cluster. " +
+		"The experiment waits for the db instance or cluster to be available again and reports the measured downtime, " +
+		"there is nothing to recover on destroy"
+}
+
+type RdsExecutor struct {
+	channel spec.Channel
+}
+
+func (*RdsExecutor) Name() string {
+	return "rds"
+}
+
+// rdsResult is the downtime measured by the experiment
+type rdsResult struct {
+	Identifier      string  `json:"identifier"`
+	Downtime        string  `json:"downtime"`
+	DowntimeSeconds float64 `json:"downtimeSeconds"`
+}
+
+func (be *RdsExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	dbInstanceId := model.ActionFlags["dbInstanceId"]
+	forceFailover := model.ActionFlags["forceFailover"] == "true"
+	dbClusterId := model.ActionFlags["dbClusterId"]
+	targetDbInstanceId := model.ActionFlags["targetDbInstanceId"]
+	timeout := model.ActionFlags["timeout"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		// the rebooted or failed over db comes back by itself
+		return spec.Success()
+	}
+
+	timeoutValue := 900
+	if timeout != "" {
+		var err error
+		if timeoutValue, err = strconv.Atoi(timeout); err != nil || timeoutValue <= 0 {
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "timeout", timeout, "it must be a positive integer")
+		}
+	}
+
+	switch operationType {
+	case "reboot":
+		if dbInstanceId == "" {
+			log.Errorf(ctx, "dbInstanceId is required when operationType is reboot!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "dbInstanceId")
+		}
+		return rebootDbInstance(ctx, accessKeyId, accessKeySecret, regionId, dbInstanceId, forceFailover, time.Duration(timeoutValue)*time.Second)
+	case "failover":
+		if dbClusterId == "" {
+			log.Errorf(ctx, "dbClusterId is required when operationType is failover!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "dbClusterId")
+		}
+		return failoverDbCluster(ctx, accessKeyId, accessKeySecret, regionId, dbClusterId, targetDbInstanceId, time.Duration(timeoutValue)*time.Second)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support reboot, failover)")
+	}
+}
+
+func (be *RdsExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// reboot db instance and wait for it to be available again
+func rebootDbInstance(ctx context.Context, accessKeyId, accessKeySecret, regionId, dbInstanceId string, forceFailover bool, timeout time.Duration) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := rds.NewFromConfig(cfg)
+
+	start := time.Now()
+	_, _err = client.RebootDBInstance(context.TODO(), &rds.RebootDBInstanceInput{
+		DBInstanceIdentifier: aws.String(dbInstanceId),
+		ForceFailover:        aws.Bool(forceFailover),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "reboot aws db instance failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "reboot aws db instance failed")
+	}
+	downtime, _err := waitRdsRecovered(ctx, start, timeout, func() (bool, bool, error) {
+		resp, err := client.DescribeDBInstances(context.TODO(), &rds.DescribeDBInstancesInput{
+			DBInstanceIdentifier: aws.String(dbInstanceId),
+		})
+		if err != nil {
+			return false, false, err
+		}
+		if len(resp.DBInstances) == 0 {
+			return false, false, fmt.Errorf("db instance %s not found", dbInstanceId)
+		}
+		available := aws.ToString(resp.DBInstances[0].DBInstanceStatus) == rdsAvailable
+		return available, !available, nil
+	})
+	if _err != nil {
+		log.Errorf(ctx, "wait aws db instance available failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "wait aws db instance available failed")
+	}
+	return rdsDowntime(ctx, dbInstanceId, downtime)
+}
+
+// fail over db cluster and wait for the new writer to be available
+func failoverDbCluster(ctx context.Context, accessKeyId, accessKeySecret, regionId, dbClusterId, targetDbInstanceId string, timeout time.Duration) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := rds.NewFromConfig(cfg)
+
+	writer, readers, _err := describeDbClusterMembers(client, dbClusterId)
+	if _err != nil {
+		log.Errorf(ctx, "describe aws db cluster failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe db cluster failed")
+	}
+	// a failover without any reader, or to the current writer, never changes the writer
+	if len(readers) == 0 {
+		log.Errorf(ctx, "db cluster %s has no reader instance to fail over to", dbClusterId)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "dbClusterId", dbClusterId, "the db cluster has no reader instance")
+	}
+	if targetDbInstanceId != "" && !slices.Contains(readers, targetDbInstanceId) {
+		log.Errorf(ctx, "db instance %s is not a reader of db cluster %s, the writer is %s", targetDbInstanceId, dbClusterId, writer)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "targetDbInstanceId", targetDbInstanceId, "it must be a reader instance of the db cluster")
+	}
+	input := &rds.FailoverDBClusterInput{
+		DBClusterIdentifier: aws.String(dbClusterId),
+	}
+	if targetDbInstanceId != "" {
+		input.TargetDBInstanceIdentifier = aws.String(targetDbInstanceId)
+	}
+	start := time.Now()
+	_, _err = client.FailoverDBCluster(context.TODO(), input)
+	if _err != nil {
+		log.Errorf(ctx, "fail over aws db cluster failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "fail over aws db cluster failed")
+	}
+	downtime, _err := waitRdsRecovered(ctx, start, timeout, func() (bool, bool, error) {
+		resp, err := client.DescribeDBClusters(context.TODO(), &rds.DescribeDBClustersInput{
+			DBClusterIdentifier: aws.String(dbClusterId),
+		})
+		if err != nil {
+			return false, false, err
+		}
+		if len(resp.DBClusters) == 0 {
+			return false, false, fmt.Errorf("db cluster %s not found", dbClusterId)
+		}
+		cluster := resp.DBClusters[0]
+		current := ""
+		for _, member := range cluster.DBClusterMembers {
+			if member.IsClusterWriter {
+				current = aws.ToString(member.DBInstanceIdentifier)
+			}
+		}
+		// the failover is done when another instance becomes the writer
+		changed := current != "" && current != writer
+		return changed && aws.ToString(cluster.Status) == rdsAvailable, changed, nil
+	})
+	if _err != nil {
+		log.Errorf(ctx, "wait aws db cluster failed over failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "wait aws db cluster failed over failed")
+	}
+	return rdsDowntime(ctx, dbClusterId, downtime)
+}
+
+// waitRdsRecovered polls check until it reports available after the fault is observed, and returns the time since start.
+// A fault not observed within three polls is assumed to be shorter than the poll interval.
+func waitRdsRecovered(ctx context.Context, start time.Time, timeout time.Duration, check func() (available, faulted bool, err error)) (time.Duration, error) {
+	observed := false
+	for polls := 1; ; polls++ {
+		available, faulted, err := check()
+		if err != nil {
+			return 0, err
+		}
+		observed = observed || faulted
+		if available && (observed || polls > 3) {
+			return time.Since(start), nil
+		}
+		if time.Since(start) > timeout {
+			return 0, fmt.Errorf("not available after %s", timeout)
+		}
+		log.Debugf(ctx, "waiting for the rds to be available, elapsed %s", time.Since(start))
+		time.Sleep(rdsPollInterval)
+	}
+}
+
+func rdsDowntime(ctx context.Context, identifier string, downtime time.Duration) *spec.Response {
+	downtime = downtime.Round(time.Second)
+	log.Infof(ctx, "%s is available again after %s", identifier, downtime)
+	return spec.ReturnSuccess(rdsResult{
+		Identifier:      identifier,
+		Downtime:        downtime.String(),
+		DowntimeSeconds: downtime.Seconds(),
+	})
+}
+
+// describe the writer and reader instances of db cluster
+func describeDbClusterMembers(client *rds.Client, dbClusterId string) (_writer string, _readers []string, _err error) {
+	resp, _err := client.DescribeDBClusters(context.TODO(), &rds.DescribeDBClustersInput{
+		DBClusterIdentifier: aws.String(dbClusterId),
+	})
+	if _err != nil {
+		return _writer, _readers, _err
+	}
+	if len(resp.DBClusters) == 0 {
+		return _writer, _readers, fmt.Errorf("db cluster %s not found", dbClusterId)
+	}
+	for _, member := range resp.DBClusters[0].DBClusterMembers {
+		if member.IsClusterWriter {
+			_writer = aws.ToString(member.DBInstanceIdentifier)
+		} else {
+			_readers = append(_readers, aws.ToString(member.DBInstanceIdentifier))
+		}
+	}
+	return _writer, _readers, _err
+}
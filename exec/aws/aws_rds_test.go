@@ -0,0 +1,76 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwsRdsReboot(t *testing.T) {
+	result := rebootDbInstance(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "db-1", true, time.Minute)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsRdsFailover(t *testing.T) {
+	result := failoverDbCluster(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "cluster-1", "", time.Minute)
+	assert.Equal(t, int32(48000), result.Code, "they should be equal")
+}
+
+func TestAwsRdsWaitRecovered(t *testing.T) {
+	rdsPollInterval = time.Millisecond
+	defer func() { rdsPollInterval = 10 * time.Second }()
+
+	statuses := []bool{true, false, false, true}
+	polls := 0
+	_, err := waitRdsRecovered(context.Background(), time.Now(), time.Minute, func() (bool, bool, error) {
+		available := statuses[polls]
+		polls++
+		return available, !available, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, polls, "they should be equal")
+
+	// a fault shorter than the poll interval is not observed
+	polls = 0
+	_, err = waitRdsRecovered(context.Background(), time.Now(), time.Minute, func() (bool, bool, error) {
+		polls++
+		return true, false, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, polls, "they should be equal")
+
+	_, err = waitRdsRecovered(context.Background(), time.Now(), 0, func() (bool, bool, error) {
+		return false, true, nil
+	})
+	assert.NotNil(t, err)
+
+	_, err = waitRdsRecovered(context.Background(), time.Now(), time.Minute, func() (bool, bool, error) {
+		return false, false, errors.New("describe failed")
+	})
+	assert.NotNil(t, err)
+}
+
+func TestAwsRdsDowntime(t *testing.T) {
+	result := rdsDowntime(context.Background(), "db-1", 95*time.Second+300*time.Millisecond)
+	assert.True(t, result.Success)
+	assert.Equal(t, rdsResult{Identifier: "db-1", Downtime: "1m35s", DowntimeSeconds: 95}, result.Result, "they should be equal")
+}
@@ -0,0 +1,427 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const Route53Bin = "chaos_aws_route53"
+
+// the ttl of record which is changed from an alias record to the sinkhole values
+const route53SinkholeTTL = 60
+
+type Route53ActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewRoute53ActionSpec() spec.ExpActionCommandSpec {
+	return &Route53ActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of route53, support record, healthCheck",
+				},
+				&spec.ExpFlag{
+					Name: "endpoint",
+					Desc: "the endpoint of route53 compatible service, the aws endpoint is used if not provided",
+				},
+				&spec.ExpFlag{
+					Name: "hostedZoneId",
+					Desc: "the hosted zone id of record when operationType is record",
+				},
+				&spec.ExpFlag{
+					Name: "recordName",
+					Desc: "the name of record when operationType is record",
+				},
+				&spec.ExpFlag{
+					Name:    "recordType",
+					Desc:    "the type of record when operationType is record, default is A",
+					Default: "A",
+				},
+				&spec.ExpFlag{
+					Name: "setIdentifier",
+					Desc: "the set identifier of weighted, latency, failover or geolocation record when operationType is record",
+				},
+				&spec.ExpFlag{
+					Name: "value",
+					Desc: "the sinkhole values of record when operationType is record, separated by comma, e.g. 192.0.2.1",
+				},
+				&spec.ExpFlag{
+					Name: "weight",
+					Desc: "the weight of weighted record when operationType is record",
+				},
+				&spec.ExpFlag{
+					Name: "healthCheckId",
+					Desc: "the id of health check to invert when operationType is healthCheck",
+				},
+			},
+			ActionExecutor: &Route53Executor{},
+			ActionExample: `
+# point the record api.example.com to the sinkhole address 192.0.2.1
+blade create aws route53 --accessKeyId xxx --accessKeySecret yyy --regionId us-east-1 --type record --hostedZoneId Z-x --recordName api.example.com --value 192.0.2.1
+
+# drain the weighted record blue of api.example.com
+blade create aws route53 --accessKeyId xxx --accessKeySecret yyy --regionId us-east-1 --type record --hostedZoneId Z-x --recordName api.example.com --setIdentifier blue --weight 0
+
+# invert the health check hc-x
+blade create aws route53 --accessKeyId xxx --accessKeySecret yyy --regionId us-east-1 --type healthCheck --healthCheckId hc-x`,
+			ActionPrograms:   []string{Route53Bin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.Route53},
+		},
+	}
+}
+
+func (*Route53ActionSpec) Name() string {
+	return "route53"
+}
+
+func (*Route53ActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*Route53ActionSpec) ShortDesc() string {
+	return "do some aws route53 Operations, like record, healthCheck"
+}
+
+func (b *Route53ActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws route53 Operations, like change the value or weight of record to a sinkhole, invert the health check. " +
+		"The original record set or health check is restored on destroy"
+}
+
+type Route53Executor struct {
+	channel spec.Channel
+}
+
+func (*Route53Executor) Name() string {
+	return "route53"
+}
+
+// route53Record is the record set or health check before the experiment
+type route53Record struct {
+	HostedZoneId  string                   `json:"hostedZoneId,omitempty"`
+	RecordSet     *types.ResourceRecordSet `json:"recordSet,omitempty"`
+	HealthCheckId string                   `json:"healthCheckId,omitempty"`
+	Inverted      bool                     `json:"inverted,omitempty"`
+}
+
+func (be *Route53Executor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	endpoint := model.ActionFlags["endpoint"]
+	hostedZoneId := model.ActionFlags["hostedZoneId"]
+	recordName := model.ActionFlags["recordName"]
+	recordType := model.ActionFlags["recordType"]
+	setIdentifier := model.ActionFlags["setIdentifier"]
+	value := model.ActionFlags["value"]
+	weight := model.ActionFlags["weight"]
+	healthCheckId := model.ActionFlags["healthCheckId"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, endpoint)
+	}
+
+	switch operationType {
+	case "record":
+		if hostedZoneId == "" {
+			log.Errorf(ctx, "hostedZoneId is required when operationType is record!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "hostedZoneId")
+		}
+		if recordName == "" {
+			log.Errorf(ctx, "recordName is required when operationType is record!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "recordName")
+		}
+		if recordType == "" {
+			recordType = "A"
+		}
+		if value == "" && weight == "" {
+			log.Errorf(ctx, "value or weight is required when operationType is record!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "value|weight")
+		}
+		var weightValue *int64
+		if weight != "" {
+			w, err := strconv.ParseInt(weight, 10, 64)
+			if err != nil || w < 0 || w > 255 {
+				return spec.ResponseFailWithFlags(spec.ParameterIllegal, "weight", weight, "it must be an integer between 0 and 255")
+			}
+			weightValue = aws.Int64(w)
+		}
+		return changeRoute53Record(ctx, uid, accessKeyId, accessKeySecret, regionId, endpoint, hostedZoneId, recordName,
+			strings.ToUpper(recordType), setIdentifier, exec.SplitFlag(value), weightValue)
+	case "healthCheck":
+		if healthCheckId == "" {
+			log.Errorf(ctx, "healthCheckId is required when operationType is healthCheck!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "healthCheckId")
+		}
+		return invertRoute53HealthCheck(ctx, uid, accessKeyId, accessKeySecret, regionId, endpoint, healthCheckId)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support record, healthCheck)")
+	}
+}
+
+func (be *Route53Executor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId, endpoint string) *spec.Response {
+	var record route53Record
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	var response *spec.Response
+	switch operationType {
+	case "record":
+		response = upsertRoute53RecordSet(ctx, accessKeyId, accessKeySecret, regionId, endpoint, record.HostedZoneId, record.RecordSet)
+	case "healthCheck":
+		response = updateRoute53HealthCheck(ctx, accessKeyId, accessKeySecret, regionId, endpoint, record.HealthCheckId, record.Inverted)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support record, healthCheck)")
+	}
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *Route53Executor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// create route53 client, the endpoint of route53 compatible service is used if provided
+func createRoute53Client(accessKeyId, accessKeySecret, regionId, endpoint string) (*route53.Client, error) {
+	cfg, err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if err != nil {
+		return nil, err
+	}
+	return route53.NewFromConfig(cfg, func(o *route53.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	}), nil
+}
+
+// change the values or weight of record set, the original record set is saved for destroy
+func changeRoute53Record(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId, endpoint, hostedZoneId, recordName, recordType, setIdentifier string, values []string, weight *int64) *spec.Response {
+	client, _err := createRoute53Client(accessKeyId, accessKeySecret, regionId, endpoint)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+
+	original, _err := describeRoute53RecordSet(ctx, client, hostedZoneId, recordName, recordType, setIdentifier)
+	if _err != nil {
+		log.Errorf(ctx, "describe aws route53 record set failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, _err.Error())
+	}
+	if weight != nil && original.Weight == nil {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "weight", strconv.FormatInt(*weight, 10), "the record is not a weighted record")
+	}
+	if _err = exec.SaveRecord(uid, route53Record{HostedZoneId: hostedZoneId, RecordSet: original}); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	return upsertRoute53RecordSet(ctx, accessKeyId, accessKeySecret, regionId, endpoint, hostedZoneId, sinkholeRoute53RecordSet(original, values, weight))
+}
+
+// copy the record set with the sinkhole values and weight, an alias record is changed to a plain record if values are provided
+func sinkholeRoute53RecordSet(original *types.ResourceRecordSet, values []string, weight *int64) *types.ResourceRecordSet {
+	recordSet := *original
+	if len(values) > 0 {
+		recordSet.ResourceRecords = nil
+		for _, value := range values {
+			recordSet.ResourceRecords = append(recordSet.ResourceRecords, types.ResourceRecord{Value: aws.String(value)})
+		}
+		if recordSet.AliasTarget != nil {
+			recordSet.AliasTarget = nil
+			recordSet.TTL = aws.Int64(route53SinkholeTTL)
+		}
+	}
+	if weight != nil {
+		recordSet.Weight = weight
+	}
+	return &recordSet
+}
+
+// upsert the record set of hosted zone
+func upsertRoute53RecordSet(ctx context.Context, accessKeyId, accessKeySecret, regionId, endpoint, hostedZoneId string, recordSet *types.ResourceRecordSet) *spec.Response {
+	client, _err := createRoute53Client(accessKeyId, accessKeySecret, regionId, endpoint)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+
+	_, _err = client.ChangeResourceRecordSets(context.TODO(), &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZoneId),
+		ChangeBatch: &types.ChangeBatch{
+			Comment: aws.String("chaosblade"),
+			Changes: []types.Change{{Action: types.ChangeActionUpsert, ResourceRecordSet: recordSet}},
+		},
+	})
+	if _err != nil {
+		log.Errorf(ctx, "change aws route53 record set failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "change aws route53 record set failed")
+	}
+	return spec.Success()
+}
+
+// invert the health check, the original inverted state is saved for destroy
+func invertRoute53HealthCheck(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId, endpoint, healthCheckId string) *spec.Response {
+	client, _err := createRoute53Client(accessKeyId, accessKeySecret, regionId, endpoint)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+
+	resp, _err := client.GetHealthCheck(context.TODO(), &route53.GetHealthCheckInput{HealthCheckId: aws.String(healthCheckId)})
+	if _err != nil {
+		log.Errorf(ctx, "get aws route53 health check failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "get aws route53 health check failed")
+	}
+	inverted := false
+	if resp.HealthCheck != nil && resp.HealthCheck.HealthCheckConfig != nil {
+		inverted = aws.ToBool(resp.HealthCheck.HealthCheckConfig.Inverted)
+	}
+	if _err = exec.SaveRecord(uid, route53Record{HealthCheckId: healthCheckId, Inverted: inverted}); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	return updateRoute53HealthCheck(ctx, accessKeyId, accessKeySecret, regionId, endpoint, healthCheckId, !inverted)
+}
+
+// update the inverted state of health check
+func updateRoute53HealthCheck(ctx context.Context, accessKeyId, accessKeySecret, regionId, endpoint, healthCheckId string, inverted bool) *spec.Response {
+	client, _err := createRoute53Client(accessKeyId, accessKeySecret, regionId, endpoint)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+
+	_, _err = client.UpdateHealthCheck(context.TODO(), &route53.UpdateHealthCheckInput{
+		HealthCheckId: aws.String(healthCheckId),
+		Inverted:      aws.Bool(inverted),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "update aws route53 health check failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "update aws route53 health check failed")
+	}
+	return spec.Success()
+}
+
+// describe the record set by name, type and set identifier
+func describeRoute53RecordSet(ctx context.Context, client *route53.Client, hostedZoneId, recordName, recordType, setIdentifier string) (_result *types.ResourceRecordSet, _err error) {
+	input := &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(hostedZoneId),
+		StartRecordName: aws.String(recordName),
+		StartRecordType: types.RRType(recordType),
+		MaxItems:        aws.Int32(100),
+	}
+	if setIdentifier != "" {
+		input.StartRecordIdentifier = aws.String(setIdentifier)
+	}
+	resp, _err := client.ListResourceRecordSets(context.TODO(), input)
+	if _err != nil {
+		return nil, _err
+	}
+	for i := range resp.ResourceRecordSets {
+		recordSet := resp.ResourceRecordSets[i]
+		if !sameRoute53Name(aws.ToString(recordSet.Name), recordName) || string(recordSet.Type) != recordType {
+			continue
+		}
+		if setIdentifier != "" && aws.ToString(recordSet.SetIdentifier) != setIdentifier {
+			continue
+		}
+		if setIdentifier == "" && recordSet.SetIdentifier != nil {
+			return nil, errors.New("the record " + recordName + " has set identifiers, setIdentifier is required")
+		}
+		return &recordSet, nil
+	}
+	return nil, fmt.Errorf("the record %s %s is not found in hosted zone %s", recordName, recordType, hostedZoneId)
+}
+
+// whether the record names are the same, the trailing dot of fully qualified name is ignored
+func sameRoute53Name(name, other string) bool {
+	return strings.EqualFold(strings.TrimSuffix(name, "."), strings.TrimSuffix(other, "."))
+}
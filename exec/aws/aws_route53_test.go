@@ -0,0 +1,227 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+type fakeAliasTarget struct {
+	HostedZoneId         string
+	DNSName              string
+	EvaluateTargetHealth bool
+}
+
+type fakeValue struct {
+	Value string
+}
+
+type fakeRecordSet struct {
+	Name          string
+	Type          string
+	SetIdentifier string           `xml:",omitempty"`
+	Weight        *int64           `xml:",omitempty"`
+	TTL           *int64           `xml:",omitempty"`
+	Values        []fakeValue      `xml:"ResourceRecords>ResourceRecord,omitempty"`
+	AliasTarget   *fakeAliasTarget `xml:",omitempty"`
+}
+
+type fakeHealthCheck struct {
+	Id                 string
+	CallerReference    string
+	Type               string `xml:"HealthCheckConfig>Type"`
+	Inverted           bool   `xml:"HealthCheckConfig>Inverted"`
+	HealthCheckVersion int64
+}
+
+// fakeRoute53 is a local route53 compatible stand-in which keeps the record sets and health checks
+type fakeRoute53 struct {
+	sync.Mutex
+	recordSets   []fakeRecordSet
+	healthChecks map[string]*fakeHealthCheck
+}
+
+func newFakeRoute53() *fakeRoute53 {
+	return &fakeRoute53{healthChecks: map[string]*fakeHealthCheck{}}
+}
+
+func (f *fakeRoute53) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	w.Header().Set("Content-Type", "text/xml")
+	path := strings.TrimPrefix(r.URL.Path, "/2013-04-01/")
+	switch {
+	case strings.HasPrefix(path, "hostedzone/") && strings.Contains(path, "/rrset") && r.Method == http.MethodGet:
+		// the record sets are returned from the start name, the fake returns all of them
+		response := struct {
+			XMLName            xml.Name        `xml:"ListResourceRecordSetsResponse"`
+			ResourceRecordSets []fakeRecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+			IsTruncated        bool
+			MaxItems           string
+		}{ResourceRecordSets: f.recordSets, MaxItems: "100"}
+		xml.NewEncoder(w).Encode(response)
+	case strings.HasPrefix(path, "hostedzone/") && strings.Contains(path, "/rrset") && r.Method == http.MethodPost:
+		var request struct {
+			Changes []struct {
+				Action            string
+				ResourceRecordSet fakeRecordSet
+			} `xml:"ChangeBatch>Changes>Change"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, change := range request.Changes {
+			f.upsert(change.ResourceRecordSet)
+		}
+		w.Write([]byte(`<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status><SubmittedAt>2020-01-01T00:00:00Z</SubmittedAt></ChangeInfo></ChangeResourceRecordSetsResponse>`))
+	case strings.HasPrefix(path, "healthcheck/"):
+		healthCheck, ok := f.healthChecks[strings.TrimPrefix(path, "healthcheck/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<ErrorResponse><Error><Code>NoSuchHealthCheck</Code><Message>not found</Message></Error></ErrorResponse>`))
+			return
+		}
+		if r.Method == http.MethodPost {
+			var request struct {
+				Inverted *bool
+			}
+			if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if request.Inverted != nil {
+				healthCheck.Inverted = *request.Inverted
+			}
+			healthCheck.HealthCheckVersion++
+		}
+		response := struct {
+			XMLName     xml.Name `xml:"GetHealthCheckResponse"`
+			HealthCheck *fakeHealthCheck
+		}{HealthCheck: healthCheck}
+		xml.NewEncoder(w).Encode(response)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeRoute53) upsert(recordSet fakeRecordSet) {
+	for i, existing := range f.recordSets {
+		if existing.Name == recordSet.Name && existing.Type == recordSet.Type && existing.SetIdentifier == recordSet.SetIdentifier {
+			f.recordSets[i] = recordSet
+			return
+		}
+	}
+	f.recordSets = append(f.recordSets, recordSet)
+}
+
+func TestAwsRoute53RecordValue(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	fake := newFakeRoute53()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	fake.recordSets = []fakeRecordSet{
+		{Name: "api.example.com.", Type: "A", TTL: aws.Int64(300), Values: []fakeValue{{"10.0.0.1"}, {"10.0.0.2"}}},
+		{Name: "www.example.com.", Type: "A", AliasTarget: &fakeAliasTarget{HostedZoneId: "Z-elb", DNSName: "elb.amazonaws.com."}},
+	}
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := changeRoute53Record(ctx, "123", "accessKeyId", "accessKeySecret", "us-east-1", server.URL, "Z-x", "api.example.com", "A", "", []string{"192.0.2.1"}, nil)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, []fakeValue{{"192.0.2.1"}}, fake.recordSets[0].Values, "they should be equal")
+	assert.Equal(t, int64(300), *fake.recordSets[0].TTL, "they should be equal")
+
+	result = (&Route53Executor{}).stop(ctx, "123", "record", "accessKeyId", "accessKeySecret", "us-east-1", server.URL)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, []fakeValue{{"10.0.0.1"}, {"10.0.0.2"}}, fake.recordSets[0].Values, "they should be equal")
+
+	result = changeRoute53Record(ctx, "123", "accessKeyId", "accessKeySecret", "us-east-1", server.URL, "Z-x", "www.example.com", "A", "", []string{"192.0.2.1"}, nil)
+	assert.True(t, result.Success, result.Err)
+	assert.Nil(t, fake.recordSets[1].AliasTarget)
+	assert.Equal(t, int64(route53SinkholeTTL), *fake.recordSets[1].TTL, "they should be equal")
+
+	result = (&Route53Executor{}).stop(ctx, "123", "record", "accessKeyId", "accessKeySecret", "us-east-1", server.URL)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "elb.amazonaws.com.", fake.recordSets[1].AliasTarget.DNSName, "they should be equal")
+	assert.Nil(t, fake.recordSets[1].TTL)
+	assert.Empty(t, fake.recordSets[1].Values)
+}
+
+func TestAwsRoute53RecordWeight(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	fake := newFakeRoute53()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	fake.recordSets = []fakeRecordSet{
+		{Name: "api.example.com.", Type: "A", SetIdentifier: "blue", Weight: aws.Int64(10), TTL: aws.Int64(60), Values: []fakeValue{{"10.0.0.1"}}},
+		{Name: "api.example.com.", Type: "A", SetIdentifier: "green", Weight: aws.Int64(10), TTL: aws.Int64(60), Values: []fakeValue{{"10.0.1.1"}}},
+	}
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := changeRoute53Record(ctx, "123", "accessKeyId", "accessKeySecret", "us-east-1", server.URL, "Z-x", "api.example.com", "A", "", nil, aws.Int64(0))
+	assert.Equal(t, int32(48000), result.Code, "they should be equal")
+
+	result = changeRoute53Record(ctx, "123", "accessKeyId", "accessKeySecret", "us-east-1", server.URL, "Z-x", "api.example.com", "A", "green", nil, aws.Int64(0))
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, int64(10), *fake.recordSets[0].Weight, "they should be equal")
+	assert.Equal(t, int64(0), *fake.recordSets[1].Weight, "they should be equal")
+
+	result = (&Route53Executor{}).stop(ctx, "123", "record", "accessKeyId", "accessKeySecret", "us-east-1", server.URL)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, int64(10), *fake.recordSets[1].Weight, "they should be equal")
+}
+
+func TestAwsRoute53HealthCheck(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	fake := newFakeRoute53()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	fake.healthChecks["hc-x"] = &fakeHealthCheck{Id: "hc-x", CallerReference: "ref", Type: "HTTP", HealthCheckVersion: 1}
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := invertRoute53HealthCheck(ctx, "123", "accessKeyId", "accessKeySecret", "us-east-1", server.URL, "hc-x")
+	assert.True(t, result.Success, result.Err)
+	assert.True(t, fake.healthChecks["hc-x"].Inverted)
+
+	result = (&Route53Executor{}).stop(ctx, "123", "healthCheck", "accessKeyId", "accessKeySecret", "us-east-1", server.URL)
+	assert.True(t, result.Success, result.Err)
+	assert.False(t, fake.healthChecks["hc-x"].Inverted)
+
+	result = invertRoute53HealthCheck(ctx, "123", "accessKeyId", "accessKeySecret", "us-east-1", server.URL, "hc-y")
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsRoute53StopWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := (&Route53Executor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", "record", "accessKeyId", "accessKeySecret", "us-east-1", "")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
@@ -0,0 +1,460 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const RouteTableBin = "chaos_aws_routetable"
+
+type RouteTableActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewRouteTableActionSpec() spec.ExpActionCommandSpec {
+	return &RouteTableActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of route table, support blackhole, delete",
+				},
+				&spec.ExpFlag{
+					Name: "routeTableId",
+					Desc: "the routeTableId",
+				},
+				&spec.ExpFlag{
+					Name: "destination",
+					Desc: "the destination of route, support ipv4 cidr, ipv6 cidr and prefix list id",
+				},
+				&spec.ExpFlag{
+					Name: "subnetId",
+					Desc: "the subnetId to create the temporary network interface in when operationType is blackhole, a subnet of the vpc is chosen if not provided",
+				},
+			},
+			ActionExecutor: &RouteTableExecutor{},
+			ActionExample: `
+# blackhole the route to 10.1.0.0/16 of route table rtb-x
+blade create aws routeTable --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type blackhole --routeTableId rtb-x --destination 10.1.0.0/16
+
+# delete the route to prefix list pl-x of route table rtb-x
+blade create aws routeTable --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type delete --routeTableId rtb-x --destination pl-x`,
+			ActionPrograms:   []string{RouteTableBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.RouteTable},
+		},
+	}
+}
+
+func (*RouteTableActionSpec) Name() string {
+	return "routeTable"
+}
+
+func (*RouteTableActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*RouteTableActionSpec) ShortDesc() string {
+	return "do some aws routeTable Operations, like blackhole, delete"
+}
+
+func (b *RouteTableActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws routeTable Operations, like blackhole the route by pointing it at a deleted network interface, delete the route. " +
+		"The route is pointed at or created with the original target on destroy"
+}
+
+type RouteTableExecutor struct {
+	channel spec.Channel
+}
+
+func (*RouteTableExecutor) Name() string {
+	return "routeTable"
+}
+
+// routeTarget is the target of route before the experiment
+type routeTarget struct {
+	CarrierGatewayId            string `json:"carrierGatewayId,omitempty"`
+	CoreNetworkArn              string `json:"coreNetworkArn,omitempty"`
+	EgressOnlyInternetGatewayId string `json:"egressOnlyInternetGatewayId,omitempty"`
+	GatewayId                   string `json:"gatewayId,omitempty"`
+	LocalGatewayId              string `json:"localGatewayId,omitempty"`
+	NatGatewayId                string `json:"natGatewayId,omitempty"`
+	NetworkInterfaceId          string `json:"networkInterfaceId,omitempty"`
+	TransitGatewayId            string `json:"transitGatewayId,omitempty"`
+	VpcPeeringConnectionId      string `json:"vpcPeeringConnectionId,omitempty"`
+}
+
+// routeRecord is the route changed by the experiment
+type routeRecord struct {
+	RouteTableId string      `json:"routeTableId"`
+	Destination  string      `json:"destination"`
+	Target       routeTarget `json:"target"`
+}
+
+func (be *RouteTableExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	routeTableId := model.ActionFlags["routeTableId"]
+	destination := model.ActionFlags["destination"]
+	subnetId := model.ActionFlags["subnetId"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId)
+	}
+
+	if routeTableId == "" {
+		log.Errorf(ctx, "routeTableId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "routeTableId")
+	}
+
+	if destination == "" {
+		log.Errorf(ctx, "destination is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "destination")
+	}
+	return be.start(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId, routeTableId, destination, subnetId)
+}
+
+func (be *RouteTableExecutor) start(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId, routeTableId, destination, subnetId string) *spec.Response {
+	switch operationType {
+	case "blackhole", "delete":
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support blackhole, delete)")
+	}
+	table, _err := describeAwsRouteTable(ctx, accessKeyId, accessKeySecret, regionId, routeTableId)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe route table failed")
+	}
+	var route *types.Route
+	for i := range table.Routes {
+		if routeDestination(table.Routes[i]) == destination {
+			route = &table.Routes[i]
+		}
+	}
+	if route == nil {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "destination", destination, "no route to the destination found")
+	}
+	if route.Origin != types.RouteOriginCreateRoute {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "destination", destination, fmt.Sprintf("the route created by %s can not be changed", route.Origin))
+	}
+	if strings.HasPrefix(aws.ToString(route.GatewayId), "vpce-") {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "destination", destination, "the route of vpc endpoint can not be changed")
+	}
+	record := routeRecord{
+		RouteTableId: routeTableId,
+		Destination:  destination,
+		Target: routeTarget{
+			CarrierGatewayId:            aws.ToString(route.CarrierGatewayId),
+			CoreNetworkArn:              aws.ToString(route.CoreNetworkArn),
+			EgressOnlyInternetGatewayId: aws.ToString(route.EgressOnlyInternetGatewayId),
+			GatewayId:                   aws.ToString(route.GatewayId),
+			LocalGatewayId:              aws.ToString(route.LocalGatewayId),
+			NatGatewayId:                aws.ToString(route.NatGatewayId),
+			NetworkInterfaceId:          aws.ToString(route.NetworkInterfaceId),
+			TransitGatewayId:            aws.ToString(route.TransitGatewayId),
+			VpcPeeringConnectionId:      aws.ToString(route.VpcPeeringConnectionId),
+		},
+	}
+	if record.Target == (routeTarget{}) {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "destination", destination, "the target of route is unknown")
+	}
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if operationType == "delete" {
+		return deleteAwsRoute(ctx, accessKeyId, accessKeySecret, regionId, routeTableId, destination)
+	}
+	if subnetId == "" {
+		subnets, _err := describeAwsVpcSubnets(ctx, accessKeyId, accessKeySecret, regionId, aws.ToString(table.VpcId))
+		if _err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe subnets failed")
+		}
+		if len(subnets) == 0 {
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "routeTableId", routeTableId, "no subnet found in the vpc of route table")
+		}
+		subnetId = subnets[0]
+	}
+	return blackholeAwsRoute(ctx, uid, accessKeyId, accessKeySecret, regionId, routeTableId, destination, subnetId)
+}
+
+func (be *RouteTableExecutor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	var record routeRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	var response *spec.Response
+	switch operationType {
+	case "blackhole":
+		response = replaceAwsRoute(ctx, accessKeyId, accessKeySecret, regionId, record.RouteTableId, record.Destination, record.Target)
+	case "delete":
+		response = createAwsRoute(ctx, accessKeyId, accessKeySecret, regionId, record.RouteTableId, record.Destination, record.Target)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support blackhole, delete)")
+	}
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *RouteTableExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+func routeDestination(route types.Route) string {
+	if route.DestinationCidrBlock != nil {
+		return aws.ToString(route.DestinationCidrBlock)
+	}
+	if route.DestinationIpv6CidrBlock != nil {
+		return aws.ToString(route.DestinationIpv6CidrBlock)
+	}
+	return aws.ToString(route.DestinationPrefixListId)
+}
+
+// set the destination fields of route input, the destination is a prefix list id, ipv6 cidr or ipv4 cidr
+func setRouteDestination(destination string, cidr, ipv6Cidr, prefixListId **string) {
+	switch {
+	case strings.HasPrefix(destination, "pl-"):
+		*prefixListId = aws.String(destination)
+	case strings.Contains(destination, ":"):
+		*ipv6Cidr = aws.String(destination)
+	default:
+		*cidr = aws.String(destination)
+	}
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
+
+// point the route at a temporary network interface and delete it, which makes the route a blackhole
+func blackholeAwsRoute(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId, routeTableId, destination, subnetId string) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	networkInterface, _err := client.CreateNetworkInterface(context.TODO(), &ec2.CreateNetworkInterfaceInput{
+		SubnetId:    aws.String(subnetId),
+		Description: aws.String(fmt.Sprintf("blackhole for chaosblade experiment %s", uid)),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "create aws network interface failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws network interface failed")
+	}
+	networkInterfaceId := aws.ToString(networkInterface.NetworkInterface.NetworkInterfaceId)
+	response := replaceAwsRoute(ctx, accessKeyId, accessKeySecret, regionId, routeTableId, destination, routeTarget{NetworkInterfaceId: networkInterfaceId})
+	_, _err = client.DeleteNetworkInterface(context.TODO(), &ec2.DeleteNetworkInterfaceInput{
+		NetworkInterfaceId: aws.String(networkInterfaceId),
+	})
+	if !response.Success {
+		return response
+	}
+	if _err != nil {
+		log.Errorf(ctx, "delete aws network interface %s failed, err: %s", networkInterfaceId, _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "delete aws network interface failed")
+	}
+	return spec.Success()
+}
+
+// replace the target of route
+func replaceAwsRoute(ctx context.Context, accessKeyId, accessKeySecret, regionId, routeTableId, destination string, target routeTarget) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	input := &ec2.ReplaceRouteInput{
+		RouteTableId:                aws.String(routeTableId),
+		CarrierGatewayId:            optionalString(target.CarrierGatewayId),
+		CoreNetworkArn:              optionalString(target.CoreNetworkArn),
+		EgressOnlyInternetGatewayId: optionalString(target.EgressOnlyInternetGatewayId),
+		GatewayId:                   optionalString(target.GatewayId),
+		LocalGatewayId:              optionalString(target.LocalGatewayId),
+		NatGatewayId:                optionalString(target.NatGatewayId),
+		NetworkInterfaceId:          optionalString(target.NetworkInterfaceId),
+		TransitGatewayId:            optionalString(target.TransitGatewayId),
+		VpcPeeringConnectionId:      optionalString(target.VpcPeeringConnectionId),
+	}
+	setRouteDestination(destination, &input.DestinationCidrBlock, &input.DestinationIpv6CidrBlock, &input.DestinationPrefixListId)
+	_, _err = client.ReplaceRoute(context.TODO(), input)
+	if _err != nil {
+		log.Errorf(ctx, "replace aws route failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "replace aws route failed")
+	}
+	return spec.Success()
+}
+
+// create route with the target
+func createAwsRoute(ctx context.Context, accessKeyId, accessKeySecret, regionId, routeTableId, destination string, target routeTarget) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	input := &ec2.CreateRouteInput{
+		RouteTableId:                aws.String(routeTableId),
+		CarrierGatewayId:            optionalString(target.CarrierGatewayId),
+		CoreNetworkArn:              optionalString(target.CoreNetworkArn),
+		EgressOnlyInternetGatewayId: optionalString(target.EgressOnlyInternetGatewayId),
+		GatewayId:                   optionalString(target.GatewayId),
+		LocalGatewayId:              optionalString(target.LocalGatewayId),
+		NatGatewayId:                optionalString(target.NatGatewayId),
+		NetworkInterfaceId:          optionalString(target.NetworkInterfaceId),
+		TransitGatewayId:            optionalString(target.TransitGatewayId),
+		VpcPeeringConnectionId:      optionalString(target.VpcPeeringConnectionId),
+	}
+	setRouteDestination(destination, &input.DestinationCidrBlock, &input.DestinationIpv6CidrBlock, &input.DestinationPrefixListId)
+	_, _err = client.CreateRoute(context.TODO(), input)
+	if _err != nil {
+		log.Errorf(ctx, "create aws route failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws route failed")
+	}
+	return spec.Success()
+}
+
+// delete route
+func deleteAwsRoute(ctx context.Context, accessKeyId, accessKeySecret, regionId, routeTableId, destination string) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	input := &ec2.DeleteRouteInput{
+		RouteTableId: aws.String(routeTableId),
+	}
+	setRouteDestination(destination, &input.DestinationCidrBlock, &input.DestinationIpv6CidrBlock, &input.DestinationPrefixListId)
+	_, _err = client.DeleteRoute(context.TODO(), input)
+	if _err != nil {
+		log.Errorf(ctx, "delete aws route failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "delete aws route failed")
+	}
+	return spec.Success()
+}
+
+// describe route table
+func describeAwsRouteTable(ctx context.Context, accessKeyId, accessKeySecret, regionId, routeTableId string) (_result *types.RouteTable, _err error) {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	resp, _err := client.DescribeRouteTables(context.TODO(), &ec2.DescribeRouteTablesInput{
+		RouteTableIds: []string{routeTableId},
+	})
+	if _err != nil {
+		log.Errorf(ctx, "describe aws route table failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	if len(resp.RouteTables) == 0 {
+		_err = fmt.Errorf("route table %s not found", routeTableId)
+		log.Errorf(ctx, "describe aws route table failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	_result = &resp.RouteTables[0]
+	return _result, _err
+}
+
+// describe the subnets of vpc
+func describeAwsVpcSubnets(ctx context.Context, accessKeyId, accessKeySecret, regionId, vpcId string) (_result []string, _err error) {
+	return describeAwsSubnets(ctx, accessKeyId, accessKeySecret, regionId, []types.Filter{
+		{Name: aws.String("vpc-id"), Values: []string{vpcId}},
+	})
+}
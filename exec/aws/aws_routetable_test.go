@@ -0,0 +1,70 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+func TestAwsRouteTableDestination(t *testing.T) {
+	assert.Equal(t, "10.0.0.0/16", routeDestination(types.Route{DestinationCidrBlock: aws.String("10.0.0.0/16")}), "they should be equal")
+	assert.Equal(t, "::/0", routeDestination(types.Route{DestinationIpv6CidrBlock: aws.String("::/0")}), "they should be equal")
+	assert.Equal(t, "pl-1", routeDestination(types.Route{DestinationPrefixListId: aws.String("pl-1")}), "they should be equal")
+
+	input := &ec2.DeleteRouteInput{}
+	setRouteDestination("::/0", &input.DestinationCidrBlock, &input.DestinationIpv6CidrBlock, &input.DestinationPrefixListId)
+	assert.Equal(t, "::/0", aws.ToString(input.DestinationIpv6CidrBlock), "they should be equal")
+	assert.Nil(t, input.DestinationCidrBlock)
+	input = &ec2.DeleteRouteInput{}
+	setRouteDestination("pl-1", &input.DestinationCidrBlock, &input.DestinationIpv6CidrBlock, &input.DestinationPrefixListId)
+	assert.Equal(t, "pl-1", aws.ToString(input.DestinationPrefixListId), "they should be equal")
+}
+
+func TestAwsRouteTableReplace(t *testing.T) {
+	result := replaceAwsRoute(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "rtb-1", "10.0.0.0/16", routeTarget{NatGatewayId: "nat-1"})
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsRouteTableCreate(t *testing.T) {
+	result := createAwsRoute(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "rtb-1", "10.0.0.0/16", routeTarget{TransitGatewayId: "tgw-1"})
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsRouteTableDelete(t *testing.T) {
+	result := deleteAwsRoute(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", "rtb-1", "10.0.0.0/16")
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsRouteTableBlackhole(t *testing.T) {
+	result := blackholeAwsRoute(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "us-west-2", "rtb-1", "10.0.0.0/16", "subnet-1")
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsRouteTableStopWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := (&RouteTableExecutor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", "blackhole", "accessKeyId", "accessKeySecret", "us-west-2")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
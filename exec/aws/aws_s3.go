@@ -0,0 +1,357 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const S3Bin = "chaos_aws_s3"
+
+// the data actions denied by default, the policy actions are kept so the policy can be restored
+const s3DefaultActions = "s3:GetObject,s3:PutObject,s3:DeleteObject,s3:ListBucket"
+
+type S3ActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewS3ActionSpec() spec.ExpActionCommandSpec {
+	return &S3ActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "endpoint",
+					Desc: "the endpoint of s3 compatible service, path style addressing is used if provided",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of bucket, support deny",
+				},
+				&spec.ExpFlag{
+					Name: "bucket",
+					Desc: "the bucket name",
+				},
+				&spec.ExpFlag{
+					Name: "principals",
+					Desc: "the aws principals denied, like account id or role arn, split by comma, default is all",
+				},
+				&spec.ExpFlag{
+					Name: "prefixes",
+					Desc: "the object prefixes denied, split by comma, default is the whole bucket",
+				},
+				&spec.ExpFlag{
+					Name: "actions",
+					Desc: "the actions denied, split by comma, default is " + s3DefaultActions,
+				},
+				&spec.ExpFlag{
+					Name: "sourceIps",
+					Desc: "the source ips or cidr blocks denied, split by comma, default is all",
+				},
+			},
+			ActionExecutor: &S3Executor{},
+			ActionExample: `
+# deny all principals to read and write the objects of bucket b-x
+blade create aws s3 --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type deny --bucket b-x
+
+# deny role arn:aws:iam::123456789012:role/app to get the objects under prefix logs/ of bucket b-x
+blade create aws s3 --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type deny --bucket b-x --principals arn:aws:iam::123456789012:role/app --prefixes logs/ --actions s3:GetObject
+
+# deny the requests from 192.168.0.0/16 to bucket b-x
+blade create aws s3 --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type deny --bucket b-x --sourceIps 192.168.0.0/16`,
+			ActionPrograms:   []string{S3Bin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.S3},
+		},
+	}
+}
+
+func (*S3ActionSpec) Name() string {
+	return "s3"
+}
+
+func (*S3ActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*S3ActionSpec) ShortDesc() string {
+	return "do some aws s3 bucket Operations, like deny"
+}
+
+func (b *S3ActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws s3 bucket Operations, like install a deny statement into the bucket policy. The previous bucket policy is restored on destroy"
+}
+
+type S3Executor struct {
+	channel spec.Channel
+}
+
+func (*S3Executor) Name() string {
+	return "s3"
+}
+
+// s3Record is the bucket policy before the experiment
+type s3Record struct {
+	Bucket    string `json:"bucket"`
+	HasPolicy bool   `json:"hasPolicy"`
+	Policy    string `json:"policy,omitempty"`
+}
+
+func (be *S3Executor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	endpoint := model.ActionFlags["endpoint"]
+	operationType := model.ActionFlags["type"]
+	bucket := model.ActionFlags["bucket"]
+	principals := model.ActionFlags["principals"]
+	prefixes := model.ActionFlags["prefixes"]
+	actions := model.ActionFlags["actions"]
+	sourceIps := model.ActionFlags["sourceIps"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if operationType != "deny" {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support deny)")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return restoreS3BucketPolicy(ctx, uid, accessKeyId, accessKeySecret, regionId, endpoint)
+	}
+
+	if bucket == "" {
+		log.Errorf(ctx, "bucket is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "bucket")
+	}
+	if actions == "" {
+		actions = s3DefaultActions
+	}
+	return denyS3Bucket(ctx, uid, accessKeyId, accessKeySecret, regionId, endpoint, bucket, exec.SplitFlag(principals), exec.SplitFlag(prefixes), exec.SplitFlag(actions), exec.SplitFlag(sourceIps))
+}
+
+func (be *S3Executor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// create s3 client, the endpoint of s3 compatible service is addressed by path style
+func createS3Client(accessKeyId, accessKeySecret, regionId, endpoint string) (*s3.Client, error) {
+	cfg, err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	}), nil
+}
+
+// build the deny statement of bucket policy
+func s3DenyStatement(uid, bucket string, principals, prefixes, actions, sourceIps []string) map[string]interface{} {
+	var principal interface{} = "*"
+	if len(principals) > 0 {
+		principal = map[string]interface{}{"AWS": principals}
+	}
+	var resources []string
+	if len(prefixes) == 0 {
+		resources = []string{"arn:aws:s3:::" + bucket, "arn:aws:s3:::" + bucket + "/*"}
+	} else {
+		for _, prefix := range prefixes {
+			resources = append(resources, "arn:aws:s3:::"+bucket+"/"+strings.TrimPrefix(prefix, "/")+"*")
+		}
+	}
+	statement := map[string]interface{}{
+		"Sid":       "chaosblade" + strings.ReplaceAll(uid, "-", ""),
+		"Effect":    "Deny",
+		"Action":    actions,
+		"Principal": principal,
+		"Resource":  resources,
+	}
+	if len(sourceIps) > 0 {
+		statement["Condition"] = map[string]interface{}{
+			"IpAddress": map[string]interface{}{
+				"aws:SourceIp": sourceIps,
+			},
+		}
+	}
+	return statement
+}
+
+// merge the deny statement into the bucket policy, a new policy is created if policy is empty
+func mergeS3Policy(policy string, statement map[string]interface{}) (string, error) {
+	document := map[string]interface{}{
+		"Version": "2012-10-17",
+	}
+	if policy != "" {
+		if err := json.Unmarshal([]byte(policy), &document); err != nil {
+			return "", err
+		}
+	}
+	// a single statement may be an object instead of an array
+	var statements []interface{}
+	switch current := document["Statement"].(type) {
+	case []interface{}:
+		statements = current
+	case map[string]interface{}:
+		statements = []interface{}{current}
+	}
+	document["Statement"] = append(statements, statement)
+	bytes, err := json.Marshal(document)
+	return string(bytes), err
+}
+
+// is the error of s3 caused by the bucket policy not found
+func isS3PolicyNotFound(err error) bool {
+	var apiError smithy.APIError
+	return errors.As(err, &apiError) && apiError.ErrorCode() == "NoSuchBucketPolicy"
+}
+
+// install the deny statement into the bucket policy, the previous policy is saved for destroy
+func denyS3Bucket(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId, endpoint, bucket string, principals, prefixes, actions, sourceIps []string) *spec.Response {
+	client, _err := createS3Client(accessKeyId, accessKeySecret, regionId, endpoint)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+
+	record := s3Record{Bucket: bucket, HasPolicy: true}
+	resp, _err := client.GetBucketPolicy(context.TODO(), &s3.GetBucketPolicyInput{
+		Bucket: aws.String(bucket),
+	})
+	if _err != nil {
+		if !isS3PolicyNotFound(_err) {
+			log.Errorf(ctx, "get aws s3 bucket policy failed, err: %s", _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "get aws s3 bucket policy failed")
+		}
+		record.HasPolicy = false
+	} else {
+		record.Policy = aws.ToString(resp.Policy)
+	}
+	policy, _err := mergeS3Policy(record.Policy, s3DenyStatement(uid, bucket, principals, prefixes, actions, sourceIps))
+	if _err != nil {
+		log.Errorf(ctx, "merge aws s3 bucket policy failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "merge aws s3 bucket policy failed")
+	}
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	_, _err = client.PutBucketPolicy(context.TODO(), &s3.PutBucketPolicyInput{
+		Bucket: aws.String(bucket),
+		Policy: aws.String(policy),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "put aws s3 bucket policy failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "put aws s3 bucket policy failed")
+	}
+	return spec.Success()
+}
+
+// restore the bucket policy saved by denyS3Bucket
+func restoreS3BucketPolicy(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId, endpoint string) *spec.Response {
+	var record s3Record
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	client, _err := createS3Client(accessKeyId, accessKeySecret, regionId, endpoint)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+
+	if record.HasPolicy {
+		_, _err = client.PutBucketPolicy(context.TODO(), &s3.PutBucketPolicyInput{
+			Bucket: aws.String(record.Bucket),
+			Policy: aws.String(record.Policy),
+		})
+	} else {
+		_, _err = client.DeleteBucketPolicy(context.TODO(), &s3.DeleteBucketPolicyInput{
+			Bucket: aws.String(record.Bucket),
+		})
+	}
+	if _err != nil {
+		log.Errorf(ctx, "restore aws s3 bucket policy failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "restore aws s3 bucket policy failed")
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return spec.Success()
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+// fakeS3 is a local s3 compatible stand-in which keeps the policies of buckets, addressed by path style
+type fakeS3 struct {
+	sync.Mutex
+	policies map[string]string
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{policies: map[string]string{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	bucket := strings.Trim(r.URL.Path, "/")
+	if _, ok := r.URL.Query()["policy"]; !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		policy, ok := f.policies[bucket]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchBucketPolicy</Code><Message>The bucket policy does not exist</Message></Error>`)
+			return
+		}
+		io.WriteString(w, policy)
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.policies[bucket] = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		delete(f.policies, bucket)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestAwsS3DenyAndRestore(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	original := `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::bucket/*"}}`
+	fake.policies["bucket"] = original
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := denyS3Bucket(ctx, "123", "accessKeyId", "accessKeySecret", "us-west-2", server.URL, "bucket", []string{"arn:aws:iam::123456789012:role/app"}, []string{"logs/"}, []string{"s3:GetObject"}, []string{"10.0.0.0/8"})
+	assert.True(t, result.Success, result.Err)
+	var document struct {
+		Statement []map[string]interface{}
+	}
+	assert.Nil(t, json.Unmarshal([]byte(fake.policies["bucket"]), &document))
+	assert.Len(t, document.Statement, 2)
+	assert.Equal(t, "Deny", document.Statement[1]["Effect"], "they should be equal")
+	assert.Equal(t, []interface{}{"arn:aws:s3:::bucket/logs/*"}, document.Statement[1]["Resource"], "they should be equal")
+	assert.Equal(t, map[string]interface{}{"AWS": []interface{}{"arn:aws:iam::123456789012:role/app"}}, document.Statement[1]["Principal"], "they should be equal")
+
+	result = restoreS3BucketPolicy(ctx, "123", "accessKeyId", "accessKeySecret", "us-west-2", server.URL)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, original, fake.policies["bucket"], "they should be equal")
+}
+
+func TestAwsS3DenyWithoutPolicy(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := denyS3Bucket(ctx, "123", "accessKeyId", "accessKeySecret", "us-west-2", server.URL, "bucket", nil, nil, []string{"s3:*"}, nil)
+	assert.True(t, result.Success, result.Err)
+	assert.Contains(t, fake.policies["bucket"], `"Effect":"Deny"`)
+	assert.Contains(t, fake.policies["bucket"], `"Principal":"*"`)
+
+	result = restoreS3BucketPolicy(ctx, "123", "accessKeyId", "accessKeySecret", "us-west-2", server.URL)
+	assert.True(t, result.Success, result.Err)
+	_, ok := fake.policies["bucket"]
+	assert.False(t, ok)
+}
+
+func TestAwsS3RestoreWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := restoreS3BucketPolicy(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "us-west-2", "")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
@@ -0,0 +1,498 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const SecurityGroupBin = "chaos_aws_securitygroup"
+
+type SecurityGroupActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewSecurityGroupActionSpec() spec.ExpActionCommandSpec {
+	return &SecurityGroupActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of aws, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of aws, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of aws",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of security group, support isolate, revoke",
+				},
+				&spec.ExpFlag{
+					Name: "instanceId",
+					Desc: "the instanceId list which network interfaces are isolated when operationType is isolate, split by comma",
+				},
+				&spec.ExpFlag{
+					Name: "networkInterfaceId",
+					Desc: "the networkInterfaceId list which are isolated when operationType is isolate, split by comma",
+				},
+				&spec.ExpFlag{
+					Name: "securityGroupId",
+					Desc: "the securityGroupId which rules are revoked when operationType is revoke",
+				},
+				&spec.ExpFlag{
+					Name:    "direction",
+					Desc:    "the direction of rules revoked when operationType is revoke, support ingress, egress, all, default is ingress",
+					Default: "ingress",
+				},
+			},
+			ActionExecutor: &SecurityGroupExecutor{},
+			ActionExample: `
+# isolate the network interfaces of instance i-x and i-y with a temporary deny-all security group
+blade create aws securityGroup --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type isolate --instanceId i-x,i-y
+
+# isolate network interface eni-x with a temporary deny-all security group
+blade create aws securityGroup --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type isolate --networkInterfaceId eni-x
+
+# revoke all ingress and egress rules of security group sg-x
+blade create aws securityGroup --accessKeyId xxx --accessKeySecret yyy --regionId us-west-2 --type revoke --securityGroupId sg-x --direction all`,
+			ActionPrograms:   []string{SecurityGroupBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Aws + "_" + category.SecurityGroup},
+		},
+	}
+}
+
+func (*SecurityGroupActionSpec) Name() string {
+	return "securityGroup"
+}
+
+func (*SecurityGroupActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*SecurityGroupActionSpec) ShortDesc() string {
+	return "do some aws securityGroup Operations, like isolate, revoke"
+}
+
+func (b *SecurityGroupActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some aws securityGroup Operations, like isolate the network interfaces with a temporary deny-all security group, " +
+		"revoke the rules of a security group. The original security groups and rules are restored on destroy"
+}
+
+type SecurityGroupExecutor struct {
+	channel spec.Channel
+}
+
+func (*SecurityGroupExecutor) Name() string {
+	return "securityGroup"
+}
+
+// networkInterfaceGroups is the security groups of a network interface before it is isolated
+type networkInterfaceGroups struct {
+	NetworkInterfaceId string   `json:"networkInterfaceId"`
+	Groups             []string `json:"groups"`
+}
+
+// securityGroupRecord is the state changed by the security group experiment
+type securityGroupRecord struct {
+	OperationType     string                   `json:"operationType"`
+	GroupId           string                   `json:"groupId"`
+	NetworkInterfaces []networkInterfaceGroups `json:"networkInterfaces,omitempty"`
+	Ingress           []types.IpPermission     `json:"ingress,omitempty"`
+	Egress            []types.IpPermission     `json:"egress,omitempty"`
+}
+
+func (be *SecurityGroupExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	instanceId := model.ActionFlags["instanceId"]
+	networkInterfaceId := model.ActionFlags["networkInterfaceId"]
+	securityGroupId := model.ActionFlags["securityGroupId"]
+	direction := model.ActionFlags["direction"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, accessKeyId, accessKeySecret, regionId)
+	}
+
+	switch operationType {
+	case "isolate":
+		if instanceId == "" && networkInterfaceId == "" {
+			log.Errorf(ctx, "instanceId or networkInterfaceId is required when operationType is isolate!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "instanceId|networkInterfaceId")
+		}
+		return isolateNetworkInterfaces(ctx, uid, accessKeyId, accessKeySecret, regionId, exec.SplitFlag(instanceId), exec.SplitFlag(networkInterfaceId))
+	case "revoke":
+		if securityGroupId == "" {
+			log.Errorf(ctx, "securityGroupId is required when operationType is revoke!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "securityGroupId")
+		}
+		switch direction {
+		case "", "ingress", "egress", "all":
+		default:
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "direction", direction, "it must be ingress, egress or all")
+		}
+		return revokeSecurityGroupRules(ctx, uid, accessKeyId, accessKeySecret, regionId, securityGroupId, direction)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support isolate, revoke)")
+	}
+}
+
+func (be *SecurityGroupExecutor) stop(ctx context.Context, uid, operationType, accessKeyId, accessKeySecret, regionId string) *spec.Response {
+	var record securityGroupRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	if record.OperationType != operationType {
+		log.Errorf(ctx, "the experiment %s is created by type %s, not %s", uid, record.OperationType, operationType)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type", operationType, "it must be the type of the experiment "+record.OperationType)
+	}
+	var response *spec.Response
+	switch operationType {
+	case "isolate":
+		response = restoreNetworkInterfaces(ctx, accessKeyId, accessKeySecret, regionId, record)
+	case "revoke":
+		response = restoreSecurityGroupRules(ctx, accessKeyId, accessKeySecret, regionId, record)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support isolate, revoke)")
+	}
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *SecurityGroupExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// isolate network interfaces with a temporary deny-all security group
+func isolateNetworkInterfaces(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId string, instances, networkInterfaces []string) *spec.Response {
+	interfaces, _err := describeAwsNetworkInterfaces(ctx, accessKeyId, accessKeySecret, regionId, instances, networkInterfaces)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe network interfaces failed")
+	}
+	if len(interfaces) == 0 {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "instanceId|networkInterfaceId", strings.Join(append(instances, networkInterfaces...), ","), "no network interface found")
+	}
+	vpcId := aws.ToString(interfaces[0].VpcId)
+	record := securityGroupRecord{OperationType: "isolate"}
+	for _, networkInterface := range interfaces {
+		if aws.ToString(networkInterface.VpcId) != vpcId {
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "instanceId|networkInterfaceId", strings.Join(append(instances, networkInterfaces...), ","), "the network interfaces must be in the same vpc")
+		}
+		groups := networkInterfaceGroups{NetworkInterfaceId: aws.ToString(networkInterface.NetworkInterfaceId)}
+		for _, group := range networkInterface.Groups {
+			groups.Groups = append(groups.Groups, aws.ToString(group.GroupId))
+		}
+		record.NetworkInterfaces = append(record.NetworkInterfaces, groups)
+	}
+
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	group, _err := client.CreateSecurityGroup(context.TODO(), &ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(fmt.Sprintf("chaosblade-deny-%s", uid)),
+		Description: aws.String(fmt.Sprintf("deny all traffic for chaosblade experiment %s", uid)),
+		VpcId:       aws.String(vpcId),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "create aws security group failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws security group failed")
+	}
+	record.GroupId = aws.ToString(group.GroupId)
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		deleteAwsSecurityGroup(ctx, client, record.GroupId)
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+
+	// a new security group allows all egress traffic by default, for both ipv4 and ipv6 in a dual-stack vpc
+	isolation, _err := describeAwsSecurityGroup(ctx, accessKeyId, accessKeySecret, regionId, record.GroupId)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe security group failed")
+	}
+	if len(isolation.IpPermissionsEgress) > 0 {
+		_, _err = client.RevokeSecurityGroupEgress(context.TODO(), &ec2.RevokeSecurityGroupEgressInput{
+			GroupId:       group.GroupId,
+			IpPermissions: isolation.IpPermissionsEgress,
+		})
+		if _err != nil {
+			log.Errorf(ctx, "revoke egress of aws security group failed, err: %s", _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "revoke egress of aws security group failed")
+		}
+	}
+	for _, networkInterface := range record.NetworkInterfaces {
+		response := modifyNetworkInterfaceGroups(ctx, client, networkInterface.NetworkInterfaceId, []string{record.GroupId})
+		if !response.Success {
+			return response
+		}
+	}
+	return spec.Success()
+}
+
+// restore the security groups of network interfaces and delete the temporary security group
+func restoreNetworkInterfaces(ctx context.Context, accessKeyId, accessKeySecret, regionId string, record securityGroupRecord) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	for _, networkInterface := range record.NetworkInterfaces {
+		response := modifyNetworkInterfaceGroups(ctx, client, networkInterface.NetworkInterfaceId, networkInterface.Groups)
+		if !response.Success {
+			return response
+		}
+	}
+	return deleteAwsSecurityGroup(ctx, client, record.GroupId)
+}
+
+// modify the security groups of network interface
+func modifyNetworkInterfaceGroups(ctx context.Context, client *ec2.Client, networkInterfaceId string, groups []string) *spec.Response {
+	_, _err := client.ModifyNetworkInterfaceAttribute(context.TODO(), &ec2.ModifyNetworkInterfaceAttributeInput{
+		NetworkInterfaceId: aws.String(networkInterfaceId),
+		Groups:             groups,
+	})
+	if _err != nil {
+		log.Errorf(ctx, "modify security groups of aws network interface %s failed, err: %s", networkInterfaceId, _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "modify security groups of aws network interface failed")
+	}
+	return spec.Success()
+}
+
+// delete security group
+func deleteAwsSecurityGroup(ctx context.Context, client *ec2.Client, groupId string) *spec.Response {
+	_, _err := client.DeleteSecurityGroup(context.TODO(), &ec2.DeleteSecurityGroupInput{
+		GroupId: aws.String(groupId),
+	})
+	if _err != nil {
+		log.Errorf(ctx, "delete aws security group %s failed, err: %s", groupId, _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "delete aws security group failed")
+	}
+	return spec.Success()
+}
+
+// revoke the ingress or egress rules of security group
+func revokeSecurityGroupRules(ctx context.Context, uid, accessKeyId, accessKeySecret, regionId, securityGroupId, direction string) *spec.Response {
+	group, _err := describeAwsSecurityGroup(ctx, accessKeyId, accessKeySecret, regionId, securityGroupId)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe security group failed")
+	}
+	record := securityGroupRecord{OperationType: "revoke", GroupId: securityGroupId}
+	if direction != "egress" {
+		record.Ingress = group.IpPermissions
+	}
+	if direction == "egress" || direction == "all" {
+		record.Egress = group.IpPermissionsEgress
+	}
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	if len(record.Ingress) > 0 {
+		_, _err = client.RevokeSecurityGroupIngress(context.TODO(), &ec2.RevokeSecurityGroupIngressInput{
+			GroupId:       aws.String(securityGroupId),
+			IpPermissions: record.Ingress,
+		})
+		if _err != nil {
+			log.Errorf(ctx, "revoke ingress of aws security group failed, err: %s", _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "revoke ingress of aws security group failed")
+		}
+	}
+	if len(record.Egress) > 0 {
+		_, _err = client.RevokeSecurityGroupEgress(context.TODO(), &ec2.RevokeSecurityGroupEgressInput{
+			GroupId:       aws.String(securityGroupId),
+			IpPermissions: record.Egress,
+		})
+		if _err != nil {
+			log.Errorf(ctx, "revoke egress of aws security group failed, err: %s", _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "revoke egress of aws security group failed")
+		}
+	}
+	return spec.Success()
+}
+
+// authorize the revoked rules of security group again
+func restoreSecurityGroupRules(ctx context.Context, accessKeyId, accessKeySecret, regionId string, record securityGroupRecord) *spec.Response {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create aws config failed")
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	if len(record.Ingress) > 0 {
+		_, _err = client.AuthorizeSecurityGroupIngress(context.TODO(), &ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       aws.String(record.GroupId),
+			IpPermissions: record.Ingress,
+		})
+		if _err != nil {
+			log.Errorf(ctx, "authorize ingress of aws security group failed, err: %s", _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "authorize ingress of aws security group failed")
+		}
+	}
+	if len(record.Egress) > 0 {
+		_, _err = client.AuthorizeSecurityGroupEgress(context.TODO(), &ec2.AuthorizeSecurityGroupEgressInput{
+			GroupId:       aws.String(record.GroupId),
+			IpPermissions: record.Egress,
+		})
+		if _err != nil {
+			log.Errorf(ctx, "authorize egress of aws security group failed, err: %s", _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "authorize egress of aws security group failed")
+		}
+	}
+	return spec.Success()
+}
+
+// describe network interfaces by id or the instances attached to
+func describeAwsNetworkInterfaces(ctx context.Context, accessKeyId, accessKeySecret, regionId string, instances, networkInterfaces []string) (_result []types.NetworkInterface, _err error) {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	inputs := []*ec2.DescribeNetworkInterfacesInput{}
+	if len(networkInterfaces) > 0 {
+		inputs = append(inputs, &ec2.DescribeNetworkInterfacesInput{NetworkInterfaceIds: networkInterfaces})
+	}
+	if len(instances) > 0 {
+		inputs = append(inputs, &ec2.DescribeNetworkInterfacesInput{
+			Filters: []types.Filter{{Name: aws.String("attachment.instance-id"), Values: instances}},
+		})
+	}
+	seen := map[string]bool{}
+	for _, input := range inputs {
+		paginator := ec2.NewDescribeNetworkInterfacesPaginator(client, input)
+		for paginator.HasMorePages() {
+			page, _err := paginator.NextPage(context.TODO())
+			if _err != nil {
+				log.Errorf(ctx, "describe aws network interfaces failed, err: %s", _err.Error())
+				return _result, _err
+			}
+			for _, networkInterface := range page.NetworkInterfaces {
+				if seen[aws.ToString(networkInterface.NetworkInterfaceId)] {
+					continue
+				}
+				seen[aws.ToString(networkInterface.NetworkInterfaceId)] = true
+				_result = append(_result, networkInterface)
+			}
+		}
+	}
+	return _result, _err
+}
+
+// describe security group
+func describeAwsSecurityGroup(ctx context.Context, accessKeyId, accessKeySecret, regionId, securityGroupId string) (_result *types.SecurityGroup, _err error) {
+	cfg, _err := CreateConfig(accessKeyId, accessKeySecret, regionId)
+	if _err != nil {
+		log.Errorf(ctx, "create aws config failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	resp, _err := client.DescribeSecurityGroups(context.TODO(), &ec2.DescribeSecurityGroupsInput{
+		GroupIds: []string{securityGroupId},
+	})
+	if _err != nil {
+		log.Errorf(ctx, "describe aws security group failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	if len(resp.SecurityGroups) == 0 {
+		_err = fmt.Errorf("security group %s not found", securityGroupId)
+		log.Errorf(ctx, "describe aws security group failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	_result = &resp.SecurityGroups[0]
+	return _result, _err
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+func TestAwsSecurityGroupIsolate(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := isolateNetworkInterfaces(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "us-west-2", []string{"instance1"}, []string{"eni-1"})
+	assert.Equal(t, int32(48000), result.Code, "they should be equal")
+}
+
+func TestAwsSecurityGroupRevoke(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := revokeSecurityGroupRules(context.WithValue(context.Background(), "uid", "123"), "123", "accessKeyId", "accessKeySecret", "us-west-2", "sg-1", "all")
+	assert.Equal(t, int32(48000), result.Code, "they should be equal")
+}
+
+func TestAwsSecurityGroupRestoreRules(t *testing.T) {
+	record := securityGroupRecord{
+		GroupId: "sg-1",
+		Ingress: []types.IpPermission{{IpProtocol: aws.String("tcp"), FromPort: aws.Int32(22), ToPort: aws.Int32(22)}},
+	}
+	result := restoreSecurityGroupRules(context.WithValue(context.Background(), "uid", "123"), "accessKeyId", "accessKeySecret", "us-west-2", record)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestAwsSecurityGroupRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	record := securityGroupRecord{
+		GroupId:           "sg-1",
+		NetworkInterfaces: []networkInterfaceGroups{{NetworkInterfaceId: "eni-1", Groups: []string{"sg-2", "sg-3"}}},
+		Ingress: []types.IpPermission{{
+			IpProtocol: aws.String("tcp"),
+			FromPort:   aws.Int32(22),
+			ToPort:     aws.Int32(22),
+			IpRanges:   []types.IpRange{{CidrIp: aws.String("10.0.0.0/8")}},
+		}},
+	}
+	assert.Nil(t, exec.SaveRecord("123", record))
+	var loaded securityGroupRecord
+	exist, err := exec.LoadRecord("123", &loaded)
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	assert.Equal(t, record, loaded, "they should be equal")
+}
+
+func TestAwsSecurityGroupStopWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := (&SecurityGroupExecutor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", "isolate", "accessKeyId", "accessKeySecret", "us-west-2")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
+
+func TestAwsSecurityGroupStopMismatchedRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	assert.Nil(t, exec.SaveRecord("123", securityGroupRecord{OperationType: "revoke", GroupId: "sg-1"}))
+	result := (&SecurityGroupExecutor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", "isolate", "accessKeyId", "accessKeySecret", "us-west-2")
+	assert.Equal(t, int32(47000), result.Code, "they should be equal")
+}
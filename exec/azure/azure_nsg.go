@@ -0,0 +1,292 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const NsgBin = "chaos_azure_nsg"
+
+// the prefix of the deny rule name, the experiment uid is appended so that destroy can find it
+const nsgDenyRulePrefix = "chaosblade-deny-"
+
+type NsgActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewNsgActionSpec() spec.ExpActionCommandSpec {
+	return &NsgActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "subscriptionId",
+					Desc: "the subscriptionId of azure, if not provided, get from env AZURE_SUBSCRIPTION_ID",
+				},
+				&spec.ExpFlag{
+					Name: "tenantId",
+					Desc: "the tenantId of service principal, if not provided, get from env AZURE_TENANT_ID",
+				},
+				&spec.ExpFlag{
+					Name: "clientId",
+					Desc: "the clientId of service principal or user assigned managed identity, if not provided, get from env AZURE_CLIENT_ID",
+				},
+				&spec.ExpFlag{
+					Name: "clientSecret",
+					Desc: "the clientSecret of service principal, if not provided, get from env AZURE_CLIENT_SECRET, the managed identity is used if it is absent",
+				},
+				&spec.ExpFlag{
+					Name: "resourceGroup",
+					Desc: "the resource group of network security group",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of network security group, support deny",
+				},
+				&spec.ExpFlag{
+					Name: "nsgName",
+					Desc: "the name of network security group",
+				},
+				&spec.ExpFlag{
+					Name:    "direction",
+					Desc:    "the direction of deny rule, support Inbound, Outbound, default is Inbound",
+					Default: "Inbound",
+				},
+				&spec.ExpFlag{
+					Name:    "protocol",
+					Desc:    "the protocol of deny rule, support Tcp, Udp, Icmp, Esp, Ah, *, default is *",
+					Default: "*",
+				},
+				&spec.ExpFlag{
+					Name:    "ports",
+					Desc:    "the destination ports or port ranges of deny rule, split by comma, like 80,8000-8080, default is *",
+					Default: "*",
+				},
+				&spec.ExpFlag{
+					Name:    "sourceAddresses",
+					Desc:    "the source address prefixes of deny rule, split by comma, like 10.0.0.0/24,VirtualNetwork, default is *",
+					Default: "*",
+				},
+				&spec.ExpFlag{
+					Name:    "destinationAddresses",
+					Desc:    "the destination address prefixes of deny rule, split by comma, default is *",
+					Default: "*",
+				},
+				&spec.ExpFlag{
+					Name:    "priority",
+					Desc:    "the priority of deny rule in [100, 4096], it must be lower than the rules to override, default is 100",
+					Default: "100",
+				},
+			},
+			ActionExecutor: &NsgExecutor{},
+			ActionExample: `
+# deny all inbound traffic of network security group nsg-x
+blade create azure nsg --subscriptionId s-x --tenantId t-x --clientId c-x --clientSecret yyy --resourceGroup rg-x --type deny --nsgName nsg-x
+
+# deny outbound tcp traffic to port 3306 of 10.0.1.0/24 with priority 200
+blade create azure nsg --subscriptionId s-x --resourceGroup rg-x --type deny --nsgName nsg-x --direction Outbound --protocol Tcp --ports 3306 --destinationAddresses 10.0.1.0/24 --priority 200`,
+			ActionPrograms:   []string{NsgBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Azure + "_" + category.Nsg},
+		},
+	}
+}
+
+func (*NsgActionSpec) Name() string {
+	return "nsg"
+}
+
+func (*NsgActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*NsgActionSpec) ShortDesc() string {
+	return "do some azure network security group Operations, like deny"
+}
+
+func (b *NsgActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some azure network security group Operations, like deny the traffic by adding a high priority deny rule. " +
+		"The deny rule is deleted on destroy"
+}
+
+type NsgExecutor struct {
+	channel spec.Channel
+}
+
+func (*NsgExecutor) Name() string {
+	return "nsg"
+}
+
+func (be *NsgExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	resourceGroup := model.ActionFlags["resourceGroup"]
+	operationType := model.ActionFlags["type"]
+	nsgName := model.ActionFlags["nsgName"]
+	direction := model.ActionFlags["direction"]
+	protocol := model.ActionFlags["protocol"]
+	ports := model.ActionFlags["ports"]
+	sourceAddresses := model.ActionFlags["sourceAddresses"]
+	destinationAddresses := model.ActionFlags["destinationAddresses"]
+	priority := model.ActionFlags["priority"]
+	subscriptionId, credential, response := createCredentialByFlags(ctx, model)
+	if response != nil {
+		return response
+	}
+
+	if resourceGroup == "" {
+		log.Errorf(ctx, "resourceGroup is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "resourceGroup")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if operationType != "deny" {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support deny)")
+	}
+
+	if nsgName == "" {
+		log.Errorf(ctx, "nsgName is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "nsgName")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return deleteAzureSecurityRule(ctx, credential, subscriptionId, resourceGroup, nsgName, nsgDenyRulePrefix+uid)
+	}
+
+	if direction == "" {
+		direction = string(armnetwork.SecurityRuleDirectionInbound)
+	}
+	var ok bool
+	if direction, ok = supportedValue(direction, armnetwork.PossibleSecurityRuleDirectionValues()); !ok {
+		return spec.ResponseFailWithFlags(spec.ParameterIllegal, "direction", direction, "it must be Inbound or Outbound")
+	}
+	if protocol == "" {
+		protocol = string(armnetwork.SecurityRuleProtocolAsterisk)
+	}
+	if protocol, ok = supportedValue(protocol, armnetwork.PossibleSecurityRuleProtocolValues()); !ok {
+		return spec.ResponseFailWithFlags(spec.ParameterIllegal, "protocol", protocol, "it must be one of Tcp, Udp, Icmp, Esp, Ah, *")
+	}
+	priorityValue := 100
+	if priority != "" {
+		var err error
+		if priorityValue, err = strconv.Atoi(priority); err != nil || priorityValue < 100 || priorityValue > 4096 {
+			return spec.ResponseFailWithFlags(spec.ParameterIllegal, "priority", priority, "it must be in [100, 4096]")
+		}
+	}
+	rule := nsgDenyRule(direction, protocol, exec.SplitFlag(ports), exec.SplitFlag(sourceAddresses), exec.SplitFlag(destinationAddresses), int32(priorityValue), uid)
+	return createAzureSecurityRule(ctx, credential, subscriptionId, resourceGroup, nsgName, nsgDenyRulePrefix+uid, rule)
+}
+
+func (be *NsgExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// build the deny rule, the single value and multiple values are set to different fields as azure requires
+func nsgDenyRule(direction, protocol string, ports, sourceAddresses, destinationAddresses []string, priority int32, uid string) armnetwork.SecurityRule {
+	properties := &armnetwork.SecurityRulePropertiesFormat{
+		Access:          to.Ptr(armnetwork.SecurityRuleAccessDeny),
+		Direction:       to.Ptr(armnetwork.SecurityRuleDirection(direction)),
+		Protocol:        to.Ptr(armnetwork.SecurityRuleProtocol(protocol)),
+		Priority:        to.Ptr(priority),
+		Description:     to.Ptr("created by chaosblade experiment " + uid),
+		SourcePortRange: to.Ptr("*"),
+	}
+	properties.DestinationPortRange, properties.DestinationPortRanges = singleOrMultiple(ports)
+	properties.SourceAddressPrefix, properties.SourceAddressPrefixes = singleOrMultiple(sourceAddresses)
+	properties.DestinationAddressPrefix, properties.DestinationAddressPrefixes = singleOrMultiple(destinationAddresses)
+	return armnetwork.SecurityRule{Properties: properties}
+}
+
+// return the single value if there is only one, otherwise the multiple values, * is used if there is none
+func singleOrMultiple(values []string) (*string, []*string) {
+	switch len(values) {
+	case 0:
+		return to.Ptr("*"), nil
+	case 1:
+		return to.Ptr(values[0]), nil
+	default:
+		return nil, to.SliceOfPtrs(values...)
+	}
+}
+
+// find the supported value which equals to the value case insensitively
+func supportedValue[T ~string](value string, supported []T) (string, bool) {
+	for _, s := range supported {
+		if strings.EqualFold(value, string(s)) {
+			return string(s), true
+		}
+	}
+	return value, false
+}
+
+// create or update the security rule of network security group and wait until it is provisioned
+func createAzureSecurityRule(ctx context.Context, credential azcore.TokenCredential, subscriptionId, resourceGroup, nsgName, ruleName string, rule armnetwork.SecurityRule) *spec.Response {
+	client, _err := armnetwork.NewSecurityRulesClient(subscriptionId, credential, armClientOptions)
+	if _err != nil {
+		log.Errorf(ctx, "create azure security rules client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create azure security rules client failed")
+	}
+
+	poller, _err := client.BeginCreateOrUpdate(ctx, resourceGroup, nsgName, ruleName, rule, nil)
+	if _err == nil {
+		_, _err = poller.PollUntilDone(ctx, nil)
+	}
+	if _err != nil {
+		log.Errorf(ctx, "create azure security rule %s of %s failed, err: %s", ruleName, nsgName, _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create azure security rule failed")
+	}
+	return spec.Success()
+}
+
+// delete the security rule of network security group and wait until it is deleted
+func deleteAzureSecurityRule(ctx context.Context, credential azcore.TokenCredential, subscriptionId, resourceGroup, nsgName, ruleName string) *spec.Response {
+	client, _err := armnetwork.NewSecurityRulesClient(subscriptionId, credential, armClientOptions)
+	if _err != nil {
+		log.Errorf(ctx, "create azure security rules client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create azure security rules client failed")
+	}
+
+	poller, _err := client.BeginDelete(ctx, resourceGroup, nsgName, ruleName, nil)
+	if _err == nil {
+		_, _err = poller.PollUntilDone(ctx, nil)
+	}
+	if _err != nil {
+		log.Errorf(ctx, "delete azure security rule %s of %s failed, err: %s", ruleName, nsgName, _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "delete azure security rule failed")
+	}
+	return spec.Success()
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/chaosblade-io/chaosblade-spec-go/channel"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAzureNsgDenyRule(t *testing.T) {
+	rule := nsgDenyRule("Outbound", "Tcp", []string{"3306"}, []string{"*"}, []string{"10.0.1.0/24", "10.0.2.0/24"}, 200, "123")
+	assert.Equal(t, "Deny", string(*rule.Properties.Access), "they should be equal")
+	assert.Equal(t, "Outbound", string(*rule.Properties.Direction), "they should be equal")
+	assert.Equal(t, int32(200), *rule.Properties.Priority, "they should be equal")
+	assert.Equal(t, "3306", *rule.Properties.DestinationPortRange, "they should be equal")
+	assert.Nil(t, rule.Properties.DestinationPortRanges)
+	assert.Equal(t, "*", *rule.Properties.SourceAddressPrefix, "they should be equal")
+	assert.Nil(t, rule.Properties.DestinationAddressPrefix)
+	assert.Equal(t, to.SliceOfPtrs("10.0.1.0/24", "10.0.2.0/24"), rule.Properties.DestinationAddressPrefixes, "they should be equal")
+
+	rule = nsgDenyRule("Inbound", "*", nil, nil, nil, 100, "123")
+	assert.Equal(t, "*", *rule.Properties.DestinationPortRange, "they should be equal")
+	assert.Equal(t, "*", *rule.Properties.DestinationAddressPrefix, "they should be equal")
+}
+
+func TestAzureNsgDeny(t *testing.T) {
+	fake := newFakeArm(t)
+	ctx := context.WithValue(context.Background(), "uid", "123")
+	rule := nsgDenyRule("Inbound", "Tcp", []string{"80", "443"}, nil, nil, 100, "123")
+
+	result := createAzureSecurityRule(ctx, fakeCredential{}, "s-x", "rg-x", "nsg-x", nsgDenyRulePrefix+"123", rule)
+	assert.True(t, result.Success, result.Err)
+	properties := fake.rules["chaosblade-deny-123"]["properties"].(map[string]interface{})
+	assert.Equal(t, "Deny", properties["access"], "they should be equal")
+	assert.Equal(t, []interface{}{"80", "443"}, properties["destinationPortRanges"], "they should be equal")
+
+	result = deleteAzureSecurityRule(ctx, fakeCredential{}, "s-x", "rg-x", "nsg-x", nsgDenyRulePrefix+"123")
+	assert.True(t, result.Success, result.Err)
+	assert.Empty(t, fake.rules, "the deny rule should be deleted")
+}
+
+func TestAzureNsgIllegalFlags(t *testing.T) {
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	model := &spec.ExpModel{ActionFlags: map[string]string{
+		"subscriptionId": "s-x",
+		"tenantId":       "t-x",
+		"clientId":       "c-x",
+		"clientSecret":   "yyy",
+		"resourceGroup":  "rg-x",
+		"type":           "deny",
+		"nsgName":        "nsg-x",
+		"direction":      "inbound",
+		"priority":       "50",
+	}}
+	result := (&NsgExecutor{channel: channel.NewLocalChannel()}).Exec("123", context.Background(), model)
+	assert.Equal(t, int32(46000), result.Code, "they should be equal")
+
+	model.ActionFlags["protocol"] = "http"
+	result = (&NsgExecutor{channel: channel.NewLocalChannel()}).Exec("123", context.Background(), model)
+	assert.Equal(t, int32(46000), result.Code, "they should be equal")
+
+	direction, ok := supportedValue("inbound", []string{"Inbound", "Outbound"})
+	assert.True(t, ok)
+	assert.Equal(t, "Inbound", direction, "they should be equal")
+}
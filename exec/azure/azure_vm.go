@@ -0,0 +1,370 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const VmBin = "chaos_azure_vm"
+
+// the options of azure resource manager clients, the default public cloud is used if it is nil
+var armClientOptions *arm.ClientOptions
+
+type VmActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewVmActionSpec() spec.ExpActionCommandSpec {
+	return &VmActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "subscriptionId",
+					Desc: "the subscriptionId of azure, if not provided, get from env AZURE_SUBSCRIPTION_ID",
+				},
+				&spec.ExpFlag{
+					Name: "tenantId",
+					Desc: "the tenantId of service principal, if not provided, get from env AZURE_TENANT_ID",
+				},
+				&spec.ExpFlag{
+					Name: "clientId",
+					Desc: "the clientId of service principal or user assigned managed identity, if not provided, get from env AZURE_CLIENT_ID",
+				},
+				&spec.ExpFlag{
+					Name: "clientSecret",
+					Desc: "the clientSecret of service principal, if not provided, get from env AZURE_CLIENT_SECRET, the managed identity is used if it is absent",
+				},
+				&spec.ExpFlag{
+					Name: "resourceGroup",
+					Desc: "the resource group of virtual machines",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of virtual machines, support deallocate, powerOff, restart",
+				},
+				&spec.ExpFlag{
+					Name: "vms",
+					Desc: "the virtual machine names list, split by comma",
+				},
+				&spec.ExpFlag{
+					Name:    "skipShutdown",
+					Desc:    "power off the virtual machines without graceful shutdown when operationType is powerOff, default is false",
+					Default: "false",
+				},
+			},
+			ActionExecutor: &VmExecutor{},
+			ActionExample: `
+# deallocate virtual machines which name is vm-x,vm-y by service principal
+blade create azure vm --subscriptionId s-x --tenantId t-x --clientId c-x --clientSecret yyy --resourceGroup rg-x --type deallocate --vms vm-x,vm-y
+
+# power off virtual machines which name is vm-x,vm-y by the managed identity
+blade create azure vm --subscriptionId s-x --resourceGroup rg-x --type powerOff --vms vm-x,vm-y
+
+# restart virtual machines which name is vm-x,vm-y
+blade create azure vm --subscriptionId s-x --resourceGroup rg-x --type restart --vms vm-x,vm-y`,
+			ActionPrograms:   []string{VmBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Azure + "_" + category.Vm},
+		},
+	}
+}
+
+func (*VmActionSpec) Name() string {
+	return "vm"
+}
+
+func (*VmActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*VmActionSpec) ShortDesc() string {
+	return "do some azure virtual machine Operations, like deallocate, powerOff, restart"
+}
+
+func (b *VmActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some azure virtual machine Operations, like deallocate, powerOff, restart. " +
+		"The deallocated and powered off virtual machines are started on destroy, restart can not be recovered"
+}
+
+type VmExecutor struct {
+	channel spec.Channel
+}
+
+func (*VmExecutor) Name() string {
+	return "vm"
+}
+
+// the power state after the operation, the virtual machines still in it are started on destroy
+var vmInjectedPowerState = map[string]string{
+	"deallocate": "PowerState/deallocated",
+	"powerOff":   "PowerState/stopped",
+}
+
+func (be *VmExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	resourceGroup := model.ActionFlags["resourceGroup"]
+	operationType := model.ActionFlags["type"]
+	vms := model.ActionFlags["vms"]
+	skipShutdown := model.ActionFlags["skipShutdown"] == "true"
+	subscriptionId, credential, response := createCredentialByFlags(ctx, model)
+	if response != nil {
+		return response
+	}
+
+	if resourceGroup == "" {
+		log.Errorf(ctx, "resourceGroup is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "resourceGroup")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if vms == "" {
+		log.Errorf(ctx, "vms is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "vms")
+	}
+	vmsArray := strings.Split(vms, ",")
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, operationType, credential, subscriptionId, resourceGroup, vmsArray)
+	}
+	return be.start(ctx, operationType, credential, subscriptionId, resourceGroup, vmsArray, skipShutdown)
+}
+
+func (be *VmExecutor) start(ctx context.Context, operationType string, credential azcore.TokenCredential, subscriptionId, resourceGroup string, vms []string, skipShutdown bool) *spec.Response {
+	switch operationType {
+	case "deallocate":
+		return deallocateAzureVms(ctx, credential, subscriptionId, resourceGroup, vms)
+	case "powerOff":
+		return powerOffAzureVms(ctx, credential, subscriptionId, resourceGroup, vms, skipShutdown)
+	case "restart":
+		return restartAzureVms(ctx, credential, subscriptionId, resourceGroup, vms)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support deallocate, powerOff, restart)")
+	}
+}
+
+func (be *VmExecutor) stop(ctx context.Context, operationType string, credential azcore.TokenCredential, subscriptionId, resourceGroup string, vms []string) *spec.Response {
+	if operationType == "restart" {
+		// the restarted virtual machines recover by themselves
+		log.Infof(ctx, "nothing to recover for restarted virtual machines %v", vms)
+		return spec.Success()
+	}
+	injectedPowerState, ok := vmInjectedPowerState[operationType]
+	if !ok {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support deallocate, powerOff, restart)")
+	}
+	powerStateMap, _err := describeAzureVmsPowerState(ctx, credential, subscriptionId, resourceGroup, vms)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe azure virtual machines power state failed")
+	}
+	// only the virtual machines still in the injected power state are recovered
+	var recovering []string
+	for _, vm := range vms {
+		if powerStateMap[vm] == injectedPowerState {
+			recovering = append(recovering, vm)
+		}
+	}
+	if len(recovering) == 0 {
+		log.Infof(ctx, "no virtual machine of %v is %s, nothing to recover", vms, injectedPowerState)
+		return spec.Success()
+	}
+	return startAzureVms(ctx, credential, subscriptionId, resourceGroup, recovering)
+}
+
+func (be *VmExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// get the subscription id and create the credential by the flags or env
+func createCredentialByFlags(ctx context.Context, model *spec.ExpModel) (string, azcore.TokenCredential, *spec.Response) {
+	subscriptionId := flagOrEnv(model, "subscriptionId", "AZURE_SUBSCRIPTION_ID")
+	tenantId := flagOrEnv(model, "tenantId", "AZURE_TENANT_ID")
+	clientId := flagOrEnv(model, "clientId", "AZURE_CLIENT_ID")
+	clientSecret := flagOrEnv(model, "clientSecret", "AZURE_CLIENT_SECRET")
+	if subscriptionId == "" {
+		log.Errorf(ctx, "could not get AZURE_SUBSCRIPTION_ID from env or parameter!")
+		return "", nil, spec.ResponseFailWithFlags(spec.ParameterLess, "subscriptionId")
+	}
+	if clientSecret != "" && tenantId == "" {
+		log.Errorf(ctx, "could not get AZURE_TENANT_ID of service principal from env or parameter!")
+		return "", nil, spec.ResponseFailWithFlags(spec.ParameterLess, "tenantId")
+	}
+	if clientSecret != "" && clientId == "" {
+		log.Errorf(ctx, "could not get AZURE_CLIENT_ID of service principal from env or parameter!")
+		return "", nil, spec.ResponseFailWithFlags(spec.ParameterLess, "clientId")
+	}
+	credential, _err := CreateCredential(tenantId, clientId, clientSecret)
+	if _err != nil {
+		log.Errorf(ctx, "create azure credential failed, err: %s", _err.Error())
+		return "", nil, spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create azure credential failed")
+	}
+	return subscriptionId, credential, nil
+}
+
+// get the flag value, or the env value if the flag is not provided
+func flagOrEnv(model *spec.ExpModel, flag, env string) string {
+	if value := model.ActionFlags[flag]; value != "" {
+		return value
+	}
+	return os.Getenv(env)
+}
+
+// CreateCredential creates the service principal credential if clientSecret is provided, otherwise the managed identity credential
+func CreateCredential(tenantId, clientId, clientSecret string) (azcore.TokenCredential, error) {
+	if clientSecret != "" {
+		return azidentity.NewClientSecretCredential(tenantId, clientId, clientSecret, nil)
+	}
+	options := &azidentity.ManagedIdentityCredentialOptions{}
+	if clientId != "" {
+		options.ID = azidentity.ClientID(clientId)
+	}
+	return azidentity.NewManagedIdentityCredential(options)
+}
+
+// start virtual machines and wait until they are running
+func startAzureVms(ctx context.Context, credential azcore.TokenCredential, subscriptionId, resourceGroup string, vms []string) *spec.Response {
+	client, _err := armcompute.NewVirtualMachinesClient(subscriptionId, credential, armClientOptions)
+	if _err != nil {
+		log.Errorf(ctx, "create azure virtual machines client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create azure virtual machines client failed")
+	}
+
+	pollers := map[string]*runtime.Poller[armcompute.VirtualMachinesClientStartResponse]{}
+	for _, vm := range vms {
+		if pollers[vm], _err = client.BeginStart(ctx, resourceGroup, vm, nil); _err != nil {
+			log.Errorf(ctx, "start azure virtual machine %s failed, err: %s", vm, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "start azure virtual machines failed")
+		}
+	}
+	return waitAzureVmPollers(ctx, "start", pollers)
+}
+
+// deallocate virtual machines and wait until they are deallocated, the compute resources are released
+func deallocateAzureVms(ctx context.Context, credential azcore.TokenCredential, subscriptionId, resourceGroup string, vms []string) *spec.Response {
+	client, _err := armcompute.NewVirtualMachinesClient(subscriptionId, credential, armClientOptions)
+	if _err != nil {
+		log.Errorf(ctx, "create azure virtual machines client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create azure virtual machines client failed")
+	}
+
+	pollers := map[string]*runtime.Poller[armcompute.VirtualMachinesClientDeallocateResponse]{}
+	for _, vm := range vms {
+		if pollers[vm], _err = client.BeginDeallocate(ctx, resourceGroup, vm, nil); _err != nil {
+			log.Errorf(ctx, "deallocate azure virtual machine %s failed, err: %s", vm, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "deallocate azure virtual machines failed")
+		}
+	}
+	return waitAzureVmPollers(ctx, "deallocate", pollers)
+}
+
+// power off virtual machines and wait until they are stopped, the compute resources are still allocated and billed
+func powerOffAzureVms(ctx context.Context, credential azcore.TokenCredential, subscriptionId, resourceGroup string, vms []string, skipShutdown bool) *spec.Response {
+	client, _err := armcompute.NewVirtualMachinesClient(subscriptionId, credential, armClientOptions)
+	if _err != nil {
+		log.Errorf(ctx, "create azure virtual machines client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create azure virtual machines client failed")
+	}
+
+	pollers := map[string]*runtime.Poller[armcompute.VirtualMachinesClientPowerOffResponse]{}
+	for _, vm := range vms {
+		pollers[vm], _err = client.BeginPowerOff(ctx, resourceGroup, vm, &armcompute.VirtualMachinesClientBeginPowerOffOptions{
+			SkipShutdown: to.Ptr(skipShutdown),
+		})
+		if _err != nil {
+			log.Errorf(ctx, "power off azure virtual machine %s failed, err: %s", vm, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "power off azure virtual machines failed")
+		}
+	}
+	return waitAzureVmPollers(ctx, "power off", pollers)
+}
+
+// restart virtual machines
+func restartAzureVms(ctx context.Context, credential azcore.TokenCredential, subscriptionId, resourceGroup string, vms []string) *spec.Response {
+	client, _err := armcompute.NewVirtualMachinesClient(subscriptionId, credential, armClientOptions)
+	if _err != nil {
+		log.Errorf(ctx, "create azure virtual machines client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create azure virtual machines client failed")
+	}
+
+	for _, vm := range vms {
+		if _, _err = client.BeginRestart(ctx, resourceGroup, vm, nil); _err != nil {
+			log.Errorf(ctx, "restart azure virtual machine %s failed, err: %s", vm, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "restart azure virtual machines failed")
+		}
+	}
+	return spec.Success()
+}
+
+// wait until the long running operations on virtual machines are done, so that the virtual machines are not left in
+// transitional power states, like PowerState/deallocating, which are not recovered on destroy
+func waitAzureVmPollers[T any](ctx context.Context, operation string, pollers map[string]*runtime.Poller[T]) *spec.Response {
+	for vm, poller := range pollers {
+		if _, _err := poller.PollUntilDone(ctx, nil); _err != nil {
+			log.Errorf(ctx, "wait %s azure virtual machine %s failed, err: %s", operation, vm, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "wait "+operation+" azure virtual machines failed")
+		}
+	}
+	return spec.Success()
+}
+
+// describe the power state of virtual machines, like PowerState/running
+func describeAzureVmsPowerState(ctx context.Context, credential azcore.TokenCredential, subscriptionId, resourceGroup string, vms []string) (_result map[string]string, _err error) {
+	client, _err := armcompute.NewVirtualMachinesClient(subscriptionId, credential, armClientOptions)
+	if _err != nil {
+		log.Errorf(ctx, "create azure virtual machines client failed, err: %s", _err.Error())
+		return _result, _err
+	}
+
+	powerStateMap := map[string]string{}
+	for _, vm := range vms {
+		resp, _err := client.InstanceView(ctx, resourceGroup, vm, nil)
+		if _err != nil {
+			log.Errorf(ctx, "describe azure virtual machine %s failed, err: %s", vm, _err.Error())
+			return _result, _err
+		}
+		for _, status := range resp.Statuses {
+			if status != nil && status.Code != nil && strings.HasPrefix(*status.Code, "PowerState/") {
+				powerStateMap[vm] = *status.Code
+			}
+		}
+	}
+	_result = powerStateMap
+	return _result, nil
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCredential issues a static token without calling azure active directory
+type fakeCredential struct{}
+
+func (fakeCredential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// fakeArm is a local resource manager stand-in which keeps the virtual machines and security rules of rg-x
+type fakeArm struct {
+	sync.Mutex
+	powerStates map[string]string
+	rules       map[string]map[string]interface{}
+	// the deallocate and power off operations keep the transitional power state until the operation is polled
+	settled map[string]string
+}
+
+func (f *fakeArm) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	const vmPrefix = "/subscriptions/s-x/resourceGroups/rg-x/providers/Microsoft.Compute/virtualMachines/"
+	const rulePrefix = "/subscriptions/s-x/resourceGroups/rg-x/providers/Microsoft.Network/networkSecurityGroups/nsg-x/securityRules/"
+	const operationPrefix = "/operations/"
+	switch {
+	case strings.HasPrefix(r.URL.Path, operationPrefix):
+		vm := strings.TrimPrefix(r.URL.Path, operationPrefix)
+		f.powerStates[vm] = f.settled[vm]
+		delete(f.settled, vm)
+	case strings.HasPrefix(r.URL.Path, vmPrefix):
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, vmPrefix), "/")
+		if _, ok := f.powerStates[parts[0]]; !ok || len(parts) != 2 {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":"ResourceNotFound","message":"not found"}}`))
+			return
+		}
+		if parts[1] == "instanceView" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"statuses": []map[string]string{
+				{"code": "ProvisioningState/succeeded"},
+				{"code": f.powerStates[parts[0]]},
+			}})
+			return
+		}
+		if transitional, ok := map[string]string{"deallocate": "PowerState/deallocating", "powerOff": "PowerState/stopping"}[parts[1]]; ok {
+			f.settled[parts[0]] = map[string]string{"deallocate": "PowerState/deallocated", "powerOff": "PowerState/stopped"}[parts[1]]
+			f.powerStates[parts[0]] = transitional
+			w.Header().Set("Location", "https://"+r.Host+operationPrefix+parts[0])
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		f.powerStates[parts[0]] = map[string]string{
+			"restart": "PowerState/running",
+			"start":   "PowerState/running",
+		}[parts[1]]
+	case strings.HasPrefix(r.URL.Path, rulePrefix):
+		name := strings.TrimPrefix(r.URL.Path, rulePrefix)
+		switch r.Method {
+		case http.MethodPut:
+			var rule map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&rule)
+			rule["properties"].(map[string]interface{})["provisioningState"] = "Succeeded"
+			f.rules[name] = rule
+			json.NewEncoder(w).Encode(rule)
+		case http.MethodDelete:
+			delete(f.rules, name)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// start the fake resource manager and point the clients to it
+func newFakeArm(t *testing.T) *fakeArm {
+	fake := &fakeArm{
+		powerStates: map[string]string{"vm-1": "PowerState/running", "vm-2": "PowerState/running"},
+		rules:       map[string]map[string]interface{}{},
+		settled:     map[string]string{},
+	}
+	server := httptest.NewTLSServer(fake)
+	armClientOptions = &arm.ClientOptions{ClientOptions: policy.ClientOptions{
+		Cloud: cloud.Configuration{Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+			cloud.ResourceManager: {Audience: server.URL, Endpoint: server.URL},
+		}},
+		Transport: server.Client(),
+	}}
+	t.Cleanup(func() {
+		armClientOptions = nil
+		server.Close()
+	})
+	return fake
+}
+
+func TestAzureVmDeallocate(t *testing.T) {
+	fake := newFakeArm(t)
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := (&VmExecutor{}).start(ctx, "deallocate", fakeCredential{}, "s-x", "rg-x", []string{"vm-1"}, false)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "PowerState/deallocated", fake.powerStates["vm-1"], "they should be equal")
+	assert.Equal(t, "PowerState/running", fake.powerStates["vm-2"], "they should be equal")
+
+	// only the deallocated virtual machines are started
+	fake.powerStates["vm-2"] = "PowerState/stopped"
+	result = (&VmExecutor{}).stop(ctx, "deallocate", fakeCredential{}, "s-x", "rg-x", []string{"vm-1", "vm-2"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "PowerState/running", fake.powerStates["vm-1"], "they should be equal")
+	assert.Equal(t, "PowerState/stopped", fake.powerStates["vm-2"], "they should be equal")
+}
+
+func TestAzureVmPowerOffAndRestart(t *testing.T) {
+	fake := newFakeArm(t)
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := (&VmExecutor{}).start(ctx, "powerOff", fakeCredential{}, "s-x", "rg-x", []string{"vm-1", "vm-2"}, true)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "PowerState/stopped", fake.powerStates["vm-1"], "they should be equal")
+
+	result = (&VmExecutor{}).stop(ctx, "powerOff", fakeCredential{}, "s-x", "rg-x", []string{"vm-1", "vm-2"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "PowerState/running", fake.powerStates["vm-1"], "they should be equal")
+	assert.Equal(t, "PowerState/running", fake.powerStates["vm-2"], "they should be equal")
+
+	result = (&VmExecutor{}).start(ctx, "restart", fakeCredential{}, "s-x", "rg-x", []string{"vm-3"}, false)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+
+	result = (&VmExecutor{}).start(ctx, "reboot", fakeCredential{}, "s-x", "rg-x", []string{"vm-1"}, false)
+	assert.Equal(t, int32(47000), result.Code, "they should be equal")
+}
@@ -20,6 +20,11 @@ const (
 	Cloud            = "cloud"
 	Aliyun           = "aliyun"
 	Aws              = "aws"
+	Gcp              = "gcp"
+	Azure            = "azure"
+	Tencent          = "tencent"
+	Huawei           = "huawei"
+	Openstack        = "openstack"
 	Ecs              = "ecs"
 	Ec2              = "ec2"
 	NetworkInterface = "networkInterface"
@@ -28,4 +33,26 @@ const (
 	SecurityGroup    = "securityGroup"
 	VSwitch          = "vSwitch"
 	Disk             = "disk"
+	Ess              = "ess"
+	Oss              = "oss"
+	AckNodePool      = "ackNodePool"
+	Ebs              = "ebs"
+	Eip              = "eip"
+	NetworkAcl       = "networkAcl"
+	Asg              = "asg"
+	Elb              = "elb"
+	Rds              = "rds"
+	RouteTable       = "routeTable"
+	S3               = "s3"
+	Lambda           = "lambda"
+	Dynamodb         = "dynamodb"
+	Route53          = "route53"
+	EcsTask          = "ecsTask"
+	EksNode          = "eksNode"
+	Gce              = "gce"
+	Vm               = "vm"
+	Nsg              = "nsg"
+	Cvm              = "cvm"
+	Server           = "server"
+	Port             = "port"
 )
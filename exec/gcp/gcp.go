@@ -0,0 +1,48 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+)
+
+type GcpCommandSpec struct {
+	spec.BaseExpModelCommandSpec
+}
+
+func NewGcpCommandSpec() spec.ExpModelCommandSpec {
+	return &GcpCommandSpec{
+		spec.BaseExpModelCommandSpec{
+			ExpActions: []spec.ExpActionCommandSpec{
+				NewGceActionSpec(),
+			},
+			ExpFlags: []spec.ExpFlagSpec{},
+		},
+	}
+}
+
+func (*GcpCommandSpec) Name() string {
+	return "gcp"
+}
+
+func (*GcpCommandSpec) ShortDesc() string {
+	return "Gcp experiment"
+}
+
+func (*GcpCommandSpec) LongDesc() string {
+	return "Gcp experiment contains gce"
+}
@@ -0,0 +1,451 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const GceBin = "chaos_gcp_gce"
+
+// the max time to wait for the instances in transitional states, like STOPPING, to be settled before recovering them
+const gceSettledTimeout = 10 * time.Minute
+
+// the interval to poll the status of instances in transitional states
+var gcePollInterval = 5 * time.Second
+
+// the extra options of compute client, like the disabled authentication of a local endpoint
+var computeClientOptions []option.ClientOption
+
+type GceActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewGceActionSpec() spec.ExpActionCommandSpec {
+	return &GceActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "credentialsFile",
+					Desc: "the service account json key file of gcp, if not provided, the application default credentials are used",
+				},
+				&spec.ExpFlag{
+					Name: "projectId",
+					Desc: "the projectId of gcp, if not provided, get from env GOOGLE_CLOUD_PROJECT or the credentials",
+				},
+				&spec.ExpFlag{
+					Name: "zone",
+					Desc: "the zone of instances, like us-central1-a",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of instances, support stop, start, reset, suspend",
+				},
+				&spec.ExpFlag{
+					Name: "instances",
+					Desc: "the instance names list, split by comma",
+				},
+				&spec.ExpFlag{
+					Name: "labels",
+					Desc: "the labels of instances, like env=test,app=web, the instances having all of them are selected if instances is not provided",
+				},
+				&spec.ExpFlag{
+					Name: "endpoint",
+					Desc: "the endpoint of compute api, like the private service connect endpoint",
+				},
+			},
+			ActionExecutor: &GceExecutor{},
+			ActionExample: `
+# stop instances which instance name is vm-x,vm-y
+blade create gcp gce --credentialsFile /path/to/key.json --projectId p-x --zone us-central1-a --type stop --instances vm-x,vm-y
+
+# suspend instances which have labels env=test and app=web by the application default credentials
+blade create gcp gce --projectId p-x --zone us-central1-a --type suspend --labels env=test,app=web
+
+# start instances which instance name is vm-x,vm-y
+blade create gcp gce --projectId p-x --zone us-central1-a --type start --instances vm-x,vm-y
+
+# reset instances which instance name is vm-x,vm-y
+blade create gcp gce --projectId p-x --zone us-central1-a --type reset --instances vm-x,vm-y`,
+			ActionPrograms:   []string{GceBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Gcp + "_" + category.Gce},
+		},
+	}
+}
+
+func (*GceActionSpec) Name() string {
+	return "gce"
+}
+
+func (*GceActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*GceActionSpec) ShortDesc() string {
+	return "do some gcp compute engine Operations, like stop, start, reset, suspend"
+}
+
+func (b *GceActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some gcp compute engine Operations, like stop, start, reset, suspend. " +
+		"The stopped instances are started, the started instances are stopped and the suspended instances are resumed on destroy, reset can not be recovered"
+}
+
+type GceExecutor struct {
+	channel spec.Channel
+}
+
+func (*GceExecutor) Name() string {
+	return "gce"
+}
+
+// gceRecord is the instances operated by the experiment
+type gceRecord struct {
+	ProjectId string   `json:"projectId"`
+	Zone      string   `json:"zone"`
+	Instances []string `json:"instances"`
+}
+
+// the instance status after the operation, the instances still in it are recovered on destroy
+var gceInjectedStatus = map[string]string{
+	"stop":    "TERMINATED",
+	"start":   "RUNNING",
+	"suspend": "SUSPENDED",
+}
+
+// the transitional status of instances, which settles to a stable one by itself
+var gceTransitionalStatus = map[string]bool{
+	"PROVISIONING": true,
+	"STAGING":      true,
+	"STOPPING":     true,
+	"SUSPENDING":   true,
+	"REPAIRING":    true,
+}
+
+func (be *GceExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	credentialsFile := model.ActionFlags["credentialsFile"]
+	projectId := model.ActionFlags["projectId"]
+	zone := model.ActionFlags["zone"]
+	operationType := model.ActionFlags["type"]
+	instances := model.ActionFlags["instances"]
+	labels := model.ActionFlags["labels"]
+	endpoint := model.ActionFlags["endpoint"]
+	if projectId == "" {
+		var err error
+		if projectId, err = defaultProjectId(credentialsFile); err != nil {
+			log.Errorf(ctx, "could not get projectId from env, credentials or parameter, err: %v", err)
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "projectId")
+		}
+	}
+
+	if zone == "" {
+		log.Errorf(ctx, "zone is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "zone")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, operationType, credentialsFile, endpoint)
+	}
+
+	switch operationType {
+	case "stop", "start", "reset", "suspend":
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support stop, start, reset, suspend)")
+	}
+
+	if instances == "" && labels == "" {
+		log.Errorf(ctx, "instances or labels is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "instances|labels")
+	}
+	labelsMap, err := parseLabels(labels)
+	if err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterIllegal, "labels", labels, err.Error())
+	}
+	return be.start(ctx, uid, operationType, credentialsFile, endpoint, projectId, zone, exec.SplitFlag(instances), labelsMap)
+}
+
+func (be *GceExecutor) start(ctx context.Context, uid, operationType, credentialsFile, endpoint, projectId, zone string, instances []string, labels map[string]string) *spec.Response {
+	if len(instances) == 0 {
+		var err error
+		instances, err = listGceInstancesByLabels(ctx, credentialsFile, endpoint, projectId, zone, labels)
+		if err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "list gcp instances failed")
+		}
+		if len(instances) == 0 {
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "labels", formatLabels(labels), "no instance has the labels in the zone")
+		}
+	}
+	if _, ok := gceInjectedStatus[operationType]; ok {
+		if _err := exec.SaveRecord(uid, gceRecord{ProjectId: projectId, Zone: zone, Instances: instances}); _err != nil {
+			log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+			return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+		}
+	}
+	return operateGceInstances(ctx, operationType, credentialsFile, endpoint, projectId, zone, instances)
+}
+
+func (be *GceExecutor) stop(ctx context.Context, uid, operationType, credentialsFile, endpoint string) *spec.Response {
+	if operationType == "reset" {
+		// the reset instances recover by themselves
+		log.Infof(ctx, "nothing to recover for reset instances of experiment %s", uid)
+		return spec.Success()
+	}
+	injectedStatus, ok := gceInjectedStatus[operationType]
+	if !ok {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support stop, start, reset, suspend)")
+	}
+	var record gceRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	instanceStatusMap, _err := describeSettledGceInstancesStatus(ctx, credentialsFile, endpoint, record.ProjectId, record.Zone, record.Instances)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe gcp instances status failed")
+	}
+	// only the instances still in the injected status are recovered
+	var recovering []string
+	for _, instance := range record.Instances {
+		if instanceStatusMap[instance] == injectedStatus {
+			recovering = append(recovering, instance)
+		}
+	}
+	if len(recovering) > 0 {
+		recoverOperation := map[string]string{"stop": "start", "start": "stop", "suspend": "resume"}[operationType]
+		if response := operateGceInstances(ctx, recoverOperation, credentialsFile, endpoint, record.ProjectId, record.Zone, recovering); !response.Success {
+			return response
+		}
+	} else {
+		log.Infof(ctx, "no instance of %v is %s, nothing to recover", record.Instances, injectedStatus)
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return spec.Success()
+}
+
+func (be *GceExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// CreateComputeService creates the compute service by the service account json key file or the application default credentials
+func CreateComputeService(ctx context.Context, credentialsFile, endpoint string) (*compute.Service, error) {
+	var opts []option.ClientOption
+	if endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+	if credentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(credentialsFile))
+	}
+	opts = append(opts, computeClientOptions...)
+	return compute.NewService(ctx, opts...)
+}
+
+// get the default project id from env or the credentials
+func defaultProjectId(credentialsFile string) (string, error) {
+	if projectId, ok := os.LookupEnv("GOOGLE_CLOUD_PROJECT"); ok && projectId != "" {
+		return projectId, nil
+	}
+	var credentials *google.Credentials
+	var err error
+	if credentialsFile != "" {
+		var data []byte
+		if data, err = os.ReadFile(credentialsFile); err != nil {
+			return "", err
+		}
+		credentials, err = google.CredentialsFromJSON(context.Background(), data, compute.ComputeScope)
+	} else {
+		credentials, err = google.FindDefaultCredentials(context.Background(), compute.ComputeScope)
+	}
+	if err != nil {
+		return "", err
+	}
+	if credentials.ProjectID == "" {
+		return "", errors.New("no project id in the credentials")
+	}
+	return credentials.ProjectID, nil
+}
+
+// stop, start, reset, suspend or resume instances
+func operateGceInstances(ctx context.Context, operationType, credentialsFile, endpoint, projectId, zone string, instances []string) *spec.Response {
+	service, _err := CreateComputeService(ctx, credentialsFile, endpoint)
+	if _err != nil {
+		log.Errorf(ctx, "create gcp compute service failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create gcp compute service failed")
+	}
+
+	for _, instance := range instances {
+		switch operationType {
+		case "stop":
+			_, _err = service.Instances.Stop(projectId, zone, instance).Context(ctx).Do()
+		case "start":
+			_, _err = service.Instances.Start(projectId, zone, instance).Context(ctx).Do()
+		case "reset":
+			_, _err = service.Instances.Reset(projectId, zone, instance).Context(ctx).Do()
+		case "suspend":
+			_, _err = service.Instances.Suspend(projectId, zone, instance).Context(ctx).Do()
+		case "resume":
+			_, _err = service.Instances.Resume(projectId, zone, instance).Context(ctx).Do()
+		default:
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support stop, start, reset, suspend)")
+		}
+		if _err != nil {
+			log.Errorf(ctx, "%s gcp instance %s failed, err: %s", operationType, instance, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, operationType+" gcp instances failed")
+		}
+	}
+	return spec.Success()
+}
+
+// list the names of instances which have all the labels
+func listGceInstancesByLabels(ctx context.Context, credentialsFile, endpoint, projectId, zone string, labels map[string]string) (_result []string, _err error) {
+	service, _err := CreateComputeService(ctx, credentialsFile, endpoint)
+	if _err != nil {
+		log.Errorf(ctx, "create gcp compute service failed, err: %s", _err.Error())
+		return _result, _err
+	}
+
+	_err = service.Instances.List(projectId, zone).Filter(labelsFilter(labels)).Pages(ctx, func(list *compute.InstanceList) error {
+		for _, instance := range list.Items {
+			_result = append(_result, instance.Name)
+		}
+		return nil
+	})
+	if _err != nil {
+		log.Errorf(ctx, "list gcp instances failed, err: %s", _err.Error())
+		return nil, _err
+	}
+	return _result, nil
+}
+
+// describe instances status
+func describeGceInstancesStatus(ctx context.Context, credentialsFile, endpoint, projectId, zone string, instances []string) (_result map[string]string, _err error) {
+	service, _err := CreateComputeService(ctx, credentialsFile, endpoint)
+	if _err != nil {
+		log.Errorf(ctx, "create gcp compute service failed, err: %s", _err.Error())
+		return _result, _err
+	}
+
+	statusMap := map[string]string{}
+	for _, name := range instances {
+		instance, _err := service.Instances.Get(projectId, zone, name).Context(ctx).Do()
+		if _err != nil {
+			log.Errorf(ctx, "describe gcp instance %s failed, err: %s", name, _err.Error())
+			return _result, _err
+		}
+		statusMap[name] = instance.Status
+	}
+	_result = statusMap
+	return _result, nil
+}
+
+// describe instances status after the instances in transitional states are settled, like STOPPING to TERMINATED,
+// so that the instances operated just now are not missed
+func describeSettledGceInstancesStatus(ctx context.Context, credentialsFile, endpoint, projectId, zone string, instances []string) (_result map[string]string, _err error) {
+	start := time.Now()
+	for {
+		_result, _err = describeGceInstancesStatus(ctx, credentialsFile, endpoint, projectId, zone, instances)
+		if _err != nil {
+			return _result, _err
+		}
+		var settling []string
+		for _, instance := range instances {
+			if gceTransitionalStatus[_result[instance]] {
+				settling = append(settling, instance)
+			}
+		}
+		if len(settling) == 0 {
+			return _result, nil
+		}
+		if time.Since(start) > gceSettledTimeout {
+			_err = fmt.Errorf("gcp instances %v are not settled after %s", settling, gceSettledTimeout)
+			log.Errorf(ctx, "wait gcp instances settled failed, err: %s", _err.Error())
+			return nil, _err
+		}
+		log.Infof(ctx, "wait gcp instances %v settled", settling)
+		time.Sleep(gcePollInterval)
+	}
+}
+
+// parse the labels like env=test,app=web
+func parseLabels(labels string) (map[string]string, error) {
+	labelsMap := map[string]string{}
+	for _, label := range exec.SplitFlag(labels) {
+		kv := strings.SplitN(label, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("the label %s must be like key=value", label)
+		}
+		labelsMap[kv[0]] = kv[1]
+	}
+	return labelsMap, nil
+}
+
+// format the labels like env=test,app=web sorted by key
+func formatLabels(labels map[string]string) string {
+	var pairs []string
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// build the filter of instances list which matches all the labels
+func labelsFilter(labels map[string]string) string {
+	var keys []string
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var conditions []string
+	for _, key := range keys {
+		conditions = append(conditions, fmt.Sprintf(`labels.%s = "%s"`, key, labels[key]))
+	}
+	return strings.Join(conditions, " AND ")
+}
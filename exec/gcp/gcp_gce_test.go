@@ -0,0 +1,189 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+type fakeInstance struct {
+	Name   string            `json:"name"`
+	Status string            `json:"status"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// fakeCompute is a local compute api stand-in which keeps the instances of project p-x in zone z-x
+type fakeCompute struct {
+	sync.Mutex
+	instances map[string]*fakeInstance
+	filters   []string
+	// when set, the stop and suspend operations report STOPPING and SUSPENDING to the first get
+	transitional bool
+	settled      map[string]string
+}
+
+func (f *fakeCompute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	path := strings.TrimPrefix(r.URL.Path, "/projects/p-x/zones/z-x/instances")
+	if path == "" && r.Method == http.MethodGet {
+		f.filters = append(f.filters, r.URL.Query().Get("filter"))
+		var items []*fakeInstance
+		for _, instance := range f.instances {
+			// the fake only understands the filter of a single label
+			if strings.Contains(r.URL.Query().Get("filter"), `labels.env = "test"`) && instance.Labels["env"] == "test" {
+				items = append(items, instance)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+		return
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	instance, ok := f.instances[parts[0]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":404,"message":"not found"}}`))
+		return
+	}
+	if len(parts) == 1 {
+		json.NewEncoder(w).Encode(instance)
+		if status, ok := f.settled[instance.Name]; ok {
+			instance.Status = status
+			delete(f.settled, instance.Name)
+		}
+		return
+	}
+	instance.Status = map[string]string{
+		"stop":    "TERMINATED",
+		"start":   "RUNNING",
+		"reset":   "RUNNING",
+		"suspend": "SUSPENDED",
+		"resume":  "RUNNING",
+	}[parts[1]]
+	if transitional, ok := map[string]string{"stop": "STOPPING", "suspend": "SUSPENDING"}[parts[1]]; ok && f.transitional {
+		f.settled[instance.Name] = instance.Status
+		instance.Status = transitional
+	}
+	w.Write([]byte(`{"name":"operation-1","status":"RUNNING"}`))
+}
+
+func newFakeCompute() *fakeCompute {
+	return &fakeCompute{instances: map[string]*fakeInstance{
+		"vm-1": {Name: "vm-1", Status: "RUNNING", Labels: map[string]string{"env": "test"}},
+		"vm-2": {Name: "vm-2", Status: "RUNNING", Labels: map[string]string{"env": "test"}},
+		"vm-3": {Name: "vm-3", Status: "RUNNING", Labels: map[string]string{"env": "prod"}},
+	}, settled: map[string]string{}}
+}
+
+func TestGcpGceStopByLabels(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	fake := newFakeCompute()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	computeClientOptions = []option.ClientOption{option.WithoutAuthentication()}
+	defer func() { computeClientOptions = nil }()
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := (&GceExecutor{}).start(ctx, "123", "stop", "", server.URL+"/", "p-x", "z-x", nil, map[string]string{"env": "test"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, []string{`labels.env = "test"`}, fake.filters, "they should be equal")
+	assert.Equal(t, "TERMINATED", fake.instances["vm-1"].Status, "they should be equal")
+	assert.Equal(t, "TERMINATED", fake.instances["vm-2"].Status, "they should be equal")
+	assert.Equal(t, "RUNNING", fake.instances["vm-3"].Status, "they should be equal")
+
+	result = (&GceExecutor{}).stop(ctx, "123", "stop", "", server.URL+"/")
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "RUNNING", fake.instances["vm-1"].Status, "they should be equal")
+	assert.Equal(t, "RUNNING", fake.instances["vm-2"].Status, "they should be equal")
+}
+
+func TestGcpGceStopWhileStopping(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	gcePollInterval = time.Millisecond
+	defer func() { gcePollInterval = 5 * time.Second }()
+	fake := newFakeCompute()
+	fake.transitional = true
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	computeClientOptions = []option.ClientOption{option.WithoutAuthentication()}
+	defer func() { computeClientOptions = nil }()
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := (&GceExecutor{}).start(ctx, "123", "stop", "", server.URL+"/", "p-x", "z-x", []string{"vm-1"}, nil)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "STOPPING", fake.instances["vm-1"].Status, "they should be equal")
+
+	// the destroy comes before the instance is stopped
+	result = (&GceExecutor{}).stop(ctx, "123", "stop", "", server.URL+"/")
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "RUNNING", fake.instances["vm-1"].Status, "they should be equal")
+}
+
+func TestGcpGceSuspend(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	fake := newFakeCompute()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	computeClientOptions = []option.ClientOption{option.WithoutAuthentication()}
+	defer func() { computeClientOptions = nil }()
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := (&GceExecutor{}).start(ctx, "123", "suspend", "", server.URL+"/", "p-x", "z-x", []string{"vm-3"}, nil)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "SUSPENDED", fake.instances["vm-3"].Status, "they should be equal")
+
+	result = (&GceExecutor{}).stop(ctx, "123", "suspend", "", server.URL+"/")
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "RUNNING", fake.instances["vm-3"].Status, "they should be equal")
+
+	result = (&GceExecutor{}).start(ctx, "123", "reset", "", server.URL+"/", "p-x", "z-x", []string{"vm-4"}, nil)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+}
+
+func TestGcpGceLabels(t *testing.T) {
+	labels, err := parseLabels("env=test, app=web")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"env": "test", "app": "web"}, labels, "they should be equal")
+	assert.Equal(t, `labels.app = "web" AND labels.env = "test"`, labelsFilter(labels), "they should be equal")
+	assert.Equal(t, "app=web,env=test", formatLabels(labels), "they should be equal")
+
+	_, err = parseLabels("env")
+	assert.NotNil(t, err)
+}
+
+func TestGcpGceStopWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	result := (&GceExecutor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", "stop", "", "")
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
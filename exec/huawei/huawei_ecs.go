@@ -0,0 +1,363 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package huawei
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+	"github.com/huaweicloud/huaweicloud-sdk-go-v3/core/auth/basic"
+	"github.com/huaweicloud/huaweicloud-sdk-go-v3/core/region"
+	ecs "github.com/huaweicloud/huaweicloud-sdk-go-v3/services/ecs/v2"
+	"github.com/huaweicloud/huaweicloud-sdk-go-v3/services/ecs/v2/model"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const EcsBin = "chaos_huawei_ecs"
+
+// the max time to wait for the instances in transitional states, like powering-off, to be settled before recovering them
+const ecsSettledTimeout = 10 * time.Minute
+
+// the interval to poll the status of instances in transitional states
+var ecsPollInterval = 5 * time.Second
+
+type EcsActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewEcsActionSpec() spec.ExpActionCommandSpec {
+	return &EcsActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the accessKeyId of huawei cloud, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the accessKeySecret of huawei cloud, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of huawei cloud",
+				},
+				&spec.ExpFlag{
+					Name: "projectId",
+					Desc: "the projectId of the region, if not provided, it is queried from iam",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of instances, support start, stop, reboot",
+				},
+				&spec.ExpFlag{
+					Name: "instances",
+					Desc: "the instances list, split by comma",
+				},
+				&spec.ExpFlag{
+					Name: "endpoint",
+					Desc: "the endpoint of ecs api, default is https://ecs.{regionId}.myhuaweicloud.com",
+				},
+			},
+			ActionExecutor: &EcsExecutor{},
+			ActionExample: `
+# stop instances which instance id is i-x,i-y
+blade create huawei ecs --accessKeyId xxx --accessKeySecret yyy --regionId cn-north-4 --type stop --instances i-x,i-y
+
+# start instances which instance id is i-x,i-y
+blade create huawei ecs --accessKeyId xxx --accessKeySecret yyy --regionId cn-north-4 --type start --instances i-x,i-y
+
+# reboot instances which instance id is i-x,i-y
+blade create huawei ecs --accessKeyId xxx --accessKeySecret yyy --regionId cn-north-4 --type reboot --instances i-x,i-y`,
+			ActionPrograms:   []string{EcsBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Huawei + "_" + category.Ecs},
+		},
+	}
+}
+
+func (*EcsActionSpec) Name() string {
+	return "ecs"
+}
+
+func (*EcsActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*EcsActionSpec) ShortDesc() string {
+	return "do some huawei cloud ecs Operations, like stop, start, reboot"
+}
+
+func (b *EcsActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some huawei cloud ecs Operations, like stop, start, reboot"
+}
+
+type EcsExecutor struct {
+	channel spec.Channel
+}
+
+func (*EcsExecutor) Name() string {
+	return "ecs"
+}
+
+func (be *EcsExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	projectId := model.ActionFlags["projectId"]
+	operationType := model.ActionFlags["type"]
+	instances := model.ActionFlags["instances"]
+	endpoint := model.ActionFlags["endpoint"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if instances == "" {
+		log.Errorf(ctx, "instances is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "instances")
+	}
+	instancesArray := strings.Split(instances, ",")
+
+	client, _err := CreateClient(accessKeyId, accessKeySecret, regionId, projectId, endpoint)
+	if _err != nil {
+		log.Errorf(ctx, "create huawei cloud client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create huawei cloud client failed")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, client, operationType, instancesArray)
+	}
+	return be.start(ctx, client, operationType, instancesArray)
+}
+
+func (be *EcsExecutor) start(ctx context.Context, client *ecs.EcsClient, operationType string, instancesArray []string) *spec.Response {
+	switch operationType {
+	case "start":
+		return startInstances(ctx, client, instancesArray)
+	case "stop":
+		return stopInstances(ctx, client, instancesArray)
+	case "reboot":
+		return rebootInstances(ctx, client, instancesArray)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support start, stop, reboot)")
+	}
+}
+
+func (be *EcsExecutor) stop(ctx context.Context, client *ecs.EcsClient, operationType string, instancesArray []string) *spec.Response {
+	switch operationType {
+	case "start", "stop":
+		instanceStatusMap, _err := describeSettledInstancesStatus(ctx, client, instancesArray)
+		if _err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe instances status failed")
+		}
+		// only the instances still in the injected state are recovered
+		injectedStatus := map[string]string{"start": "ACTIVE", "stop": "SHUTOFF"}[operationType]
+		var recovering []string
+		for _, instance := range instancesArray {
+			if instanceStatusMap[instance] == injectedStatus {
+				recovering = append(recovering, instance)
+			}
+		}
+		if len(recovering) == 0 {
+			log.Infof(ctx, "no instance of %v is %s, nothing to recover", instancesArray, injectedStatus)
+			return spec.Success()
+		}
+		if operationType == "start" {
+			return stopInstances(ctx, client, recovering)
+		}
+		return startInstances(ctx, client, recovering)
+	case "reboot":
+		// the rebooted instances recover by themselves
+		log.Infof(ctx, "nothing to recover for rebooted instances %v", instancesArray)
+		return spec.Success()
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support start, stop, reboot)")
+	}
+}
+
+func (be *EcsExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// CreateClient creates the ecs client, the projectId is queried from iam if it is empty
+func CreateClient(accessKeyId, accessKeySecret, regionId, projectId, endpoint string) (_result *ecs.EcsClient, _err error) {
+	credentials, _err := basic.NewCredentialsBuilder().
+		WithAk(accessKeyId).
+		WithSk(accessKeySecret).
+		WithProjectId(projectId).
+		SafeBuild()
+	if _err != nil {
+		return _result, _err
+	}
+	if endpoint == "" {
+		endpoint = "https://ecs." + regionId + ".myhuaweicloud.com"
+	}
+	// the sdk panics if the project id can not be queried, SafeBuild recovers it as error
+	hcClient, _err := ecs.EcsClientBuilder().
+		WithRegion(region.NewRegion(regionId, endpoint)).
+		WithCredential(credentials).
+		SafeBuild()
+	if _err != nil {
+		return _result, _err
+	}
+	_result = ecs.NewEcsClient(hcClient)
+	return _result, _err
+}
+
+// the server ids of instances
+func serverIds(instances []string) []model.ServerId {
+	servers := make([]model.ServerId, 0, len(instances))
+	for _, instance := range instances {
+		servers = append(servers, model.ServerId{Id: instance})
+	}
+	return servers
+}
+
+// start instances
+func startInstances(ctx context.Context, client *ecs.EcsClient, instances []string) *spec.Response {
+	_, _err := client.BatchStartServers(&model.BatchStartServersRequest{
+		Body: &model.BatchStartServersRequestBody{
+			OsStart: &model.BatchStartServersOption{Servers: serverIds(instances)},
+		},
+	})
+	if _err != nil {
+		log.Errorf(ctx, "start huawei cloud instances failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "start huawei cloud instances failed")
+	}
+	return spec.Success()
+}
+
+// stop instances
+func stopInstances(ctx context.Context, client *ecs.EcsClient, instances []string) *spec.Response {
+	stopType := model.GetBatchStopServersOptionTypeEnum().SOFT
+	_, _err := client.BatchStopServers(&model.BatchStopServersRequest{
+		Body: &model.BatchStopServersRequestBody{
+			OsStop: &model.BatchStopServersOption{Servers: serverIds(instances), Type: &stopType},
+		},
+	})
+	if _err != nil {
+		log.Errorf(ctx, "stop huawei cloud instances failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "stop huawei cloud instances failed")
+	}
+	return spec.Success()
+}
+
+// reboot instances
+func rebootInstances(ctx context.Context, client *ecs.EcsClient, instances []string) *spec.Response {
+	_, _err := client.BatchRebootServers(&model.BatchRebootServersRequest{
+		Body: &model.BatchRebootServersRequestBody{
+			Reboot: &model.BatchRebootSeversOption{Servers: serverIds(instances), Type: model.GetBatchRebootSeversOptionTypeEnum().SOFT},
+		},
+	})
+	if _err != nil {
+		log.Errorf(ctx, "reboot huawei cloud instances failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "reboot huawei cloud instances failed")
+	}
+	return spec.Success()
+}
+
+// describe instances status, like ACTIVE, SHUTOFF, REBOOT
+func describeInstancesStatus(ctx context.Context, client *ecs.EcsClient, instances []string) (_result map[string]string, _err error) {
+	statusMap, _, _err := describeInstancesStatusAndTask(ctx, client, instances)
+	if _err != nil {
+		return _result, _err
+	}
+	_result = statusMap
+	return _result, nil
+}
+
+// describe instances status and task state, the task state like powering-off is not empty while an operation is in progress
+func describeInstancesStatusAndTask(ctx context.Context, client *ecs.EcsClient, instances []string) (_status, _task map[string]string, _err error) {
+	statusMap, taskMap := map[string]string{}, map[string]string{}
+	for _, instance := range instances {
+		response, _err := client.ShowServer(&model.ShowServerRequest{ServerId: instance})
+		if _err != nil {
+			log.Errorf(ctx, "describe huawei cloud instance %s status failed, err: %s", instance, _err.Error())
+			return _status, _task, _err
+		}
+		if response.Server != nil {
+			statusMap[instance] = response.Server.Status
+			taskMap[instance] = response.Server.OSEXTSTStaskState
+		}
+	}
+	return statusMap, taskMap, nil
+}
+
+// describe instances status after the running tasks of instances are done, like an ACTIVE instance powering off to
+// SHUTOFF, so that the instances operated just now are not missed
+func describeSettledInstancesStatus(ctx context.Context, client *ecs.EcsClient, instances []string) (_result map[string]string, _err error) {
+	start := time.Now()
+	for {
+		statusMap, taskMap, _err := describeInstancesStatusAndTask(ctx, client, instances)
+		if _err != nil {
+			return _result, _err
+		}
+		var settling []string
+		for _, instance := range instances {
+			if taskMap[instance] != "" {
+				settling = append(settling, instance)
+			}
+		}
+		if len(settling) == 0 {
+			_result = statusMap
+			return _result, nil
+		}
+		if time.Since(start) > ecsSettledTimeout {
+			_err = fmt.Errorf("huawei cloud instances %v are not settled after %s", settling, ecsSettledTimeout)
+			log.Errorf(ctx, "wait huawei cloud instances settled failed, err: %s", _err.Error())
+			return _result, _err
+		}
+		log.Infof(ctx, "wait huawei cloud instances %v settled", settling)
+		time.Sleep(ecsPollInterval)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package huawei
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeServers struct {
+	Servers []struct {
+		Id string `json:"id"`
+	} `json:"servers"`
+}
+
+// fakeEcs is a local ecs api stand-in which keeps the server status of project p-x, the servers keep the status with
+// a task state, like powering-off, for one query after an action before they are settled
+type fakeEcs struct {
+	sync.Mutex
+	status  map[string]string
+	tasks   map[string]string
+	actions []string
+}
+
+func (f *fakeEcs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	const prefix = "/v1/p-x/cloudservers/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, prefix)
+	if id != "action" {
+		status, ok := f.status[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":"Ecs.0114","message":"not found"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"server": map[string]string{"id": id, "status": status, "OS-EXT-STS:task_state": f.tasks[id]}})
+		if task, ok := f.tasks[id]; ok {
+			f.status[id] = map[string]string{"powering-off": "SHUTOFF", "powering-on": "ACTIVE", "rebooting": "ACTIVE"}[task]
+			delete(f.tasks, id)
+		}
+		return
+	}
+	var body map[string]fakeServers
+	json.NewDecoder(r.Body).Decode(&body)
+	for action, option := range body {
+		f.actions = append(f.actions, action)
+		for _, server := range option.Servers {
+			if _, ok := f.status[server.Id]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":{"code":"Ecs.0114","message":"not found"}}`))
+				return
+			}
+			f.tasks[server.Id] = map[string]string{"os-stop": "powering-off", "os-start": "powering-on", "reboot": "rebooting"}[action]
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]string{"job_id": "j-1"})
+}
+
+func TestHuaweiEcsStop(t *testing.T) {
+	ecsPollInterval = time.Millisecond
+	defer func() { ecsPollInterval = 5 * time.Second }()
+	fake := &fakeEcs{status: map[string]string{"i-1": "ACTIVE", "i-2": "ACTIVE"}, tasks: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ctx := context.WithValue(context.Background(), "uid", "123")
+	client, err := CreateClient("accessKeyId", "accessKeySecret", "cn-north-4", "p-x", server.URL)
+	assert.Nil(t, err)
+
+	result := (&EcsExecutor{}).start(ctx, client, "stop", []string{"i-1"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "ACTIVE", fake.status["i-1"], "they should be equal")
+	assert.Equal(t, "powering-off", fake.tasks["i-1"], "they should be equal")
+
+	// the instances powering off are waited to be stopped, and only the stopped instances are started
+	result = (&EcsExecutor{}).stop(ctx, client, "stop", []string{"i-1", "i-2"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "powering-on", fake.tasks["i-1"], "they should be equal")
+	assert.Equal(t, "", fake.tasks["i-2"], "they should be equal")
+	assert.Equal(t, []string{"os-stop", "os-start"}, fake.actions, "they should be equal")
+}
+
+func TestHuaweiEcsReboot(t *testing.T) {
+	fake := &fakeEcs{status: map[string]string{"i-1": "ACTIVE"}, tasks: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ctx := context.WithValue(context.Background(), "uid", "123")
+	client, err := CreateClient("accessKeyId", "accessKeySecret", "cn-north-4", "p-x", server.URL)
+	assert.Nil(t, err)
+
+	result := (&EcsExecutor{}).start(ctx, client, "reboot", []string{"i-1"})
+	assert.True(t, result.Success, result.Err)
+	result = (&EcsExecutor{}).stop(ctx, client, "reboot", []string{"i-1"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, []string{"reboot"}, fake.actions, "they should be equal")
+
+	result = (&EcsExecutor{}).start(ctx, client, "start", []string{"i-2"})
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+
+	_, err = describeInstancesStatus(ctx, client, []string{"i-2"})
+	assert.NotNil(t, err)
+
+	result = (&EcsExecutor{}).start(ctx, client, "delete", []string{"i-1"})
+	assert.Equal(t, int32(47000), result.Code, "they should be equal")
+}
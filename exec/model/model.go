@@ -46,6 +46,9 @@ func ExtractExecutorFromExpModel(expModel spec.ExpModelCommandSpec) map[string]s
 	executors := make(map[string]spec.Executor)
 	for _, actionModel := range expModel.Actions() {
 		executors[expModel.Name()+actionModel.Name()] = actionModel.Executor()
+		for _, alias := range actionModel.Aliases() {
+			executors[expModel.Name()+alias] = actionModel.Executor()
+		}
 	}
 	return executors
 }
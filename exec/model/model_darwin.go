@@ -24,6 +24,11 @@ import (
 
 	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/aliyun"
 	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/aws"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/azure"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/gcp"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/huawei"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/openstack"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/tencent"
 )
 
 // GetAllExpModels returns the experiment model specs in the project.
@@ -32,5 +37,10 @@ func GetAllExpModels() []spec.ExpModelCommandSpec {
 	return []spec.ExpModelCommandSpec{
 		aliyun.NewAliyunCommandSpec(),
 		aws.NewAwsCommandSpec(),
+		gcp.NewGcpCommandSpec(),
+		azure.NewAzureCommandSpec(),
+		tencent.NewTencentCommandSpec(),
+		huawei.NewHuaweiCommandSpec(),
+		openstack.NewOpenstackCommandSpec(),
 	}
 }
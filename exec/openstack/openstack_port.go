@@ -0,0 +1,374 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/attachinterfaces"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/extensions/portsecurity"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/ports"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const PortBin = "chaos_openstack_port"
+
+// the max time to wait for nova to detach the ports from server
+const portDetachedTimeout = 5 * time.Minute
+
+// the interval to poll the ports being detached
+var portPollInterval = 5 * time.Second
+
+type PortActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewPortActionSpec() spec.ExpActionCommandSpec {
+	return &PortActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "cloud",
+					Desc: "the cloud name in clouds.yaml, if not provided, get from env OS_CLOUD, the keystone env like OS_AUTH_URL is used if both are absent",
+				},
+				&spec.ExpFlag{
+					Name: "cloudsFile",
+					Desc: "the path of clouds.yaml, if not provided, get from env OS_CLIENT_CONFIG_FILE, or search ./clouds.yaml, ~/.config/openstack/clouds.yaml, /etc/openstack/clouds.yaml",
+				},
+				&spec.ExpFlag{
+					Name: "regionName",
+					Desc: "the region name of openstack, it overrides the region_name in clouds.yaml",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of ports, support detach",
+				},
+				&spec.ExpFlag{
+					Name: "server",
+					Desc: "the server id which the ports are attached to",
+				},
+				&spec.ExpFlag{
+					Name: "ports",
+					Desc: "the port ids list, split by comma, if not provided, all the ports of server are detached",
+				},
+			},
+			ActionExecutor: &PortExecutor{},
+			ActionExample: `
+# detach port p-x from server s-x
+blade create openstack port --cloud c-x --type detach --server s-x --ports p-x
+
+# detach all the ports from server s-x
+blade create openstack port --cloud c-x --type detach --server s-x`,
+			ActionPrograms:   []string{PortBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Openstack + "_" + category.Port},
+		},
+	}
+}
+
+func (*PortActionSpec) Name() string {
+	return "port"
+}
+
+func (*PortActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*PortActionSpec) ShortDesc() string {
+	return "do some openstack neutron port Operations, like detach"
+}
+
+func (b *PortActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some openstack neutron port Operations, like detach the ports from server. " +
+		"The detached ports are attached again on destroy, the port deleted by nova on detach is recreated in its network with the same fixed ips"
+}
+
+type PortExecutor struct {
+	channel spec.Channel
+}
+
+func (*PortExecutor) Name() string {
+	return "port"
+}
+
+// openstackPortRecord is the server and its ports detached by the experiment
+type openstackPortRecord struct {
+	Server string                  `json:"server"`
+	Ports  []openstackDetachedPort `json:"ports"`
+}
+
+// openstackDetachedPort is the port and the attributes to recreate it if nova deletes it on detach
+type openstackDetachedPort struct {
+	Id                  string   `json:"id"`
+	NetworkId           string   `json:"networkId"`
+	FixedIps            []string `json:"fixedIps"`
+	MacAddress          string   `json:"macAddress,omitempty"`
+	SecurityGroups      []string `json:"securityGroups,omitempty"`
+	PortSecurityEnabled *bool    `json:"portSecurityEnabled,omitempty"`
+}
+
+// openstackPort is the port with the attribute of portsecurity extension
+type openstackPort struct {
+	ports.Port
+	PortSecurityExt
+}
+
+// PortSecurityExt is the attribute of portsecurity extension, it is nil if the extension is disabled.
+// It is exported to be embedded in the extracted ports
+type PortSecurityExt struct {
+	PortSecurityEnabled *bool `json:"port_security_enabled"`
+}
+
+func (be *PortExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	operationType := model.ActionFlags["type"]
+	server := model.ActionFlags["server"]
+	portsFlag := model.ActionFlags["ports"]
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if operationType != "detach" {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support detach)")
+	}
+
+	provider, endpointOpts, response := createProviderClientByFlags(ctx, model)
+	if response != nil {
+		return response
+	}
+	computeClient, _err := openstack.NewComputeV2(provider, endpointOpts)
+	if _err != nil {
+		log.Errorf(ctx, "create openstack compute client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create openstack compute client failed")
+	}
+	networkClient, _err := openstack.NewNetworkV2(provider, endpointOpts)
+	if _err != nil {
+		log.Errorf(ctx, "create openstack network client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create openstack network client failed")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, computeClient, networkClient)
+	}
+
+	if server == "" {
+		log.Errorf(ctx, "server is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "server")
+	}
+	return detachOpenstackPorts(ctx, uid, computeClient, networkClient, server, exec.SplitFlag(portsFlag))
+}
+
+func (be *PortExecutor) stop(ctx context.Context, uid string, computeClient, networkClient *gophercloud.ServiceClient) *spec.Response {
+	var record openstackPortRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	response := attachOpenstackPorts(ctx, uid, computeClient, networkClient, record)
+	if !response.Success {
+		return response
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return response
+}
+
+func (be *PortExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// detach the ports from server, all the ports of server are detached if portIds is empty
+func detachOpenstackPorts(ctx context.Context, uid string, computeClient, networkClient *gophercloud.ServiceClient, server string, portIds []string) *spec.Response {
+	serverPorts, _err := listOpenstackServerPorts(ctx, networkClient, server)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "list openstack ports failed")
+	}
+	portMap := map[string]openstackPort{}
+	for _, port := range serverPorts {
+		portMap[port.ID] = port
+	}
+	if len(portIds) == 0 {
+		for _, port := range serverPorts {
+			portIds = append(portIds, port.ID)
+		}
+	}
+	if len(portIds) == 0 {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "server", server, "no port is attached to the server")
+	}
+
+	record := openstackPortRecord{Server: server}
+	for _, portId := range portIds {
+		port, ok := portMap[portId]
+		if !ok {
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "ports", portId, "the port is not attached to the server")
+		}
+		detached := openstackDetachedPort{
+			Id:                  port.ID,
+			NetworkId:           port.NetworkID,
+			MacAddress:          port.MACAddress,
+			SecurityGroups:      port.SecurityGroups,
+			PortSecurityEnabled: port.PortSecurityEnabled,
+		}
+		for _, fixedIp := range port.FixedIPs {
+			detached.FixedIps = append(detached.FixedIps, fixedIp.IPAddress)
+		}
+		record.Ports = append(record.Ports, detached)
+	}
+	if _err = exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+
+	for _, port := range record.Ports {
+		if _err = attachinterfaces.Delete(ctx, computeClient, server, port.Id).ExtractErr(); _err != nil {
+			log.Errorf(ctx, "detach openstack port %s from server %s failed, err: %s", port.Id, server, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "detach openstack port failed")
+		}
+	}
+	// nova detaches the ports asynchronously, a port still attached to the server on destroy would be taken as
+	// reattached and skipped, so the experiment is created only after the ports are detached
+	if _err = waitOpenstackPortsDetached(ctx, networkClient, server, record.Ports); _err != nil {
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "wait openstack ports detached failed")
+	}
+	return spec.Success()
+}
+
+// wait until the ports are detached from server or deleted on detach
+func waitOpenstackPortsDetached(ctx context.Context, networkClient *gophercloud.ServiceClient, server string, detachedPorts []openstackDetachedPort) error {
+	start := time.Now()
+	for _, detached := range detachedPorts {
+		for {
+			port, _err := ports.Get(ctx, networkClient, detached.Id).Extract()
+			if gophercloud.ResponseCodeIs(_err, http.StatusNotFound) {
+				break
+			}
+			if _err != nil {
+				log.Errorf(ctx, "describe openstack port %s failed, err: %s", detached.Id, _err.Error())
+				return _err
+			}
+			if port.DeviceID != server {
+				break
+			}
+			if time.Since(start) > portDetachedTimeout {
+				_err = fmt.Errorf("openstack port %s is not detached from server %s after %s", detached.Id, server, portDetachedTimeout)
+				log.Errorf(ctx, "wait openstack ports detached failed, err: %s", _err.Error())
+				return _err
+			}
+			log.Infof(ctx, "wait openstack port %s detached from server %s", detached.Id, server)
+			time.Sleep(portPollInterval)
+		}
+	}
+	return nil
+}
+
+// attach the detached ports to server, the port deleted on detach is recreated in its network with the same fixed ips,
+// mac address, security groups and port security.
+// The ports are detached before the experiment is created, so a port attached to the server is reattached by a
+// previous destroy
+func attachOpenstackPorts(ctx context.Context, uid string, computeClient, networkClient *gophercloud.ServiceClient, record openstackPortRecord) *spec.Response {
+	server := record.Server
+	for i, detached := range record.Ports {
+		createOpts := attachinterfaces.CreateOpts{PortID: detached.Id}
+		port, _err := ports.Get(ctx, networkClient, detached.Id).Extract()
+		if _err != nil {
+			if !gophercloud.ResponseCodeIs(_err, http.StatusNotFound) {
+				log.Errorf(ctx, "describe openstack port %s failed, err: %s", detached.Id, _err.Error())
+				return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe openstack port failed")
+			}
+			log.Warnf(ctx, "openstack port %s is deleted on detach, recreate it in network %s", detached.Id, detached.NetworkId)
+			recreated, _err := recreateOpenstackPort(ctx, networkClient, detached)
+			if _err != nil {
+				return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "recreate openstack port failed")
+			}
+			// the recreated port is recorded before attaching, so a retried destroy attaches it instead of recreating another
+			record.Ports[i].Id = recreated.ID
+			if _err = exec.SaveRecord(uid, record); _err != nil {
+				log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+				return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+			}
+			createOpts = attachinterfaces.CreateOpts{PortID: recreated.ID}
+		} else if port.DeviceID == server {
+			log.Infof(ctx, "openstack port %s is attached to server %s already", detached.Id, server)
+			continue
+		}
+		if _, _err = attachinterfaces.Create(ctx, computeClient, server, createOpts).Extract(); _err != nil {
+			log.Errorf(ctx, "attach openstack port %s to server %s failed, err: %s", detached.Id, server, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "attach openstack port failed")
+		}
+	}
+	return spec.Success()
+}
+
+// recreate the port deleted on detach in its network with the recorded fixed ips, mac address, security groups and
+// port security
+func recreateOpenstackPort(ctx context.Context, networkClient *gophercloud.ServiceClient, detached openstackDetachedPort) (_result *ports.Port, _err error) {
+	createOpts := ports.CreateOpts{NetworkID: detached.NetworkId, MACAddress: detached.MacAddress}
+	var fixedIps []ports.IP
+	for _, fixedIp := range detached.FixedIps {
+		fixedIps = append(fixedIps, ports.IP{IPAddress: fixedIp})
+	}
+	if len(fixedIps) > 0 {
+		createOpts.FixedIPs = fixedIps
+	}
+	// the default security group is applied if the record has no security groups, unless the port security is disabled
+	if len(detached.SecurityGroups) > 0 {
+		createOpts.SecurityGroups = &detached.SecurityGroups
+	} else if detached.PortSecurityEnabled != nil && !*detached.PortSecurityEnabled {
+		createOpts.SecurityGroups = &[]string{}
+	}
+	_result, _err = ports.Create(ctx, networkClient, portsecurity.PortCreateOptsExt{
+		CreateOptsBuilder:   createOpts,
+		PortSecurityEnabled: detached.PortSecurityEnabled,
+	}).Extract()
+	if _err != nil {
+		log.Errorf(ctx, "recreate openstack port %s in network %s failed, err: %s", detached.Id, detached.NetworkId, _err.Error())
+	}
+	return _result, _err
+}
+
+// list the ports attached to server
+func listOpenstackServerPorts(ctx context.Context, networkClient *gophercloud.ServiceClient, server string) (_result []openstackPort, _err error) {
+	pages, _err := ports.List(networkClient, ports.ListOpts{DeviceID: server}).AllPages(ctx)
+	if _err != nil {
+		log.Errorf(ctx, "list openstack ports of server %s failed, err: %s", server, _err.Error())
+		return _result, _err
+	}
+	_err = ports.ExtractPortsInto(pages, &_result)
+	return _result, _err
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+func TestOpenstackPortDetach(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	portPollInterval = time.Millisecond
+	defer func() { portPollInterval = 5 * time.Second }()
+	fake, cloudsFile := newFakeOpenstack(t)
+	computeClient, networkClient := newFakeClients(t, cloudsFile)
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	// the port is detached asynchronously and waited to be detached
+	result := detachOpenstackPorts(ctx, "123", computeClient, networkClient, "server-1", []string{"port-2"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "", fake.ports["port-2"].DeviceId, "they should be equal")
+	assert.Equal(t, "server-1", fake.ports["port-1"].DeviceId, "they should be equal")
+
+	result = (&PortExecutor{}).stop(ctx, "123", computeClient, networkClient)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "server-1", fake.ports["port-2"].DeviceId, "they should be equal")
+	assert.Equal(t, []string{"detach port-2", "attach port-2"}, fake.actions, "they should be equal")
+
+	result = (&PortExecutor{}).stop(ctx, "123", computeClient, networkClient)
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
+
+func TestOpenstackPortDetachDeleted(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	portPollInterval = time.Millisecond
+	defer func() { portPollInterval = 5 * time.Second }()
+	fake, cloudsFile := newFakeOpenstack(t)
+	fake.deleteOnDetach = true
+	computeClient, networkClient := newFakeClients(t, cloudsFile)
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	// all the ports of server are detached if ports is not provided
+	result := detachOpenstackPorts(ctx, "123", computeClient, networkClient, "server-1", nil)
+	assert.True(t, result.Success, result.Err)
+	assert.Len(t, fake.ports, 0)
+
+	// the deleted ports are recreated with the same fixed ips, mac addresses and security groups
+	result = (&PortExecutor{}).stop(ctx, "123", computeClient, networkClient)
+	assert.True(t, result.Success, result.Err)
+	assert.Contains(t, fake.actions, "create net-1 10.0.0.11")
+	assert.Contains(t, fake.actions, "create net-2 10.0.1.11")
+	assert.Len(t, fake.ports, 2)
+	for _, port := range fake.ports {
+		assert.Equal(t, "server-1", port.DeviceId, "they should be equal")
+		if port.NetworkId == "net-2" {
+			assert.Equal(t, "fa:16:3e:00:00:02", port.MacAddress, "they should be equal")
+			assert.Equal(t, []string{"sg-web", "sg-ssh"}, port.SecurityGroups, "they should be equal")
+		}
+	}
+
+	result = detachOpenstackPorts(ctx, "456", computeClient, networkClient, "server-1", []string{"port-3"})
+	assert.Equal(t, int32(47000), result.Code, "they should be equal")
+}
+
+func TestOpenstackPortDetachDeletedRetry(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	portPollInterval = time.Millisecond
+	defer func() { portPollInterval = 5 * time.Second }()
+	fake, cloudsFile := newFakeOpenstack(t)
+	fake.deleteOnDetach = true
+	disabled := false
+	fake.ports["port-1"].SecurityGroups = nil
+	fake.ports["port-1"].PortSecurity = &disabled
+	computeClient, networkClient := newFakeClients(t, cloudsFile)
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := detachOpenstackPorts(ctx, "123", computeClient, networkClient, "server-1", []string{"port-1"})
+	assert.True(t, result.Success, result.Err)
+	var record openstackPortRecord
+	_, err := exec.LoadRecord("123", &record)
+	assert.Nil(t, err)
+	assert.Equal(t, &disabled, record.Ports[0].PortSecurityEnabled, "they should be equal")
+
+	// the recreated port is recorded, so the retried destroy attaches it without recreating another
+	fake.failAttach = true
+	result = (&PortExecutor{}).stop(ctx, "123", computeClient, networkClient)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+	_, err = exec.LoadRecord("123", &record)
+	assert.Nil(t, err)
+	assert.Equal(t, "port-new-1", record.Ports[0].Id, "they should be equal")
+	result = (&PortExecutor{}).stop(ctx, "123", computeClient, networkClient)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, []string{"detach port-1", "create net-1 10.0.0.11", "attach port-new-1"}, fake.actions, "they should be equal")
+	assert.Len(t, fake.ports, 2)
+	for _, port := range fake.ports {
+		if port.NetworkId == "net-1" {
+			assert.Equal(t, "server-1", port.DeviceId, "they should be equal")
+			assert.Equal(t, &disabled, port.PortSecurity, "they should be equal")
+			assert.Empty(t, port.SecurityGroups)
+		}
+	}
+}
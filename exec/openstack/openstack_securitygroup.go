@@ -0,0 +1,244 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"context"
+
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/ports"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const SecurityGroupBin = "chaos_openstack_securitygroup"
+
+type SecurityGroupActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewSecurityGroupActionSpec() spec.ExpActionCommandSpec {
+	return &SecurityGroupActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "cloud",
+					Desc: "the cloud name in clouds.yaml, if not provided, get from env OS_CLOUD, the keystone env like OS_AUTH_URL is used if both are absent",
+				},
+				&spec.ExpFlag{
+					Name: "cloudsFile",
+					Desc: "the path of clouds.yaml, if not provided, get from env OS_CLIENT_CONFIG_FILE, or search ./clouds.yaml, ~/.config/openstack/clouds.yaml, /etc/openstack/clouds.yaml",
+				},
+				&spec.ExpFlag{
+					Name: "regionName",
+					Desc: "the region name of openstack, it overrides the region_name in clouds.yaml",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of security groups, support swap",
+				},
+				&spec.ExpFlag{
+					Name: "server",
+					Desc: "the server id, the security groups of all its ports are swapped, used if ports is not provided",
+				},
+				&spec.ExpFlag{
+					Name: "ports",
+					Desc: "the port ids list, split by comma",
+				},
+				&spec.ExpFlag{
+					Name: "securityGroups",
+					Desc: "the security group ids list to replace the security groups of ports, split by comma, like a group without any rule to deny all traffic",
+				},
+			},
+			ActionExecutor: &SecurityGroupExecutor{},
+			ActionExample: `
+# replace the security groups of port p-x with the security group sg-deny
+blade create openstack securityGroup --cloud c-x --type swap --ports p-x --securityGroups sg-deny
+
+# replace the security groups of all the ports of server s-x with the security groups sg-x,sg-y
+blade create openstack securityGroup --cloud c-x --type swap --server s-x --securityGroups sg-x,sg-y`,
+			ActionPrograms:   []string{SecurityGroupBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Openstack + "_" + category.SecurityGroup},
+		},
+	}
+}
+
+func (*SecurityGroupActionSpec) Name() string {
+	return "securityGroup"
+}
+
+func (*SecurityGroupActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*SecurityGroupActionSpec) ShortDesc() string {
+	return "do some openstack neutron security group Operations, like swap"
+}
+
+func (b *SecurityGroupActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some openstack neutron security group Operations, like swap the security groups of ports. " +
+		"The original security groups of ports are restored on destroy"
+}
+
+type SecurityGroupExecutor struct {
+	channel spec.Channel
+}
+
+func (*SecurityGroupExecutor) Name() string {
+	return "securityGroup"
+}
+
+// openstackSecurityGroupRecord is the original security groups of the swapped ports
+type openstackSecurityGroupRecord struct {
+	Ports []openstackPortSecurityGroups `json:"ports"`
+}
+
+type openstackPortSecurityGroups struct {
+	Id             string   `json:"id"`
+	SecurityGroups []string `json:"securityGroups"`
+}
+
+func (be *SecurityGroupExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	operationType := model.ActionFlags["type"]
+	server := model.ActionFlags["server"]
+	portsFlag := model.ActionFlags["ports"]
+	securityGroups := model.ActionFlags["securityGroups"]
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if operationType != "swap" {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support swap)")
+	}
+
+	provider, endpointOpts, response := createProviderClientByFlags(ctx, model)
+	if response != nil {
+		return response
+	}
+	client, _err := openstack.NewNetworkV2(provider, endpointOpts)
+	if _err != nil {
+		log.Errorf(ctx, "create openstack network client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create openstack network client failed")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, uid, client)
+	}
+
+	if server == "" && portsFlag == "" {
+		log.Errorf(ctx, "server or ports is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "server|ports")
+	}
+
+	if securityGroups == "" {
+		log.Errorf(ctx, "securityGroups is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "securityGroups")
+	}
+	return swapOpenstackSecurityGroups(ctx, uid, client, server, exec.SplitFlag(portsFlag), exec.SplitFlag(securityGroups))
+}
+
+func (be *SecurityGroupExecutor) stop(ctx context.Context, uid string, client *gophercloud.ServiceClient) *spec.Response {
+	var record openstackSecurityGroupRecord
+	exist, _err := exec.LoadRecord(uid, &record)
+	if _err != nil {
+		log.Errorf(ctx, "load the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	if !exist {
+		log.Errorf(ctx, "the record of experiment %s is not found", uid)
+		return spec.ResponseFailWithFlags(spec.ParameterInvalidDbQuery, "uid")
+	}
+	for _, port := range record.Ports {
+		if response := updateOpenstackPortSecurityGroups(ctx, client, port.Id, port.SecurityGroups); !response.Success {
+			return response
+		}
+	}
+	if _err = exec.RemoveRecord(uid); _err != nil {
+		log.Warnf(ctx, "remove the record of experiment %s failed, err: %s", uid, _err.Error())
+	}
+	return spec.Success()
+}
+
+func (be *SecurityGroupExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// replace the security groups of ports, the ports of server are used if portIds is empty
+func swapOpenstackSecurityGroups(ctx context.Context, uid string, client *gophercloud.ServiceClient, server string, portIds, securityGroups []string) *spec.Response {
+	var swapping []ports.Port
+	if len(portIds) == 0 {
+		serverPorts, _err := listOpenstackServerPorts(ctx, client, server)
+		if _err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "list openstack ports failed")
+		}
+		if len(serverPorts) == 0 {
+			return spec.ResponseFailWithFlags(spec.ParameterInvalid, "server", server, "no port is attached to the server")
+		}
+		for _, port := range serverPorts {
+			swapping = append(swapping, port.Port)
+		}
+	}
+	for _, portId := range portIds {
+		port, _err := ports.Get(ctx, client, portId).Extract()
+		if _err != nil {
+			log.Errorf(ctx, "describe openstack port %s failed, err: %s", portId, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe openstack port failed")
+		}
+		swapping = append(swapping, *port)
+	}
+
+	var record openstackSecurityGroupRecord
+	for _, port := range swapping {
+		record.Ports = append(record.Ports, openstackPortSecurityGroups{Id: port.ID, SecurityGroups: port.SecurityGroups})
+	}
+	if _err := exec.SaveRecord(uid, record); _err != nil {
+		log.Errorf(ctx, "save the record of experiment %s failed, err: %s", uid, _err.Error())
+		return spec.ResponseFailWithFlags(spec.FileCantReadOrOpen, uid)
+	}
+	for _, port := range swapping {
+		if response := updateOpenstackPortSecurityGroups(ctx, client, port.ID, securityGroups); !response.Success {
+			return response
+		}
+	}
+	return spec.Success()
+}
+
+// update the security groups of port
+func updateOpenstackPortSecurityGroups(ctx context.Context, client *gophercloud.ServiceClient, portId string, securityGroups []string) *spec.Response {
+	if securityGroups == nil {
+		securityGroups = []string{}
+	}
+	_, _err := ports.Update(ctx, client, portId, ports.UpdateOpts{SecurityGroups: &securityGroups}).Extract()
+	if _err != nil {
+		log.Errorf(ctx, "update the security groups of openstack port %s failed, err: %s", portId, _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "update openstack port security groups failed")
+	}
+	return spec.Success()
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec"
+)
+
+func TestOpenstackSecurityGroupSwap(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	fake, cloudsFile := newFakeOpenstack(t)
+	_, networkClient := newFakeClients(t, cloudsFile)
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := swapOpenstackSecurityGroups(ctx, "123", networkClient, "server-1", nil, []string{"sg-deny"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, []string{"sg-deny"}, fake.ports["port-1"].SecurityGroups, "they should be equal")
+	assert.Equal(t, []string{"sg-deny"}, fake.ports["port-2"].SecurityGroups, "they should be equal")
+
+	result = (&SecurityGroupExecutor{}).stop(ctx, "123", networkClient)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, []string{"sg-web"}, fake.ports["port-1"].SecurityGroups, "they should be equal")
+	assert.Equal(t, []string{"sg-web", "sg-ssh"}, fake.ports["port-2"].SecurityGroups, "they should be equal")
+}
+
+func TestOpenstackSecurityGroupSwapPorts(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	fake, cloudsFile := newFakeOpenstack(t)
+	_, networkClient := newFakeClients(t, cloudsFile)
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := swapOpenstackSecurityGroups(ctx, "123", networkClient, "", []string{"port-2"}, []string{"sg-x", "sg-y"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, []string{"sg-web"}, fake.ports["port-1"].SecurityGroups, "they should be equal")
+	assert.Equal(t, []string{"sg-x", "sg-y"}, fake.ports["port-2"].SecurityGroups, "they should be equal")
+
+	result = swapOpenstackSecurityGroups(ctx, "456", networkClient, "", []string{"port-3"}, []string{"sg-x"})
+	assert.Equal(t, int32(48000), result.Code, "they should be equal")
+}
+
+func TestOpenstackSecurityGroupStopWithoutRecord(t *testing.T) {
+	exec.RecordDir = t.TempDir()
+	defer func() { exec.RecordDir = "" }()
+	_, cloudsFile := newFakeOpenstack(t)
+	_, networkClient := newFakeClients(t, cloudsFile)
+
+	result := (&SecurityGroupExecutor{}).stop(context.WithValue(context.Background(), "uid", "123"), "123", networkClient)
+	assert.Equal(t, int32(47004), result.Code, "they should be equal")
+}
@@ -0,0 +1,332 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/v2/openstack/config/clouds"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const ServerBin = "chaos_openstack_server"
+
+// the max time to wait for the servers with a task in progress, like powering-off, to be settled before recovering them
+const serverSettledTimeout = 10 * time.Minute
+
+// the interval to poll the status of servers with a task in progress
+var serverPollInterval = 5 * time.Second
+
+type ServerActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewServerActionSpec() spec.ExpActionCommandSpec {
+	return &ServerActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "cloud",
+					Desc: "the cloud name in clouds.yaml, if not provided, get from env OS_CLOUD, the keystone env like OS_AUTH_URL is used if both are absent",
+				},
+				&spec.ExpFlag{
+					Name: "cloudsFile",
+					Desc: "the path of clouds.yaml, if not provided, get from env OS_CLIENT_CONFIG_FILE, or search ./clouds.yaml, ~/.config/openstack/clouds.yaml, /etc/openstack/clouds.yaml",
+				},
+				&spec.ExpFlag{
+					Name: "regionName",
+					Desc: "the region name of openstack, it overrides the region_name in clouds.yaml",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of servers, support stop, start, reboot, pause",
+				},
+				&spec.ExpFlag{
+					Name: "servers",
+					Desc: "the server ids list, split by comma",
+				},
+				&spec.ExpFlag{
+					Name:    "rebootType",
+					Desc:    "the reboot type of servers when operationType is reboot, support SOFT, HARD, default is SOFT",
+					Default: "SOFT",
+				},
+			},
+			ActionExecutor: &ServerExecutor{},
+			ActionExample: `
+# stop servers which server id is s-x,s-y by the cloud c-x in clouds.yaml
+blade create openstack server --cloud c-x --type stop --servers s-x,s-y
+
+# start servers which server id is s-x,s-y by the clouds.yaml in the given path
+blade create openstack server --cloud c-x --cloudsFile /etc/chaosblade/clouds.yaml --type start --servers s-x,s-y
+
+# hard reboot servers which server id is s-x,s-y by the keystone env like OS_AUTH_URL
+blade create openstack server --type reboot --rebootType HARD --servers s-x,s-y
+
+# pause servers which server id is s-x,s-y
+blade create openstack server --cloud c-x --type pause --servers s-x,s-y`,
+			ActionPrograms:   []string{ServerBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Openstack + "_" + category.Server},
+		},
+	}
+}
+
+func (*ServerActionSpec) Name() string {
+	return "server"
+}
+
+func (*ServerActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*ServerActionSpec) ShortDesc() string {
+	return "do some openstack nova server Operations, like stop, start, reboot, pause"
+}
+
+func (b *ServerActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some openstack nova server Operations, like stop, start, reboot, pause. " +
+		"The stopped servers are started, the started servers are stopped and the paused servers are unpaused on destroy"
+}
+
+type ServerExecutor struct {
+	channel spec.Channel
+}
+
+func (*ServerExecutor) Name() string {
+	return "server"
+}
+
+// the status of servers after the operation, the servers still in it are recovered on destroy
+var serverInjectedStatus = map[string]string{
+	"stop":  "SHUTOFF",
+	"start": "ACTIVE",
+	"pause": "PAUSED",
+}
+
+func (be *ServerExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	operationType := model.ActionFlags["type"]
+	serversFlag := model.ActionFlags["servers"]
+	rebootType := model.ActionFlags["rebootType"]
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if serversFlag == "" {
+		log.Errorf(ctx, "servers is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "servers")
+	}
+	serversArray := strings.Split(serversFlag, ",")
+
+	if rebootType == "" {
+		rebootType = string(servers.SoftReboot)
+	}
+	if rebootType != string(servers.SoftReboot) && rebootType != string(servers.HardReboot) {
+		return spec.ResponseFailWithFlags(spec.ParameterIllegal, "rebootType", rebootType, "it must be SOFT or HARD")
+	}
+
+	provider, endpointOpts, response := createProviderClientByFlags(ctx, model)
+	if response != nil {
+		return response
+	}
+	client, _err := openstack.NewComputeV2(provider, endpointOpts)
+	if _err != nil {
+		log.Errorf(ctx, "create openstack compute client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create openstack compute client failed")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, client, operationType, serversArray)
+	}
+	return be.start(ctx, client, operationType, serversArray, servers.RebootMethod(rebootType))
+}
+
+func (be *ServerExecutor) start(ctx context.Context, client *gophercloud.ServiceClient, operationType string, serversArray []string, rebootType servers.RebootMethod) *spec.Response {
+	switch operationType {
+	case "stop", "start", "pause":
+		return operateOpenstackServers(ctx, client, operationType, serversArray)
+	case "reboot":
+		for _, server := range serversArray {
+			if _err := servers.Reboot(ctx, client, server, servers.RebootOpts{Type: rebootType}).ExtractErr(); _err != nil {
+				log.Errorf(ctx, "reboot openstack server %s failed, err: %s", server, _err.Error())
+				return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "reboot openstack servers failed")
+			}
+		}
+		return spec.Success()
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support stop, start, reboot, pause)")
+	}
+}
+
+func (be *ServerExecutor) stop(ctx context.Context, client *gophercloud.ServiceClient, operationType string, serversArray []string) *spec.Response {
+	if operationType == "reboot" {
+		// the rebooted servers recover by themselves
+		log.Infof(ctx, "nothing to recover for rebooted servers %v", serversArray)
+		return spec.Success()
+	}
+	injectedStatus, ok := serverInjectedStatus[operationType]
+	if !ok {
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support stop, start, reboot, pause)")
+	}
+	serverStatusMap, _err := describeSettledOpenstackServersStatus(ctx, client, serversArray)
+	if _err != nil {
+		return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe openstack servers status failed")
+	}
+	// only the servers still in the injected status are recovered
+	var recovering []string
+	for _, server := range serversArray {
+		if serverStatusMap[server] == injectedStatus {
+			recovering = append(recovering, server)
+		}
+	}
+	if len(recovering) == 0 {
+		log.Infof(ctx, "no server of %v is %s, nothing to recover", serversArray, injectedStatus)
+		return spec.Success()
+	}
+	recoveringOperation := map[string]string{"stop": "start", "start": "stop", "pause": "unpause"}[operationType]
+	return operateOpenstackServers(ctx, client, recoveringOperation, recovering)
+}
+
+func (be *ServerExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// authenticate by the cloud of clouds.yaml in the flags or env
+func createProviderClientByFlags(ctx context.Context, model *spec.ExpModel) (*gophercloud.ProviderClient, gophercloud.EndpointOpts, *spec.Response) {
+	provider, endpointOpts, _err := CreateProviderClient(ctx, model.ActionFlags["cloud"], model.ActionFlags["cloudsFile"], model.ActionFlags["regionName"])
+	if _err != nil {
+		log.Errorf(ctx, "authenticate openstack failed, err: %s", _err.Error())
+		return nil, endpointOpts, spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "authenticate openstack failed")
+	}
+	return provider, endpointOpts, nil
+}
+
+// CreateProviderClient authenticates to keystone by the cloud of clouds.yaml, the keystone env like OS_AUTH_URL is
+// used if neither the cloud nor env OS_CLOUD is provided
+func CreateProviderClient(ctx context.Context, cloud, cloudsFile, regionName string) (*gophercloud.ProviderClient, gophercloud.EndpointOpts, error) {
+	var authOptions gophercloud.AuthOptions
+	var endpointOpts gophercloud.EndpointOpts
+	var tlsConfig *tls.Config
+	var _err error
+	if cloud == "" && os.Getenv("OS_CLOUD") == "" {
+		if authOptions, _err = openstack.AuthOptionsFromEnv(); _err != nil {
+			return nil, endpointOpts, _err
+		}
+		endpointOpts.Region = regionName
+		if endpointOpts.Region == "" {
+			endpointOpts.Region = os.Getenv("OS_REGION_NAME")
+		}
+	} else {
+		var options []clouds.ParseOption
+		if cloud != "" {
+			options = append(options, clouds.WithCloudName(cloud))
+		}
+		if cloudsFile != "" {
+			options = append(options, clouds.WithLocations(cloudsFile))
+		}
+		if regionName != "" {
+			options = append(options, clouds.WithRegion(regionName))
+		}
+		if authOptions, endpointOpts, tlsConfig, _err = clouds.Parse(options...); _err != nil {
+			return nil, endpointOpts, _err
+		}
+	}
+
+	provider, _err := openstack.NewClient(authOptions.IdentityEndpoint)
+	if _err != nil {
+		return nil, endpointOpts, _err
+	}
+	if tlsConfig != nil {
+		provider.HTTPClient = http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+	_err = openstack.Authenticate(ctx, provider, authOptions)
+	return provider, endpointOpts, _err
+}
+
+// stop, start, pause or unpause servers
+func operateOpenstackServers(ctx context.Context, client *gophercloud.ServiceClient, operationType string, serversArray []string) *spec.Response {
+	for _, server := range serversArray {
+		var _err error
+		switch operationType {
+		case "stop":
+			_err = servers.Stop(ctx, client, server).ExtractErr()
+		case "start":
+			_err = servers.Start(ctx, client, server).ExtractErr()
+		case "pause":
+			_err = servers.Pause(ctx, client, server).ExtractErr()
+		case "unpause":
+			_err = servers.Unpause(ctx, client, server).ExtractErr()
+		}
+		if _err != nil {
+			log.Errorf(ctx, "%s openstack server %s failed, err: %s", operationType, server, _err.Error())
+			return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, operationType+" openstack servers failed")
+		}
+	}
+	return spec.Success()
+}
+
+// describe the status of servers, like ACTIVE, SHUTOFF, PAUSED, after their tasks in progress are done. A server keeps
+// the status with a task state, like ACTIVE with powering-off, until nova finishes the operation, so the servers
+// operated just now are waited to be settled to not miss them
+func describeSettledOpenstackServersStatus(ctx context.Context, client *gophercloud.ServiceClient, serversArray []string) (_result map[string]string, _err error) {
+	start := time.Now()
+	for {
+		statusMap := map[string]string{}
+		var settling []string
+		for _, server := range serversArray {
+			detail, _err := servers.Get(ctx, client, server).Extract()
+			if _err != nil {
+				log.Errorf(ctx, "describe openstack server %s failed, err: %s", server, _err.Error())
+				return _result, _err
+			}
+			statusMap[server] = detail.Status
+			if detail.TaskState != "" {
+				settling = append(settling, server)
+			}
+		}
+		if len(settling) == 0 {
+			_result = statusMap
+			return _result, nil
+		}
+		if time.Since(start) > serverSettledTimeout {
+			_err = fmt.Errorf("openstack servers %v are not settled after %s", settling, serverSettledTimeout)
+			log.Errorf(ctx, "wait openstack servers settled failed, err: %s", _err.Error())
+			return _result, _err
+		}
+		log.Infof(ctx, "wait openstack servers %v settled", settling)
+		time.Sleep(serverPollInterval)
+	}
+}
@@ -0,0 +1,280 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePort struct {
+	Id             string              `json:"id"`
+	NetworkId      string              `json:"network_id"`
+	DeviceId       string              `json:"device_id"`
+	MacAddress     string              `json:"mac_address"`
+	FixedIps       []map[string]string `json:"fixed_ips"`
+	SecurityGroups []string            `json:"security_groups"`
+	PortSecurity   *bool               `json:"port_security_enabled,omitempty"`
+}
+
+// fakeOpenstack is a local keystone, nova and neutron stand-in which keeps the servers and ports
+type fakeOpenstack struct {
+	sync.Mutex
+	url     string
+	status  map[string]string
+	tasks   map[string]string
+	ports   map[string]*fakePort
+	actions []string
+	// the ports created by nova on boot are deleted on detach
+	deleteOnDetach bool
+	// the ports being detached, which are still attached for one query
+	detaching map[string]bool
+	// the next attach of port fails
+	failAttach bool
+}
+
+func (f *fakeOpenstack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/identity/v3/auth/tokens":
+		w.Header().Set("X-Subject-Token", "token")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":{"expires_at":"%s","catalog":[
+			{"type":"compute","endpoints":[{"interface":"public","region_id":"RegionOne","region":"RegionOne","url":"%s/compute/v2.1"}]},
+			{"type":"network","endpoints":[{"interface":"public","region_id":"RegionOne","region":"RegionOne","url":"%s/network"}]}]}}`,
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339), f.url, f.url)
+	case strings.HasPrefix(r.URL.Path, "/compute/v2.1/servers/"):
+		f.serveNova(w, r, strings.Split(strings.TrimPrefix(r.URL.Path, "/compute/v2.1/servers/"), "/"))
+	case r.URL.Path == "/network/v2.0/ports" && r.Method == http.MethodPost:
+		var body struct {
+			Port *fakePort `json:"port"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		port := body.Port
+		port.Id = fmt.Sprintf("port-new-%d", len(f.actions))
+		f.actions = append(f.actions, "create "+port.NetworkId+" "+port.FixedIps[0]["ip_address"])
+		f.ports[port.Id] = port
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"port": port})
+	case r.URL.Path == "/network/v2.0/ports":
+		var items []*fakePort
+		for _, port := range f.ports {
+			if port.DeviceId == r.URL.Query().Get("device_id") {
+				items = append(items, port)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"ports": items})
+	case strings.HasPrefix(r.URL.Path, "/network/v2.0/ports/"):
+		port, ok := f.ports[strings.TrimPrefix(r.URL.Path, "/network/v2.0/ports/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"NeutronError":{"type":"PortNotFound","message":"not found"}}`))
+			return
+		}
+		if r.Method == http.MethodPut {
+			var body struct {
+				Port struct {
+					SecurityGroups []string `json:"security_groups"`
+				} `json:"port"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			port.SecurityGroups = body.Port.SecurityGroups
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"port": port})
+		if f.detaching[port.Id] {
+			if f.deleteOnDetach {
+				delete(f.ports, port.Id)
+			} else {
+				port.DeviceId = ""
+			}
+			delete(f.detaching, port.Id)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeOpenstack) serveNova(w http.ResponseWriter, r *http.Request, parts []string) {
+	status, ok := f.status[parts[0]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"itemNotFound":{"code":404,"message":"not found"}}`))
+		return
+	}
+	switch {
+	case len(parts) == 1:
+		json.NewEncoder(w).Encode(map[string]interface{}{"server": map[string]string{"id": parts[0], "status": status, "OS-EXT-STS:task_state": f.tasks[parts[0]]}})
+		// the server keeps the status with the task state for one query before it is settled
+		if task, ok := f.tasks[parts[0]]; ok {
+			f.status[parts[0]] = map[string]string{"powering-off": "SHUTOFF", "powering-on": "ACTIVE"}[task]
+			delete(f.tasks, parts[0])
+		}
+	case parts[1] == "action":
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		for action := range body {
+			f.actions = append(f.actions, action)
+			if task, ok := map[string]string{"os-stop": "powering-off", "os-start": "powering-on"}[action]; ok {
+				f.tasks[parts[0]] = task
+				continue
+			}
+			f.status[parts[0]] = map[string]string{"reboot": "ACTIVE", "pause": "PAUSED", "unpause": "ACTIVE"}[action]
+		}
+		w.WriteHeader(http.StatusAccepted)
+	case parts[1] == "os-interface" && r.Method == http.MethodDelete:
+		f.actions = append(f.actions, "detach "+parts[2])
+		f.detaching[parts[2]] = true
+		w.WriteHeader(http.StatusAccepted)
+	case parts[1] == "os-interface" && r.Method == http.MethodPost:
+		var body struct {
+			InterfaceAttachment struct {
+				PortId string `json:"port_id"`
+			} `json:"interfaceAttachment"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if f.failAttach {
+			f.failAttach = false
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"conflictingRequest":{"code":409,"message":"conflict"}}`))
+			return
+		}
+		port := f.ports[body.InterfaceAttachment.PortId]
+		f.actions = append(f.actions, "attach "+port.Id)
+		port.DeviceId = parts[0]
+		json.NewEncoder(w).Encode(map[string]interface{}{"interfaceAttachment": map[string]string{"port_id": port.Id, "net_id": port.NetworkId}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// start the fake openstack and write the clouds.yaml of cloud fake pointing to it
+func newFakeOpenstack(t *testing.T) (*fakeOpenstack, string) {
+	fake := &fakeOpenstack{
+		status:    map[string]string{"server-1": "ACTIVE", "server-2": "ACTIVE"},
+		tasks:     map[string]string{},
+		detaching: map[string]bool{},
+		ports: map[string]*fakePort{
+			"port-1": {Id: "port-1", NetworkId: "net-1", DeviceId: "server-1", MacAddress: "fa:16:3e:00:00:01", FixedIps: []map[string]string{{"ip_address": "10.0.0.11"}}, SecurityGroups: []string{"sg-web"}},
+			"port-2": {Id: "port-2", NetworkId: "net-2", DeviceId: "server-1", MacAddress: "fa:16:3e:00:00:02", FixedIps: []map[string]string{{"ip_address": "10.0.1.11"}}, SecurityGroups: []string{"sg-web", "sg-ssh"}},
+		},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	fake.url = server.URL
+	cloudsFile := path.Join(t.TempDir(), "clouds.yaml")
+	clouds := fmt.Sprintf(`clouds:
+  fake:
+    auth:
+      auth_url: %s/identity/v3
+      username: admin
+      password: secret
+      project_name: admin
+      user_domain_name: Default
+      project_domain_name: Default
+    region_name: RegionOne
+    identity_api_version: 3
+`, server.URL)
+	assert.Nil(t, os.WriteFile(cloudsFile, []byte(clouds), 0600))
+	return fake, cloudsFile
+}
+
+// authenticate to the fake openstack and create the compute and network clients
+func newFakeClients(t *testing.T, cloudsFile string) (*gophercloud.ServiceClient, *gophercloud.ServiceClient) {
+	provider, endpointOpts, err := CreateProviderClient(context.Background(), "fake", cloudsFile, "")
+	assert.Nil(t, err)
+	computeClient, err := openstack.NewComputeV2(provider, endpointOpts)
+	assert.Nil(t, err)
+	networkClient, err := openstack.NewNetworkV2(provider, endpointOpts)
+	assert.Nil(t, err)
+	return computeClient, networkClient
+}
+
+func TestOpenstackServerStop(t *testing.T) {
+	serverPollInterval = time.Millisecond
+	defer func() { serverPollInterval = 5 * time.Second }()
+	fake, cloudsFile := newFakeOpenstack(t)
+	computeClient, _ := newFakeClients(t, cloudsFile)
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := (&ServerExecutor{}).start(ctx, computeClient, "stop", []string{"server-1"}, servers.SoftReboot)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "ACTIVE", fake.status["server-1"], "they should be equal")
+	assert.Equal(t, "powering-off", fake.tasks["server-1"], "they should be equal")
+
+	// the servers powering off are waited to be stopped, and only the stopped servers are started
+	result = (&ServerExecutor{}).stop(ctx, computeClient, "stop", []string{"server-1", "server-2"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "powering-on", fake.tasks["server-1"], "they should be equal")
+	assert.Equal(t, "", fake.tasks["server-2"], "they should be equal")
+	assert.Equal(t, []string{"os-stop", "os-start"}, fake.actions, "they should be equal")
+}
+
+func TestOpenstackServerPauseAndReboot(t *testing.T) {
+	fake, cloudsFile := newFakeOpenstack(t)
+	computeClient, _ := newFakeClients(t, cloudsFile)
+	ctx := context.WithValue(context.Background(), "uid", "123")
+
+	result := (&ServerExecutor{}).start(ctx, computeClient, "pause", []string{"server-1", "server-2"}, servers.SoftReboot)
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "PAUSED", fake.status["server-2"], "they should be equal")
+	result = (&ServerExecutor{}).stop(ctx, computeClient, "pause", []string{"server-1", "server-2"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "ACTIVE", fake.status["server-2"], "they should be equal")
+
+	result = (&ServerExecutor{}).start(ctx, computeClient, "reboot", []string{"server-1"}, servers.HardReboot)
+	assert.True(t, result.Success, result.Err)
+	result = (&ServerExecutor{}).stop(ctx, computeClient, "reboot", []string{"server-1"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, []string{"pause", "pause", "unpause", "unpause", "reboot"}, fake.actions, "they should be equal")
+
+	result = (&ServerExecutor{}).start(ctx, computeClient, "stop", []string{"server-3"}, servers.SoftReboot)
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+
+	result = (&ServerExecutor{}).start(ctx, computeClient, "delete", []string{"server-1"}, servers.SoftReboot)
+	assert.Equal(t, int32(47000), result.Code, "they should be equal")
+
+	// unpause is only the recovery of pause, it can not be destroyed by itself
+	result = (&ServerExecutor{}).start(ctx, computeClient, "unpause", []string{"server-1"}, servers.SoftReboot)
+	assert.Equal(t, int32(47000), result.Code, "they should be equal")
+}
+
+func TestOpenstackCreateProviderClient(t *testing.T) {
+	_, cloudsFile := newFakeOpenstack(t)
+	_, _, err := CreateProviderClient(context.Background(), "missing", cloudsFile, "")
+	assert.NotNil(t, err)
+
+	provider, endpointOpts, err := CreateProviderClient(context.Background(), "fake", cloudsFile, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "token", provider.Token(), "they should be equal")
+	assert.Equal(t, "RegionOne", endpointOpts.Region, "they should be equal")
+}
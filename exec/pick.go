@@ -0,0 +1,42 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import "math/rand"
+
+// PercentCount gets the count of percent of total, at least 1 if percent is
+// positive and total is not empty
+func PercentCount(total, percent int) int {
+	count := (total*percent + 99) / 100
+	if count > total {
+		count = total
+	}
+	return count
+}
+
+// PickRandomly picks count items randomly without changing the given items
+func PickRandomly(items []string, count int) []string {
+	picked := make([]string, len(items))
+	copy(picked, items)
+	rand.Shuffle(len(picked), func(i, j int) {
+		picked[i], picked[j] = picked[j], picked[i]
+	})
+	if count < len(picked) {
+		picked = picked[:count]
+	}
+	return picked
+}
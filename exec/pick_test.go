@@ -0,0 +1,39 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentCount(t *testing.T) {
+	assert.Equal(t, 1, PercentCount(3, 10), "they should be equal")
+	assert.Equal(t, 2, PercentCount(4, 50), "they should be equal")
+	assert.Equal(t, 4, PercentCount(4, 100), "they should be equal")
+	assert.Equal(t, 0, PercentCount(0, 50), "they should be equal")
+}
+
+func TestPickRandomly(t *testing.T) {
+	items := []string{"i-1", "i-2", "i-3"}
+	picked := PickRandomly(items, 2)
+	assert.Equal(t, 2, len(picked), "they should be equal")
+	assert.Subset(t, items, picked)
+	assert.Equal(t, []string{"i-1", "i-2", "i-3"}, items, "they should be equal")
+	assert.ElementsMatch(t, []string{"i-x", "i-y"}, PickRandomly([]string{"i-x", "i-y"}, 5))
+}
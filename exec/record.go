@@ -0,0 +1,84 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+)
+
+// RecordDir is the directory that keeps the state captured by an experiment
+// when it is created, so the destroy command, which runs in another chaos_cloud
+// process, can restore exactly what was changed. Empty means the records
+// directory under the program path.
+var RecordDir = ""
+
+func recordFile(uid string) string {
+	dir := RecordDir
+	if dir == "" {
+		dir = path.Join(util.GetProgramPath(), "records")
+	}
+	return path.Join(dir, fmt.Sprintf("cloud-%s.json", uid))
+}
+
+// SaveRecord stores the record of the experiment identified by uid
+func SaveRecord(uid string, record interface{}) error {
+	if uid == "" {
+		return fmt.Errorf("uid is required to save the experiment record")
+	}
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	file := recordFile(uid)
+	if err := os.MkdirAll(path.Dir(file), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(file, bytes, 0600)
+}
+
+// LoadRecord reads the record of the experiment identified by uid into record,
+// it returns false if the experiment has no record
+func LoadRecord(uid string, record interface{}) (bool, error) {
+	if uid == "" {
+		return false, nil
+	}
+	bytes, err := os.ReadFile(recordFile(uid))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, json.Unmarshal(bytes, record)
+}
+
+// RemoveRecord deletes the record of the experiment identified by uid
+func RemoveRecord(uid string) error {
+	if uid == "" {
+		return nil
+	}
+	err := os.Remove(recordFile(uid))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
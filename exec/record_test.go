@@ -0,0 +1,42 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecord(t *testing.T) {
+	RecordDir = t.TempDir()
+	defer func() { RecordDir = "" }()
+
+	saved := map[string][]string{"eni-x": {"1.1.1.1", "2.2.2.2"}}
+	assert.Nil(t, SaveRecord("123", saved))
+
+	loaded := map[string][]string{}
+	exist, err := LoadRecord("123", &loaded)
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	assert.Equal(t, saved, loaded, "they should be equal")
+
+	assert.Nil(t, RemoveRecord("123"))
+	exist, err = LoadRecord("123", &loaded)
+	assert.Nil(t, err)
+	assert.False(t, exist)
+}
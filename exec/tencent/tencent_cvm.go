@@ -0,0 +1,327 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tencent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chaosblade-io/chaosblade-spec-go/log"
+	"github.com/chaosblade-io/chaosblade-spec-go/spec"
+	"github.com/chaosblade-io/chaosblade-spec-go/util"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
+	cvm "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cvm/v20170312"
+
+	"github.com/chaosblade-io/chaosblade-exec-cloud/exec/category"
+)
+
+const CvmBin = "chaos_tencent_cvm"
+
+// the max time to wait for the instances in transitional states, like STOPPING, to be settled before recovering them
+const cvmSettledTimeout = 10 * time.Minute
+
+// the interval to poll the status of instances in transitional states
+var cvmPollInterval = 5 * time.Second
+
+// the transitional states of instances, which settle to a stable one by themselves
+var cvmTransitionalStatus = map[string]bool{
+	"PENDING":   true,
+	"STARTING":  true,
+	"STOPPING":  true,
+	"REBOOTING": true,
+}
+
+type CvmActionSpec struct {
+	spec.BaseExpActionCommandSpec
+}
+
+func NewCvmActionSpec() spec.ExpActionCommandSpec {
+	return &CvmActionSpec{
+		spec.BaseExpActionCommandSpec{
+			ActionFlags: []spec.ExpFlagSpec{
+				&spec.ExpFlag{
+					Name: "accessKeyId",
+					Desc: "the secretId of tencent cloud, if not provided, get from env ACCESS_KEY_ID",
+				},
+				&spec.ExpFlag{
+					Name: "accessKeySecret",
+					Desc: "the secretKey of tencent cloud, if not provided, get from env ACCESS_KEY_SECRET",
+				},
+				&spec.ExpFlag{
+					Name: "regionId",
+					Desc: "the regionId of tencent cloud",
+				},
+				&spec.ExpFlag{
+					Name: "type",
+					Desc: "the operation of instances, support start, stop, reboot",
+				},
+				&spec.ExpFlag{
+					Name: "instances",
+					Desc: "the instances list, split by comma",
+				},
+				&spec.ExpFlag{
+					Name: "endpoint",
+					Desc: "the endpoint of cvm api, default is cvm.tencentcloudapi.com, the http scheme is used if it starts with http://",
+				},
+			},
+			ActionExecutor: &CvmExecutor{},
+			ActionExample: `
+# stop instances which instance id is ins-x,ins-y
+blade create tencent cvm --accessKeyId xxx --accessKeySecret yyy --regionId ap-guangzhou --type stop --instances ins-x,ins-y
+
+# start instances which instance id is ins-x,ins-y
+blade create tencent cvm --accessKeyId xxx --accessKeySecret yyy --regionId ap-guangzhou --type start --instances ins-x,ins-y
+
+# reboot instances which instance id is ins-x,ins-y
+blade create tencent cvm --accessKeyId xxx --accessKeySecret yyy --regionId ap-guangzhou --type reboot --instances ins-x,ins-y`,
+			ActionPrograms:   []string{CvmBin},
+			ActionCategories: []string{category.Cloud + "_" + category.Tencent + "_" + category.Cvm},
+		},
+	}
+}
+
+func (*CvmActionSpec) Name() string {
+	return "cvm"
+}
+
+func (*CvmActionSpec) Aliases() []string {
+	return []string{}
+}
+
+func (*CvmActionSpec) ShortDesc() string {
+	return "do some tencent cloud cvm Operations, like stop, start, reboot"
+}
+
+func (b *CvmActionSpec) LongDesc() string {
+	if b.ActionLongDesc != "" {
+		return b.ActionLongDesc
+	}
+	return "do some tencent cloud cvm Operations, like stop, start, reboot"
+}
+
+type CvmExecutor struct {
+	channel spec.Channel
+}
+
+func (*CvmExecutor) Name() string {
+	return "cvm"
+}
+
+func (be *CvmExecutor) Exec(uid string, ctx context.Context, model *spec.ExpModel) *spec.Response {
+	if be.channel == nil {
+		util.Errorf(uid, util.GetRunFuncName(), spec.ChannelNil.Msg)
+		return spec.ResponseFailWithFlags(spec.ChannelNil)
+	}
+	accessKeyId := model.ActionFlags["accessKeyId"]
+	accessKeySecret := model.ActionFlags["accessKeySecret"]
+	regionId := model.ActionFlags["regionId"]
+	operationType := model.ActionFlags["type"]
+	instances := model.ActionFlags["instances"]
+	endpoint := model.ActionFlags["endpoint"]
+	if accessKeyId == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_ID")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_ID from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeyId")
+		}
+		accessKeyId = val
+	}
+
+	if accessKeySecret == "" {
+		val, ok := os.LookupEnv("ACCESS_KEY_SECRET")
+		if !ok {
+			log.Errorf(ctx, "could not get ACCESS_KEY_SECRET from env or parameter!")
+			return spec.ResponseFailWithFlags(spec.ParameterLess, "accessKeySecret")
+		}
+		accessKeySecret = val
+	}
+
+	if regionId == "" {
+		log.Errorf(ctx, "regionId is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "regionId")
+	}
+
+	if operationType == "" {
+		log.Errorf(ctx, "operationType is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "type")
+	}
+
+	if instances == "" {
+		log.Errorf(ctx, "instances is required!")
+		return spec.ResponseFailWithFlags(spec.ParameterLess, "instances")
+	}
+	instancesArray := strings.Split(instances, ",")
+
+	client, _err := CreateClient(accessKeyId, accessKeySecret, regionId, endpoint)
+	if _err != nil {
+		log.Errorf(ctx, "create tencent cloud client failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "create tencent cloud client failed")
+	}
+
+	if _, ok := spec.IsDestroy(ctx); ok {
+		return be.stop(ctx, client, operationType, instancesArray)
+	}
+	return be.start(ctx, client, operationType, instancesArray)
+}
+
+func (be *CvmExecutor) start(ctx context.Context, client *cvm.Client, operationType string, instancesArray []string) *spec.Response {
+	switch operationType {
+	case "start":
+		return startInstances(ctx, client, instancesArray)
+	case "stop":
+		return stopInstances(ctx, client, instancesArray)
+	case "reboot":
+		return rebootInstances(ctx, client, instancesArray)
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support start, stop, reboot)")
+	}
+}
+
+func (be *CvmExecutor) stop(ctx context.Context, client *cvm.Client, operationType string, instancesArray []string) *spec.Response {
+	switch operationType {
+	case "start", "stop":
+		instanceStatusMap, _err := describeSettledInstancesStatus(ctx, client, instancesArray)
+		if _err != nil {
+			return spec.ResponseFailWithFlags(spec.ParameterRequestFailed, "describe instances status failed")
+		}
+		// only the instances still in the injected state are recovered
+		injectedStatus := map[string]string{"start": "RUNNING", "stop": "STOPPED"}[operationType]
+		var recovering []string
+		for _, instance := range instancesArray {
+			if instanceStatusMap[instance] == injectedStatus {
+				recovering = append(recovering, instance)
+			}
+		}
+		if len(recovering) == 0 {
+			log.Infof(ctx, "no instance of %v is %s, nothing to recover", instancesArray, injectedStatus)
+			return spec.Success()
+		}
+		if operationType == "start" {
+			return stopInstances(ctx, client, recovering)
+		}
+		return startInstances(ctx, client, recovering)
+	case "reboot":
+		// the rebooted instances recover by themselves
+		log.Infof(ctx, "nothing to recover for rebooted instances %v", instancesArray)
+		return spec.Success()
+	default:
+		return spec.ResponseFailWithFlags(spec.ParameterInvalid, "type is not support(support start, stop, reboot)")
+	}
+}
+
+func (be *CvmExecutor) SetChannel(channel spec.Channel) {
+	be.channel = channel
+}
+
+// CreateClient creates the cvm client, the endpoint is optional
+func CreateClient(accessKeyId, accessKeySecret, regionId, endpoint string) (_result *cvm.Client, _err error) {
+	clientProfile := profile.NewClientProfile()
+	if strings.HasPrefix(endpoint, "http://") {
+		clientProfile.HttpProfile.Scheme = "HTTP"
+	}
+	if endpoint = strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"), "https://"); endpoint != "" {
+		clientProfile.HttpProfile.Endpoint = endpoint
+	}
+	_result, _err = cvm.NewClient(common.NewCredential(accessKeyId, accessKeySecret), regionId, clientProfile)
+	return _result, _err
+}
+
+// start instances
+func startInstances(ctx context.Context, client *cvm.Client, instances []string) *spec.Response {
+	request := cvm.NewStartInstancesRequest()
+	request.InstanceIds = common.StringPtrs(instances)
+	_, _err := client.StartInstances(request)
+	if _err != nil {
+		log.Errorf(ctx, "start tencent cloud instances failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "start tencent cloud instances failed")
+	}
+	return spec.Success()
+}
+
+// stop instances
+func stopInstances(ctx context.Context, client *cvm.Client, instances []string) *spec.Response {
+	request := cvm.NewStopInstancesRequest()
+	request.InstanceIds = common.StringPtrs(instances)
+	_, _err := client.StopInstances(request)
+	if _err != nil {
+		log.Errorf(ctx, "stop tencent cloud instances failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "stop tencent cloud instances failed")
+	}
+	return spec.Success()
+}
+
+// reboot instances
+func rebootInstances(ctx context.Context, client *cvm.Client, instances []string) *spec.Response {
+	request := cvm.NewRebootInstancesRequest()
+	request.InstanceIds = common.StringPtrs(instances)
+	_, _err := client.RebootInstances(request)
+	if _err != nil {
+		log.Errorf(ctx, "reboot tencent cloud instances failed, err: %s", _err.Error())
+		return spec.ResponseFailWithFlags(spec.ContainerInContextNotFound, "reboot tencent cloud instances failed")
+	}
+	return spec.Success()
+}
+
+// describe instances status
+func describeInstancesStatus(ctx context.Context, client *cvm.Client, instances []string) (_result map[string]string, _err error) {
+	request := cvm.NewDescribeInstancesStatusRequest()
+	request.InstanceIds = common.StringPtrs(instances)
+	request.Limit = common.Int64Ptr(100)
+	response, _err := client.DescribeInstancesStatus(request)
+	if _err != nil {
+		log.Errorf(ctx, "describe tencent cloud instances status failed, err: %s", _err.Error())
+		return _result, _err
+	}
+	statusMap := map[string]string{}
+	for _, instanceStatus := range response.Response.InstanceStatusSet {
+		statusMap[*instanceStatus.InstanceId] = *instanceStatus.InstanceState
+	}
+	_result = statusMap
+	return _result, _err
+}
+
+// describe instances status after the instances in transitional states are settled, like STOPPING to STOPPED,
+// so that the instances operated just now are not missed
+func describeSettledInstancesStatus(ctx context.Context, client *cvm.Client, instances []string) (_result map[string]string, _err error) {
+	start := time.Now()
+	for {
+		_result, _err = describeInstancesStatus(ctx, client, instances)
+		if _err != nil {
+			return _result, _err
+		}
+		var settling []string
+		for _, instance := range instances {
+			if cvmTransitionalStatus[_result[instance]] {
+				settling = append(settling, instance)
+			}
+		}
+		if len(settling) == 0 {
+			return _result, nil
+		}
+		if time.Since(start) > cvmSettledTimeout {
+			_err = fmt.Errorf("tencent cloud instances %v are not settled after %s", settling, cvmSettledTimeout)
+			log.Errorf(ctx, "wait tencent cloud instances settled failed, err: %s", _err.Error())
+			return nil, _err
+		}
+		log.Infof(ctx, "wait tencent cloud instances %v settled", settling)
+		time.Sleep(cvmPollInterval)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tencent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCvm is a local cvm api stand-in which keeps the instance states
+type fakeCvm struct {
+	sync.Mutex
+	states  map[string]string
+	actions []string
+}
+
+func (f *fakeCvm) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	action := r.Header.Get("X-TC-Action")
+	f.actions = append(f.actions, action)
+	var request struct {
+		InstanceIds []string
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	response := map[string]interface{}{"RequestId": "r-1"}
+	for _, instance := range request.InstanceIds {
+		if _, ok := f.states[instance]; !ok {
+			response["Error"] = map[string]string{"Code": "InvalidInstanceId.NotFound", "Message": "not found"}
+			json.NewEncoder(w).Encode(map[string]interface{}{"Response": response})
+			return
+		}
+	}
+	if action == "DescribeInstancesStatus" {
+		var statuses []map[string]string
+		for _, instance := range request.InstanceIds {
+			statuses = append(statuses, map[string]string{"InstanceId": instance, "InstanceState": f.states[instance]})
+		}
+		response["InstanceStatusSet"] = statuses
+		response["TotalCount"] = len(statuses)
+	}
+	// the instances are reported in the transitional states once before they are settled
+	for _, instance := range request.InstanceIds {
+		switch action {
+		case "StopInstances":
+			f.states[instance] = "STOPPING"
+		case "StartInstances", "RebootInstances":
+			f.states[instance] = "STARTING"
+		case "DescribeInstancesStatus":
+			if settled, ok := map[string]string{"STOPPING": "STOPPED", "STARTING": "RUNNING"}[f.states[instance]]; ok {
+				f.states[instance] = settled
+			}
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"Response": response})
+}
+
+func TestTencentCvmStop(t *testing.T) {
+	cvmPollInterval = time.Millisecond
+	defer func() { cvmPollInterval = 5 * time.Second }()
+	fake := &fakeCvm{states: map[string]string{"ins-1": "RUNNING", "ins-2": "RUNNING"}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ctx := context.WithValue(context.Background(), "uid", "123")
+	client, err := CreateClient("accessKeyId", "accessKeySecret", "ap-guangzhou", server.URL)
+	assert.Nil(t, err)
+
+	result := (&CvmExecutor{}).start(ctx, client, "stop", []string{"ins-1"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "STOPPING", fake.states["ins-1"], "they should be equal")
+
+	// the stopping instances are waited to be stopped, and only the stopped instances are started
+	result = (&CvmExecutor{}).stop(ctx, client, "stop", []string{"ins-1", "ins-2"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, "STARTING", fake.states["ins-1"], "they should be equal")
+	assert.Equal(t, "RUNNING", fake.states["ins-2"], "they should be equal")
+	assert.Equal(t, []string{"StopInstances", "DescribeInstancesStatus", "DescribeInstancesStatus", "StartInstances"}, fake.actions, "they should be equal")
+}
+
+func TestTencentCvmReboot(t *testing.T) {
+	fake := &fakeCvm{states: map[string]string{"ins-1": "RUNNING"}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ctx := context.WithValue(context.Background(), "uid", "123")
+	client, err := CreateClient("accessKeyId", "accessKeySecret", "ap-guangzhou", server.URL)
+	assert.Nil(t, err)
+
+	result := (&CvmExecutor{}).start(ctx, client, "reboot", []string{"ins-1"})
+	assert.True(t, result.Success, result.Err)
+	result = (&CvmExecutor{}).stop(ctx, client, "reboot", []string{"ins-1"})
+	assert.True(t, result.Success, result.Err)
+	assert.Equal(t, []string{"RebootInstances"}, fake.actions, "they should be equal")
+
+	result = (&CvmExecutor{}).start(ctx, client, "start", []string{"ins-2"})
+	assert.Equal(t, int32(56002), result.Code, "they should be equal")
+
+	_, err = describeInstancesStatus(ctx, client, []string{"ins-2"})
+	assert.NotNil(t, err)
+
+	result = (&CvmExecutor{}).start(ctx, client, "delete", []string{"ins-1"})
+	assert.Equal(t, int32(47000), result.Code, "they should be equal")
+}
@@ -50,7 +50,7 @@ func init() {
 				}
 			}
 			util.MergeModels()
-			modelActionFlags[commandSpec.Name()+modelAction.Name()] = append(
+			actionFlags := append(
 				append(flags, append(xes, matchers...)...),
 				model.UidFlag,
 				model.ChannelFlag,
@@ -60,6 +60,10 @@ func init() {
 				model.NsNetFlag,
 				model.DebugFlag,
 			)
+			modelActionFlags[commandSpec.Name()+modelAction.Name()] = actionFlags
+			for _, alias := range modelAction.Aliases() {
+				modelActionFlags[commandSpec.Name()+alias] = actionFlags
+			}
 		}
 	}
 }